@@ -0,0 +1,97 @@
+package cmd
+
+import (
+    "errors"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+
+    "github.com/spf13/cobra"
+    "kcap/pkg/policy"
+    "kcap/pkg/printer"
+)
+
+var configCmd = &cobra.Command{
+    Use:   "config",
+    Short: "Inspect the kcap policy file",
+}
+
+var configViewCmd = &cobra.Command{
+    Use:   "view",
+    Short: "Print the effective policy: the policy file with CLI flags applied",
+    Run: func(cmd *cobra.Command, args []string) {
+        out := newPrinter(cmd)
+        pol, err := loadPolicy(cmd)
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+        printDocument(out, printer.Document{Items: pol})
+    },
+}
+
+func init() {
+    addOutputFlag(configViewCmd, "yaml")
+    addPolicyFlags(configViewCmd)
+    configCmd.AddCommand(configViewCmd)
+}
+
+// addScaleInFlags registers the flags overriding the node thresholds of the policy.
+func addScaleInFlags(c *cobra.Command) {
+    c.Flags().Float64Var(&flagCPUScaleIn, "cpu-scale-in-threshold", policy.DefaultCPUScaleInPercent, "Nodes below this CPU usage percentage are scale-in candidates")
+    c.Flags().Float64Var(&flagMemScaleIn, "mem-scale-in-threshold", policy.DefaultMemScaleInPercent, "Nodes below this memory usage percentage are scale-in candidates")
+}
+
+// addPolicyFlags registers the flags overriding the node and pod thresholds of the policy.
+func addPolicyFlags(c *cobra.Command) {
+    c.Flags().Float64Var(&flagThreshold, "threshold", policy.DefaultWastePercent, "Waste threshold percentage")
+    c.Flags().Float64Var(&flagUnderThreshold, "under-threshold", policy.DefaultUnderProvisionPercent, "Usage as a percentage of the request at which an increase is recommended")
+    c.Flags().Float64Var(&flagHeadroom, "headroom", policy.DefaultHeadroomPercent, "Headroom percentage added to usage for proposed requests")
+    addScaleInFlags(c)
+}
+
+// loadPolicy reads the policy file given by --config, or ~/.kcap.yaml when it
+// exists, and applies the policy flags the user set on top of it.
+func loadPolicy(cmd *cobra.Command) (*policy.Policy, error) {
+    path := flagConfig
+    if path == "" {
+        if home, err := os.UserHomeDir(); err == nil {
+            path = filepath.Join(home, policy.DefaultFile)
+        }
+    }
+
+    pol := policy.Default()
+    if path != "" {
+        loaded, err := policy.Load(path)
+        switch {
+        case err == nil:
+            pol = loaded
+        case flagConfig == "" && errors.Is(err, fs.ErrNotExist):
+            // No policy file in the home directory; use the defaults.
+        default:
+            return nil, fmt.Errorf("loading policy: %w", err)
+        }
+    }
+
+    flags := cmd.Flags()
+    if flags.Changed("threshold") {
+        pol.SetWastePercent(flagThreshold)
+    }
+    if flags.Changed("under-threshold") {
+        pol.SetUnderProvisionPercent(flagUnderThreshold)
+    }
+    if flags.Changed("headroom") {
+        pol.SetHeadroomPercent(flagHeadroom)
+    }
+    if flags.Changed("cpu-scale-in-threshold") {
+        pol.SetCPUScaleInPercent(flagCPUScaleIn)
+    }
+    if flags.Changed("mem-scale-in-threshold") {
+        pol.SetMemScaleInPercent(flagMemScaleIn)
+    }
+    if err := pol.Validate(); err != nil {
+        return nil, fmt.Errorf("invalid policy: %w", err)
+    }
+    return pol, nil
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+    "fmt"
+    "os"
+    "time"
+
+    "github.com/spf13/cobra"
+    "kcap/pkg/analysis"
+    "kcap/pkg/printer"
+    "kcap/pkg/usage"
+)
+
+var containersCmd = &cobra.Command{
+    Use:   "containers",
+    Short: "Show per-container request vs usage. Use --namespace to limit.",
+    Run: func(cmd *cobra.Command, args []string) {
+        out := newPrinter(cmd)
+        ctx, cancel := commandContext(30 * time.Second)
+        defer cancel()
+
+        source, provider, err := newClusterSource()
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+
+        pods, err := source.ListPods(ctx, flagNamespace)
+        if err != nil {
+            fmt.Println("Error listing pods:", err)
+            os.Exit(1)
+        }
+
+        containerUsage, err := provider.ContainerUsage(ctx, flagNamespace)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "Warning: Usage metrics not available, usage values will be zero:", err)
+        }
+        containerMetrics := usage.SelectContainers(containerUsage, flagPercentile)
+
+        list := analysis.ContainerRecords(filterDaemonSets(analysis.PodRecords(pods, nil, containerMetrics, "", workloadAnnotations(ctx, source, flagNamespace), ownerGraph(ctx, source, flagNamespace))))
+
+        t := printer.NewTable(
+            printer.Columns(
+                "NAMESPACE", "POD", "CONTAINER", "CPU(REQ/USE M)",
+                "MEM(REQ/USE MI)", "LIMIT(CPU M/MEM MI)", "WASTE% (CPU)", "WASTE% (MEM)",
+            ),
+            printer.WideColumns("NODE"),
+        )
+        for _, c := range list {
+            cpu := fmt.Sprintf("%d / %d", c.CPUReqMilli, c.CPUUsedMilli)
+            mem := fmt.Sprintf("%d / %d", c.MemReqMi, c.MemUsedMi)
+
+            cpuWaste := "N/A"
+            memWaste := "N/A"
+            if c.CPUReqMilli > 0 {
+                cpuWaste = fmt.Sprintf("%.1f", (1.0 - float64(c.CPUUsedMilli)/float64(c.CPUReqMilli))*100.0)
+            }
+            if c.MemReqMi > 0 {
+                memWaste = fmt.Sprintf("%.1f", (1.0 - float64(c.MemUsedMi)/float64(c.MemReqMi))*100.0)
+            }
+
+            limits := fmt.Sprintf("%s / %s", formatLimit(c.CPULimitMilli), formatLimit(c.MemLimitMi))
+            t.AddRow(c.Namespace, c.Pod, c.Name, cpu, mem, limits, cpuWaste, memWaste, c.NodeName)
+        }
+        printDocument(out, printer.Document{
+            Kind:     "ContainerList",
+            Cluster:  clusterInfo(source),
+            Items:    list,
+            Sections: []printer.Section{{Table: t, Records: containerRecords(list)}},
+        })
+    },
+}
+
+// containerRecords lists the containers with unformatted numbers for csv and
+// tsv output; limits are 0 when unset.
+func containerRecords(containers []analysis.ContainerRecord) *printer.Table {
+    t := printer.NewTable(printer.Columns(
+        "namespace", "pod", "container", "node",
+        "cpu_requested_m", "cpu_used_m", "cpu_limit_m", "memory_requested_mi", "memory_used_mi", "memory_limit_mi",
+        "cpu_waste_pct", "memory_waste_pct",
+    ))
+    for _, c := range containers {
+        t.AddRow(
+            c.Namespace, c.Pod, c.Name, c.NodeName,
+            c.CPUReqMilli, c.CPUUsedMilli, c.CPULimitMilli, c.MemReqMi, c.MemUsedMi, c.MemLimitMi,
+            wastePercent(c.CPUReqMilli, c.CPUUsedMilli), wastePercent(c.MemReqMi, c.MemUsedMi),
+        )
+    }
+    return t
+}
+
+func init() {
+    containersCmd.Flags().StringVar(&flagKubeconfig, "kubeconfig", "", "Path to kubeconfig file")
+    containersCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "", "Namespace")
+    addOutputFlag(containersCmd, "table")
+    addDaemonSetFlag(containersCmd)
+    addUsageFlags(containersCmd)
+}
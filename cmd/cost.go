@@ -0,0 +1,136 @@
+package cmd
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "time"
+
+    "github.com/spf13/cobra"
+    "kcap/pkg/cost"
+    "kcap/pkg/printer"
+)
+
+var costCmd = &cobra.Command{
+    Use:   "cost",
+    Short: "Monthly cost per node, namespace and workload, and savings of recommendations",
+    Run: func(cmd *cobra.Command, args []string) {
+        out := newPrinter(cmd)
+        ctx, cancel := commandContext(60 * time.Second)
+        defer cancel()
+
+        pricing, err := loadPricing()
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+
+        pol, err := loadPolicy(cmd)
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+
+        source, provider, err := newClusterSource()
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+
+        result, err := analyze(ctx, source, provider, pol, flagNamespace)
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+        report := cost.Compute(result, pricing)
+
+        money := report.FormatMoney
+        totals := fmt.Sprintf("Total: %s  Allocated: %s  Used: %s  Idle: %s  Savings from node removal: %s  from right-sizing: %s",
+            money(report.Totals.Monthly), money(report.Totals.Allocated), money(report.Totals.Used), money(report.Totals.Idle), money(report.Totals.NodeRemovalSavings), money(report.Totals.RightsizingSavings))
+
+        // Records carry amounts without the currency symbol for csv and tsv.
+        totalRecords := printer.NewTable(printer.Columns("currency", "monthly", "allocated", "used", "idle", "node_removal_savings", "rightsizing_savings"))
+        totalRecords.AddRow(report.Currency, decimal(report.Totals.Monthly), decimal(report.Totals.Allocated), decimal(report.Totals.Used), decimal(report.Totals.Idle), decimal(report.Totals.NodeRemovalSavings), decimal(report.Totals.RightsizingSavings))
+
+        nodes := printer.NewTable(printer.Columns("NODE", "INSTANCE TYPE", "HOURLY", "MONTHLY", "ALLOCATED", "USED", "IDLE"))
+        nodeRecords := printer.NewTable(printer.Columns("node", "instance_type", "hourly", "monthly", "allocated", "used", "idle"))
+        for _, n := range report.Nodes {
+            nodes.AddRow(n.Name, n.InstanceType, fmt.Sprintf("%s%.4f", report.Currency, n.Hourly), money(n.Monthly), money(n.Allocated), money(n.Used), money(n.Idle))
+            nodeRecords.AddRow(n.Name, n.InstanceType, strconv.FormatFloat(n.Hourly, 'f', 4, 64), decimal(n.Monthly), decimal(n.Allocated), decimal(n.Used), decimal(n.Idle))
+        }
+
+        namespaces := printer.NewTable(printer.Columns("NAMESPACE", "PODS", "ALLOCATED", "USED", "WASTE"))
+        namespaceRecords := printer.NewTable(printer.Columns("namespace", "pods", "allocated", "used", "waste"))
+        for _, ns := range report.Namespaces {
+            namespaces.AddRow(ns.Namespace, ns.PodCount, money(ns.Allocated), money(ns.Used), money(ns.Waste))
+            namespaceRecords.AddRow(ns.Namespace, ns.PodCount, decimal(ns.Allocated), decimal(ns.Used), decimal(ns.Waste))
+        }
+
+        workloads := printer.NewTable(printer.Columns("NAMESPACE", "KIND", "NAME", "PODS", "ALLOCATED", "USED", "WASTE"))
+        workloadRecords := printer.NewTable(printer.Columns("namespace", "kind", "name", "pods", "allocated", "used", "waste"))
+        for _, w := range report.Workloads {
+            workloads.AddRow(w.Namespace, w.Kind, w.Name, w.PodCount, money(w.Allocated), money(w.Used), money(w.Waste))
+            workloadRecords.AddRow(w.Namespace, w.Kind, w.Name, w.PodCount, decimal(w.Allocated), decimal(w.Used), decimal(w.Waste))
+        }
+
+        recs := printer.NewTable(printer.Columns("TYPE", "DETAILS", "SEVERITY", "SAVINGS"))
+        recRecords := printer.NewTable(printer.Columns("type", "details", "severity", "monthly_savings"))
+        for _, r := range report.Recommendations {
+            recs.AddRow(r.Type, r.Details, r.Severity, money(r.MonthlySavings))
+            recRecords.AddRow(r.Type, r.Details, r.Severity, decimal(r.MonthlySavings))
+        }
+
+        printDocument(out, printer.Document{
+            Kind:    "CostReport",
+            Cluster: clusterInfo(source),
+            Items:   report,
+            Sections: []printer.Section{
+                {Title: "Cluster Cost (monthly)", Text: []string{totals}, Records: totalRecords},
+                {Title: "Nodes", Table: nodes, Records: nodeRecords},
+                {Title: "Namespaces", Table: namespaces, Records: namespaceRecords},
+                {Title: "Workloads", Table: workloads, Records: workloadRecords},
+                {Title: "DaemonSets (fleet-wide)", Table: daemonSetCosts(report), Records: daemonSetCostRecords(report)},
+                {Title: "Recommendation Savings (monthly)", Table: recs, Records: recRecords},
+            },
+        })
+    },
+}
+
+// daemonSetCosts lists the DaemonSets of a cost report, costliest first.
+func daemonSetCosts(report cost.Report) *printer.Table {
+    money := report.FormatMoney
+    t := printer.NewTable(printer.Columns("NAMESPACE", "DAEMONSET", "NODES", "CPU REQ(m)", "MEM REQ(Mi)", "PER NODE", "MONTHLY"))
+    for _, d := range report.DaemonSets {
+        t.AddRow(d.Namespace, d.Name, d.Nodes, d.CPUReqMilli, d.MemReqMi, money(d.PerNodeMonthly), money(d.Monthly))
+    }
+    return t
+}
+
+// daemonSetCostRecords lists the DaemonSets of a cost report with
+// unformatted amounts for csv and tsv output.
+func daemonSetCostRecords(report cost.Report) *printer.Table {
+    t := printer.NewTable(printer.Columns("namespace", "daemonset", "nodes", "cpu_requested_m", "memory_requested_mi", "per_node_monthly", "monthly"))
+    for _, d := range report.DaemonSets {
+        t.AddRow(d.Namespace, d.Name, d.Nodes, d.CPUReqMilli, d.MemReqMi, decimal(d.PerNodeMonthly), decimal(d.Monthly))
+    }
+    return t
+}
+
+// loadPricing reads the pricing file given by --pricing, or returns the
+// built-in blended rates.
+func loadPricing() (*cost.Pricing, error) {
+    if flagPricing == "" {
+        return cost.DefaultPricing(), nil
+    }
+    return cost.LoadPricing(flagPricing)
+}
+
+func init() {
+    costCmd.Flags().StringVar(&flagKubeconfig, "kubeconfig", "", "Path to kubeconfig file")
+    costCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "", "Namespace")
+    addOutputFlag(costCmd, "table")
+    costCmd.Flags().StringVar(&flagPricing, "pricing", "", "Pricing file mapping instance types and node labels to hourly rates (default: blended rates)")
+    addPolicyFlags(costCmd)
+    addDaemonSetFlag(costCmd)
+    addUsageFlags(costCmd)
+}
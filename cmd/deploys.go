@@ -1,44 +1,44 @@
 package cmd
 
 import (
-    "context"
     "fmt"
     "os"
     "sort"
     "time"
 
     "github.com/spf13/cobra"
-    "github.com/jedib0t/go-pretty/v6/table"
     "kcap/pkg/analysis"
-    "kcap/pkg/k8s"
+    "kcap/pkg/printer"
+    "kcap/pkg/usage"
 )
 
 var deploysCmd = &cobra.Command{
     Use:   "deploys",
     Short: "Aggregated deployment CPU/memory request vs usage summary",
     Run: func(cmd *cobra.Command, args []string) {
-        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+        out := newPrinter(cmd)
+        ctx, cancel := commandContext(30 * time.Second)
         defer cancel()
 
-        kube, err := k8s.NewK8sClientWithConfig(flagKubeconfig)
+        source, provider, err := newClusterSource()
         if err != nil {
-            fmt.Println("Error creating kube client:", err)
+            fmt.Println("Error:", err)
             os.Exit(1)
         }
 
-        pods, err := kube.ListPods(ctx, flagNamespace)
+        pods, err := source.ListPods(ctx, flagNamespace)
         if err != nil {
             fmt.Println("Error listing pods:", err)
             os.Exit(1)
         }
 
-        podMetrics, err := kube.PodMetrics(ctx, flagNamespace)
+        podUsage, err := provider.PodUsage(ctx, flagNamespace)
         if err != nil {
-            fmt.Println("Warning: Metrics-server not available, usage values will be zero")
-            podMetrics = nil
+            fmt.Fprintln(os.Stderr, "Warning: Usage metrics not available, usage values will be zero:", err)
         }
+        podMetrics := usage.Select(podUsage, flagPercentile)
 
-        podRecords := analysis.PodRecords(pods, podMetrics, "")
+        podRecords := analysis.WithoutDaemonSets(analysis.PodRecords(pods, podMetrics, nil, "", workloadAnnotations(ctx, source, flagNamespace), ownerGraph(ctx, source, flagNamespace)))
         deployStats := analysis.DeploymentAggregation(podRecords)
 
         // Sort by CPU waste descending
@@ -46,28 +46,33 @@ var deploysCmd = &cobra.Command{
             return deployStats[i].WasteCPU > deployStats[j].WasteCPU
         })
 
-        if flagJSON {
-            printJSON(deployStats)
-            return
-        }
-
-        t := table.NewWriter()
-        t.SetOutputMirror(os.Stdout)
-        t.AppendHeader(table.Row{"NAMESPACE", "DEPLOYMENT", "CPU(REQ/USE m)", "MEM(REQ/USE Mi)", "PODS", "WASTE% CPU", "WASTE% MEM"})
-
+        t := printer.NewTable(
+            printer.Columns("NAMESPACE", "DEPLOYMENT", "CPU(REQ/USE m)", "MEM(REQ/USE Mi)", "PODS", "WASTE% CPU", "WASTE% MEM", "LIMIT/REQ CPU", "LIMIT/REQ MEM", "NO LIMITS"),
+            printer.WideColumns("NODES", "LIMITS(CPU m/MEM Mi)"),
+        )
         for _, d := range deployStats {
             cpu := fmt.Sprintf("%d / %d", d.CPUReqMilli, d.CPUUsedMilli)
             mem := fmt.Sprintf("%d / %d", d.MemReqMi, d.MemUsedMi)
             wasteCPU := fmt.Sprintf("%.1f", d.WasteCPU)
             wasteMem := fmt.Sprintf("%.1f", d.WasteMem)
-            t.AppendRow(table.Row{d.Namespace, d.Name, cpu, mem, d.PodCount, wasteCPU, wasteMem})
+            t.AddRow(
+                d.Namespace, d.Name, cpu, mem, d.PodCount, wasteCPU, wasteMem,
+                formatRatio(d.CPULimitMilli, d.CPULimitRatio), formatRatio(d.MemLimitMi, d.MemLimitRatio), d.PodsWithoutLimits,
+                d.NodeCount, fmt.Sprintf("%s / %s", formatLimit(d.CPULimitMilli), formatLimit(d.MemLimitMi)),
+            )
         }
-        t.Render()
+        printDocument(out, printer.Document{
+            Kind:     "DeploymentList",
+            Cluster:  clusterInfo(source),
+            Items:    deployStats,
+            Sections: []printer.Section{{Table: t, Records: workloadRecords(deployStats)}},
+        })
     },
 }
 
 func init() {
     deploysCmd.Flags().StringVar(&flagKubeconfig, "kubeconfig", "", "Path to kubeconfig file")
     deploysCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "", "Namespace")
-    deploysCmd.Flags().BoolVar(&flagJSON, "json", false, "Print output as JSON")
+    addOutputFlag(deploysCmd, "table")
+    addUsageFlags(deploysCmd)
 }
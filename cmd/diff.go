@@ -0,0 +1,147 @@
+package cmd
+
+import (
+    "fmt"
+    "os"
+    "strings"
+    "time"
+
+    "github.com/spf13/cobra"
+    "kcap/pkg/analysis"
+    "kcap/pkg/output"
+    "kcap/pkg/printer"
+    "kcap/pkg/usage"
+)
+
+var diffCmd = &cobra.Command{
+    Use:   "diff OLD.json NEW.json",
+    Short: "Compare two snapshots to track capacity drift over time",
+    Long: `Compare two snapshots to track capacity drift over time.
+
+Reports added and removed nodes and pods, the cluster waste trend, changed
+Deployments and the recommendations that appeared or were resolved. Only
+Deployments are compared workload by workload; StatefulSets, DaemonSets and
+other workloads count towards the pod and waste figures only. The waste trend
+is left out when either snapshot lacks usage.`,
+    Args: cobra.ExactArgs(2),
+    Run: func(cmd *cobra.Command, args []string) {
+        out := newPrinter(cmd)
+        ctx, cancel := commandContext(30 * time.Second)
+        defer cancel()
+
+        pol, err := loadPolicy(cmd)
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+
+        if err := usage.ValidatePercentile(flagPercentile); err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+
+        var results [2]analysis.Analysis
+        var captured [2]time.Time
+        for i, path := range args {
+            snap, err := loadSnapshot(path)
+            if err != nil {
+                fmt.Println("Error loading snapshot:", err)
+                os.Exit(1)
+            }
+            captured[i] = snap.CapturedAt
+            results[i], err = analyze(ctx, snap, snap, pol, flagNamespace)
+            if err != nil {
+                fmt.Println("Error:", err)
+                os.Exit(1)
+            }
+        }
+
+        diff := analysis.DiffAnalyses(results[0], results[1], flagChangeThreshold)
+
+        nodeRecords := printer.NewTable(printer.Columns("change", "node"))
+        for _, n := range diff.NodesAdded {
+            nodeRecords.AddRow("Added", n)
+        }
+        for _, n := range diff.NodesRemoved {
+            nodeRecords.AddRow("Removed", n)
+        }
+        wasteRecords := printer.NewTable(printer.Columns("old_cpu_waste_pct", "new_cpu_waste_pct", "old_memory_waste_pct", "new_memory_waste_pct"))
+        wasteText := "Unavailable: usage is missing from a snapshot"
+        if w := diff.Waste; w != nil {
+            wasteRecords.AddRow(decimal(w.OldCPU), decimal(w.NewCPU), decimal(w.OldMem), decimal(w.NewMem))
+            wasteText = fmt.Sprintf("CPU waste%%: %.1f → %.1f  MEM waste%%: %.1f → %.1f", w.OldCPU, w.NewCPU, w.OldMem, w.NewMem)
+        }
+
+        deployments := printer.NewTable(
+            printer.Columns("NAMESPACE", "DEPLOYMENT", "STATUS", "CPU REQ(m)", "CPU USE(m)", "MEM REQ(Mi)", "MEM USE(Mi)", "WASTE% CPU", "WASTE% MEM"),
+            printer.WideColumns("CHANGE% (CPU REQ/USE)", "CHANGE% (MEM REQ/USE)"),
+        )
+        deploymentRecords := printer.NewTable(printer.Columns(
+            "namespace", "deployment", "status",
+            "old_cpu_requested_m", "new_cpu_requested_m", "old_cpu_used_m", "new_cpu_used_m",
+            "old_memory_requested_mi", "new_memory_requested_mi", "old_memory_used_mi", "new_memory_used_mi",
+            "old_cpu_waste_pct", "new_cpu_waste_pct", "old_memory_waste_pct", "new_memory_waste_pct",
+            "cpu_requested_change_pct", "cpu_used_change_pct", "memory_requested_change_pct", "memory_used_change_pct",
+        ))
+        for _, d := range diff.Deployments {
+            deploymentRecords.AddRow(
+                d.Namespace, d.Name, d.Status,
+                d.Old.CPUReqMilli, d.New.CPUReqMilli, d.Old.CPUUsedMilli, d.New.CPUUsedMilli,
+                d.Old.MemReqMi, d.New.MemReqMi, d.Old.MemUsedMi, d.New.MemUsedMi,
+                decimal(d.Old.WasteCPU), decimal(d.New.WasteCPU), decimal(d.Old.WasteMem), decimal(d.New.WasteMem),
+                decimal(d.CPUReqChange), decimal(d.CPUUsedChange), decimal(d.MemReqChange), decimal(d.MemUsedChange),
+            )
+            deployments.AddRow(
+                d.Namespace, d.Name, d.Status,
+                fmt.Sprintf("%d → %d", d.Old.CPUReqMilli, d.New.CPUReqMilli),
+                fmt.Sprintf("%d → %d", d.Old.CPUUsedMilli, d.New.CPUUsedMilli),
+                fmt.Sprintf("%d → %d", d.Old.MemReqMi, d.New.MemReqMi),
+                fmt.Sprintf("%d → %d", d.Old.MemUsedMi, d.New.MemUsedMi),
+                fmt.Sprintf("%.1f → %.1f", d.Old.WasteCPU, d.New.WasteCPU),
+                fmt.Sprintf("%.1f → %.1f", d.Old.WasteMem, d.New.WasteMem),
+                fmt.Sprintf("%.1f / %.1f", d.CPUReqChange, d.CPUUsedChange),
+                fmt.Sprintf("%.1f / %.1f", d.MemReqChange, d.MemUsedChange),
+            )
+        }
+
+        recs := printer.NewTable(
+            printer.Columns("CHANGE", "TYPE", "DETAILS", "SUGGESTION"),
+            printer.WideColumns("SEVERITY"),
+        )
+        recRecords := printer.NewTable(printer.Columns("change", "type", "details", "severity", "suggestion"))
+        for _, r := range diff.RecommendationsAppeared {
+            recs.AddRow("Appeared", r.Type, r.Details, r.Suggestion, r.Severity)
+            recRecords.AddRow("Appeared", r.Type, r.Details, r.Severity, r.Suggestion)
+        }
+        for _, r := range diff.RecommendationsResolved {
+            recs.AddRow("Resolved", r.Type, r.Details, r.Suggestion, r.Severity)
+            recRecords.AddRow("Resolved", r.Type, r.Details, r.Severity, r.Suggestion)
+        }
+
+        printDocument(out, printer.Document{
+            Kind:    "Diff",
+            Cluster: output.Cluster{Snapshot: args[1], CapturedAt: &captured[1], Namespace: flagNamespace},
+            Items:   diff,
+            Sections: []printer.Section{
+                {Text: []string{fmt.Sprintf("Comparing %s (%s) → %s (%s)", args[0], captured[0].Format(time.RFC3339), args[1], captured[1].Format(time.RFC3339))}},
+                {Title: "Nodes", Text: []string{
+                    fmt.Sprintf("Added (%d): %s", len(diff.NodesAdded), strings.Join(diff.NodesAdded, ", ")),
+                    fmt.Sprintf("Removed (%d): %s", len(diff.NodesRemoved), strings.Join(diff.NodesRemoved, ", ")),
+                    fmt.Sprintf("Pods added: %d  Pods removed: %d", len(diff.PodsAdded), len(diff.PodsRemoved)),
+                }, Records: nodeRecords},
+                {Title: "Waste Trend", Text: []string{wasteText}, Records: wasteRecords},
+                {Title: fmt.Sprintf("Deployments (changes ≥ %.0f%%)", flagChangeThreshold), Table: deployments, Records: deploymentRecords},
+                {Title: "Recommendations", Table: recs, Records: recRecords},
+            },
+        })
+    },
+}
+
+func init() {
+    diffCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "", "Namespace")
+    addOutputFlag(diffCmd, "table")
+    addPolicyFlags(diffCmd)
+    addDaemonSetFlag(diffCmd)
+    diffCmd.Flags().Float64Var(&flagPercentile, "percentile", 95, "Usage percentile to analyze: 50, 95, 99 or 100 (max)")
+    diffCmd.Flags().Float64Var(&flagChangeThreshold, "change-threshold", 10.0, "Report deployments whose requests or usage changed by at least this percentage")
+}
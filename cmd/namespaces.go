@@ -0,0 +1,167 @@
+package cmd
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/spf13/cobra"
+    "kcap/pkg/analysis"
+    "kcap/pkg/printer"
+    "kcap/pkg/usage"
+)
+
+var namespacesCmd = &cobra.Command{
+    Use:   "namespaces",
+    Short: "Chargeback per namespace or team: requested vs used resources, share of the cluster, waste and quota consumption",
+    Run: func(cmd *cobra.Command, args []string) {
+        out := newPrinter(cmd)
+        ctx, cancel := commandContext(30 * time.Second)
+        defer cancel()
+
+        pol, err := loadPolicy(cmd)
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+
+        source, provider, err := newClusterSource()
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+
+        nodes, err := source.ListNodes(ctx)
+        if err != nil {
+            fmt.Println("Error listing nodes:", err)
+            os.Exit(1)
+        }
+        allPods, pods, err := listPods(ctx, source, flagNamespace)
+        if err != nil {
+            fmt.Println("Error listing pods:", err)
+            os.Exit(1)
+        }
+        quotas, err := source.ListResourceQuotas(ctx, flagNamespace)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "Warning: ResourceQuotas not available, quota consumption is omitted:", err)
+        }
+
+        podUsage, err := provider.PodUsage(ctx, flagNamespace)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "Warning: Usage metrics not available, usage values will be zero:", err)
+        }
+        podRecords := filterDaemonSets(analysis.PodRecords(analysis.ActivePods(pods), usage.Select(podUsage, flagPercentile), nil, "", workloadAnnotations(ctx, source, flagNamespace), ownerGraph(ctx, source, flagNamespace)))
+        cluster := analysis.Summarize(analysis.NodeStats(nodes, nil, allPods, pol))
+
+        var groups map[string]string
+        if flagGroupLabel != "" {
+            namespaces, err := source.ListNamespaces(ctx)
+            if err != nil {
+                fmt.Println("Error listing namespaces:", err)
+                os.Exit(1)
+            }
+            groups = make(map[string]string, len(namespaces))
+            for _, ns := range namespaces {
+                groups[ns.Name] = ns.Labels[flagGroupLabel]
+            }
+        }
+        stats := analysis.NamespaceAggregation(podRecords, quotas, cluster, groups)
+
+        columns := printer.Columns("NAMESPACE")
+        if flagGroupLabel != "" {
+            columns = printer.Columns(strings.ToUpper(flagGroupLabel), "NAMESPACES")
+        }
+        t := printer.NewTable(
+            columns,
+            printer.Columns("PODS", "CPU(REQ/USE m)", "MEM(REQ/USE Mi)", "SHARE% (CPU/MEM)", "WASTE% (CPU/MEM)", "QUOTA CPU(USED/HARD m)", "QUOTA MEM(USED/HARD Mi)"),
+            printer.WideColumns("WASTE(CPU m/MEM Mi)"),
+        )
+        for _, s := range stats {
+            row := []interface{}{groupName(s.Name)}
+            if flagGroupLabel != "" {
+                row = append(row, strings.Join(s.Namespaces, ", "))
+            }
+            row = append(row,
+                s.PodCount,
+                fmt.Sprintf("%d / %d", s.CPUReqMilli, s.CPUUsedMilli),
+                fmt.Sprintf("%d / %d", s.MemReqMi, s.MemUsedMi),
+                fmt.Sprintf("%.1f / %.1f", s.CPUShare, s.MemShare),
+                fmt.Sprintf("%.1f / %.1f", s.WasteCPU, s.WasteMem),
+                formatQuota(s.QuotaCPUUsedMilli, s.QuotaCPUHardMilli),
+                formatQuota(s.QuotaMemUsedMi, s.QuotaMemHardMi),
+                fmt.Sprintf("%d / %d", s.CPUWasteMilli, s.MemWasteMi),
+            )
+            t.AddRow(row...)
+        }
+        printDocument(out, printer.Document{
+            Kind:     "NamespaceList",
+            Cluster:  clusterInfo(source),
+            Items:    stats,
+            Sections: []printer.Section{{Table: t, Records: namespaceRecords(stats)}},
+        })
+    },
+}
+
+// groupName renders a namespace or label value, with "<none>" for pods in
+// namespaces without the group label.
+func groupName(name string) string {
+    if name == "" {
+        return "<none>"
+    }
+    return name
+}
+
+// formatQuota renders quota consumption, e.g. "1500 / 4000", or "-" without a quota.
+func formatQuota(used, hard int64) string {
+    if hard == 0 {
+        return "-"
+    }
+    return fmt.Sprintf("%d / %d", used, hard)
+}
+
+// namespaceRecords lists the stats with unformatted numbers for csv and tsv
+// output.
+func namespaceRecords(stats []analysis.NamespaceStat) *printer.Table {
+    name := "namespace"
+    if flagGroupLabel != "" {
+        name = flagGroupLabel
+    }
+    t := printer.NewTable(printer.Columns(
+        name, "namespaces", "pods",
+        "cpu_requested_m", "cpu_used_m", "memory_requested_mi", "memory_used_mi",
+        "cpu_share_pct", "memory_share_pct", "cpu_waste_m", "memory_waste_mi", "cpu_waste_pct", "memory_waste_pct",
+        "quota_cpu_hard_m", "quota_cpu_used_m", "quota_memory_hard_mi", "quota_memory_used_mi",
+    ))
+    for _, s := range stats {
+        cpuHard, cpuUsed := quotaRecord(s.QuotaCPUHardMilli, s.QuotaCPUUsedMilli)
+        memHard, memUsed := quotaRecord(s.QuotaMemHardMi, s.QuotaMemUsedMi)
+        t.AddRow(
+            groupName(s.Name), strings.Join(s.Namespaces, ";"), s.PodCount,
+            s.CPUReqMilli, s.CPUUsedMilli, s.MemReqMi, s.MemUsedMi,
+            decimal(s.CPUShare), decimal(s.MemShare), s.CPUWasteMilli, s.MemWasteMi, decimal(s.WasteCPU), decimal(s.WasteMem),
+            cpuHard, cpuUsed, memHard, memUsed,
+        )
+    }
+    return t
+}
+
+// quotaRecord returns the hard and used cells of a quota, both empty without
+// a quota.
+func quotaRecord(hard, used int64) (string, string) {
+    if hard == 0 {
+        return "", ""
+    }
+    return strconv.FormatInt(hard, 10), strconv.FormatInt(used, 10)
+}
+
+func init() {
+    namespacesCmd.Flags().StringVar(&flagKubeconfig, "kubeconfig", "", "Path to kubeconfig file")
+    namespacesCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "", "Namespace")
+    addOutputFlag(namespacesCmd, "table")
+    addFormatAlias(namespacesCmd, "csv")
+    namespacesCmd.Flags().StringVar(&flagGroupLabel, "group-by-label", "", "Group namespaces by the value of this namespace label, e.g. team or cost-center")
+    addDaemonSetFlag(namespacesCmd)
+    addUsageFlags(namespacesCmd)
+}
@@ -1,75 +1,185 @@
 package cmd
 
 import (
-    "context"
     "fmt"
     "os"
     "sort"
     "strconv"
+    "strings"
     "time"
 
     "github.com/spf13/cobra"
-    "github.com/jedib0t/go-pretty/v6/table"
     "kcap/pkg/analysis"
-    "kcap/pkg/k8s"
+    "kcap/pkg/printer"
+    "kcap/pkg/usage"
 )
 
 var nodesCmd = &cobra.Command{
     Use:   "nodes",
     Short: "Show per-node allocatable, requested and usage summary",
+    Args:  cobra.NoArgs,
     Run: func(cmd *cobra.Command, args []string) {
-        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+        out := newPrinter(cmd)
+        ctx, cancel := commandContext(30 * time.Second)
         defer cancel()
 
-        kube, err := k8s.NewK8sClientWithConfig(flagKubeconfig)
+        pol, err := loadPolicy(cmd)
         if err != nil {
-            fmt.Println("Error creating kube client:", err)
+            fmt.Println("Error:", err)
             os.Exit(1)
         }
 
-        nodes, err := kube.ListNodes(ctx)
+        source, provider, err := newClusterSource()
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+
+        nodes, err := source.ListNodes(ctx)
         if err != nil {
             fmt.Println("Error listing nodes:", err)
             os.Exit(1)
         }
 
-        nodeMetrics, err := kube.NodeMetrics(ctx)
+        nodeUsage, err := provider.NodeUsage(ctx)
         if err != nil {
-            fmt.Println("Warning: Metrics-server not available, usage values will be zero")
-            nodeMetrics = nil
+            fmt.Fprintln(os.Stderr, "Warning: Usage metrics not available, usage values will be zero:", err)
         }
+        nodeMetrics := usage.Select(nodeUsage, flagPercentile)
 
-        pods, err := kube.ListPods(ctx, flagNamespace)
+        // Node figures count the pods of every namespace.
+        pods, _, err := listPods(ctx, source, flagNamespace)
         if err != nil {
             fmt.Println("Error listing pods:", err)
             os.Exit(1)
         }
 
-        stats := analysis.NodeStats(nodes, nodeMetrics, pods)
+        stats := analysis.NodeStats(nodes, nodeMetrics, pods, pol)
         sort.Slice(stats, func(i, j int) bool {
             return stats[i].Name < stats[j].Name
         })
 
-        if flagJSON {
-            printJSON(stats)
+        if flagGroupBy != "" {
+            pdbs, err := source.ListPDBs(ctx, "")
+            if err != nil {
+                fmt.Fprintln(os.Stderr, "Warning: PodDisruptionBudgets not available, drain risk ignores them:", err)
+            }
+            candidates := analysis.ScaleInCandidates(stats, pol)
+            sim := analysis.SimulateScaleIn(nodes, pods, candidates)
+            pools := analysis.PoolAggregation(stats, poolLabels(), sim, analysis.AssessDrains(candidates, pods, pdbs))
+            printDocument(out, printer.Document{
+                Kind:     "PoolList",
+                Cluster:  clusterInfo(source),
+                Items:    pools,
+                Sections: []printer.Section{poolSection(pools)},
+            })
             return
         }
 
-        t := table.NewWriter()
-        t.SetOutputMirror(os.Stdout)
-        t.AppendHeader(table.Row{"NODE", "CPU(Alloc/Req/Use m)", "MEM(Alloc/Req/Use Mi)", "WORKLOADPODS", "STATUS"})
-
+        t := printer.NewTable(
+            printer.Columns("NODE", "CPU(Alloc/Req/Use m)", "MEM(Alloc/Req/Use Mi)", "LIMITS% (CPU/MEM)", "SYSTEM% (CPU/MEM)", "WORKLOADPODS", "STATUS"),
+            printer.WideColumns("CAPACITY(CPU m/MEM Mi)", "LIMITS(CPU m/MEM Mi)", "SYSTEM(CPU m/MEM Mi)"),
+        )
         for _, s := range stats {
             cpuField := fmt.Sprintf("%d / %d / %d", s.CPUAllocMilli, s.CPUReqMilli, s.CPUUsedMilli)
             memField := fmt.Sprintf("%d / %d / %d", s.MemAllocMi, s.MemReqMi, s.MemUsedMi)
-            t.AppendRow(table.Row{s.Name, cpuField, memField, strconv.Itoa(s.UserPodCount), s.Status})
+            limitField := fmt.Sprintf("%.0f / %.0f", s.CPULimitOvercommit, s.MemLimitOvercommit)
+            systemField := fmt.Sprintf("%.0f / %.0f", s.SystemCPUPercent, s.SystemMemPercent)
+            t.AddRow(s.Name, cpuField, memField, limitField, systemField, strconv.Itoa(s.UserPodCount), s.Status,
+                fmt.Sprintf("%d / %d", s.CPUCapacityMilli, s.MemCapacityMi),
+                fmt.Sprintf("%d / %d", s.CPULimitMilli, s.MemLimitMi),
+                fmt.Sprintf("%d / %d", s.SystemCPUMilli, s.SystemMemMi),
+            )
         }
-        t.Render()
+        printDocument(out, printer.Document{
+            Kind:     "NodeList",
+            Cluster:  clusterInfo(source),
+            Items:    stats,
+            Sections: []printer.Section{{Table: t, Records: nodeRecords(stats)}},
+        })
     },
 }
 
+// nodeRecords lists the node stats with unformatted numbers for csv and tsv
+// output.
+func nodeRecords(stats []analysis.NodeStat) *printer.Table {
+    t := printer.NewTable(printer.Columns(
+        "node", "status", "workload_pods",
+        "cpu_capacity_m", "cpu_allocatable_m", "cpu_requested_m", "cpu_used_m", "cpu_limits_m",
+        "memory_capacity_mi", "memory_allocatable_mi", "memory_requested_mi", "memory_used_mi", "memory_limits_mi",
+        "cpu_limits_pct", "memory_limits_pct", "system_cpu_m", "system_memory_mi", "system_cpu_pct", "system_memory_pct",
+    ))
+    for _, s := range stats {
+        t.AddRow(
+            s.Name, s.Status, s.UserPodCount,
+            s.CPUCapacityMilli, s.CPUAllocMilli, s.CPUReqMilli, s.CPUUsedMilli, s.CPULimitMilli,
+            s.MemCapacityMi, s.MemAllocMi, s.MemReqMi, s.MemUsedMi, s.MemLimitMi,
+            decimal(s.CPULimitOvercommit), decimal(s.MemLimitOvercommit), s.SystemCPUMilli, s.SystemMemMi, decimal(s.SystemCPUPercent), decimal(s.SystemMemPercent),
+        )
+    }
+    return t
+}
+
+// poolLabels returns the labels given by --group-by, or the default pool
+// labels for --group-by=auto.
+func poolLabels() []string {
+    if flagGroupBy == "auto" {
+        return analysis.DefaultPoolLabels
+    }
+    return strings.Split(flagGroupBy, ",")
+}
+
+// poolSection lists pool totals and utilization, followed by the pools'
+// scale-in suggestions.
+func poolSection(pools []analysis.PoolStat) printer.Section {
+    t := printer.NewTable(printer.Columns("LABEL", "POOL", "NODES", "CPU(Alloc/Req/Use m)", "MEM(Alloc/Req/Use Mi)", "REQ% (CPU/MEM)", "USE% (CPU/MEM)", "REMOVABLE"))
+    var suggestions []string
+    for _, p := range pools {
+        removable := "-"
+        if len(p.Removable) > 0 {
+            removable = fmt.Sprintf("%d of %d (%s)", len(p.Removable), len(p.Nodes), strings.Join(p.Removable, ", "))
+        }
+        t.AddRow(
+            p.Label, p.DisplayName(), len(p.Nodes),
+            fmt.Sprintf("%d / %d / %d", p.CPUAllocMilli, p.CPUReqMilli, p.CPUUsedMilli),
+            fmt.Sprintf("%d / %d / %d", p.MemAllocMi, p.MemReqMi, p.MemUsedMi),
+            fmt.Sprintf("%.0f / %.0f", p.CPUReqPercent, p.MemReqPercent),
+            fmt.Sprintf("%.0f / %.0f", p.CPUUsePercent, p.MemUsePercent),
+            removable,
+        )
+        if p.Suggestion != "" {
+            suggestions = append(suggestions, p.Suggestion)
+        }
+    }
+    return printer.Section{Table: t, Notes: suggestions, Records: poolRecords(pools)}
+}
+
+// poolRecords lists the pool stats with unformatted numbers for csv and tsv
+// output.
+func poolRecords(pools []analysis.PoolStat) *printer.Table {
+    t := printer.NewTable(printer.Columns(
+        "label", "pool", "nodes",
+        "cpu_allocatable_m", "cpu_requested_m", "cpu_used_m", "memory_allocatable_mi", "memory_requested_mi", "memory_used_mi",
+        "cpu_requested_pct", "memory_requested_pct", "cpu_used_pct", "memory_used_pct",
+        "removable", "removable_nodes",
+    ))
+    for _, p := range pools {
+        t.AddRow(
+            p.Label, p.DisplayName(), len(p.Nodes),
+            p.CPUAllocMilli, p.CPUReqMilli, p.CPUUsedMilli, p.MemAllocMi, p.MemReqMi, p.MemUsedMi,
+            decimal(p.CPUReqPercent), decimal(p.MemReqPercent), decimal(p.CPUUsePercent), decimal(p.MemUsePercent),
+            len(p.Removable), strings.Join(p.Removable, ";"),
+        )
+    }
+    return t
+}
+
 func init() {
     nodesCmd.Flags().StringVar(&flagKubeconfig, "kubeconfig", "", "Path to kubeconfig file")
-    nodesCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "", "Namespace")
-    nodesCmd.Flags().BoolVar(&flagJSON, "json", false, "Print output as JSON")
+    nodesCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "", "Namespace whose pods are counted if the pods of every namespace cannot be listed")
+    addOutputFlag(nodesCmd, "table")
+    nodesCmd.Flags().StringVar(&flagGroupBy, "group-by", "", "Group nodes into pools by these comma-separated labels, the first a node carries; without a value, the common node pool, instance type and zone labels")
+    nodesCmd.Flags().Lookup("group-by").NoOptDefVal = "auto"
+    addScaleInFlags(nodesCmd)
+    addUsageFlags(nodesCmd)
 }
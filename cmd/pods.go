@@ -1,57 +1,53 @@
 package cmd
 
 import (
-    "context"
     "fmt"
     "os"
     "strconv"
     "time"
 
     "github.com/spf13/cobra"
-    "github.com/jedib0t/go-pretty/v6/table"
     "kcap/pkg/analysis"
-    "kcap/pkg/k8s"
+    "kcap/pkg/printer"
+    "kcap/pkg/usage"
 )
 
 var podsCmd = &cobra.Command{
     Use:   "pods",
     Short: "Show pods request vs usage. Use --namespace to limit.",
     Run: func(cmd *cobra.Command, args []string) {
-        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+        out := newPrinter(cmd)
+        ctx, cancel := commandContext(30 * time.Second)
         defer cancel()
 
-        kube, err := k8s.NewK8sClientWithConfig(flagKubeconfig)
+        source, provider, err := newClusterSource()
         if err != nil {
-            fmt.Println("Error creating kube client:", err)
+            fmt.Println("Error:", err)
             os.Exit(1)
         }
 
-        pods, err := kube.ListPods(ctx, flagNamespace)
+        pods, err := source.ListPods(ctx, flagNamespace)
         if err != nil {
             fmt.Println("Error listing pods:", err)
             os.Exit(1)
         }
 
-        podMetrics, err := kube.PodMetrics(ctx, flagNamespace)
+        podUsage, containerUsage, err := usage.PodAndContainerUsage(ctx, provider, flagNamespace)
         if err != nil {
-            fmt.Println("Warning: Metrics-server not available, usage values will be zero")
-            podMetrics = nil
+            fmt.Fprintln(os.Stderr, "Warning: Usage metrics not available, usage values will be zero:", err)
         }
+        podMetrics := usage.Select(podUsage, flagPercentile)
+        containerMetrics := usage.SelectContainers(containerUsage, flagPercentile)
 
-        list := analysis.PodRecords(pods, podMetrics, "")
-
-        if flagJSON {
-            printJSON(list)
-            return
-        }
-
-        t := table.NewWriter()
-        t.SetOutputMirror(os.Stdout)
-        t.AppendHeader(table.Row{
-            "NAMESPACE", "POD", "NODE", "CPU(REQ/USE M)",
-            "MEM(REQ/USE MI)", "OWNER", "DAEMONSET", "WASTE% (CPU)", "WASTE% (MEM)",
-        })
+        list := filterDaemonSets(analysis.PodRecords(pods, podMetrics, containerMetrics, "", workloadAnnotations(ctx, source, flagNamespace), ownerGraph(ctx, source, flagNamespace)))
 
+        t := printer.NewTable(
+            printer.Columns(
+                "NAMESPACE", "POD", "NODE", "CPU(REQ/USE M)",
+                "MEM(REQ/USE MI)", "LIMIT(CPU M/MEM MI)", "WORKLOAD", "DAEMONSET", "WASTE% (CPU)", "WASTE% (MEM)",
+            ),
+            printer.WideColumns("CONTAINERS", "IGNORED BY"),
+        )
         for _, p := range list {
             cpu := fmt.Sprintf("%d / %d", p.CPUReqMilli, p.CPUUsedMilli)
             mem := fmt.Sprintf("%d / %d", p.MemReqMi, p.MemUsedMi)
@@ -64,19 +60,48 @@ var podsCmd = &cobra.Command{
             if p.MemReqMi > 0 {
                 memWaste = fmt.Sprintf("%.1f", (1.0 - float64(p.MemUsedMi)/float64(p.MemReqMi))*100.0)
             }
+            ignoredBy := "-"
+            if p.Ignored {
+                ignoredBy = p.IgnoredBy
+            }
 
-            t.AppendRow(table.Row{
+            t.AddRow(
                 p.Namespace, p.Name, p.NodeName,
-                cpu, mem, p.Owner, strconv.FormatBool(p.IsDaemonSet),
-                cpuWaste, memWaste,
-            })
+                cpu, mem, formatLimits(p), p.WorkloadKind+"/"+p.WorkloadName, strconv.FormatBool(p.IsDaemonSet),
+                cpuWaste, memWaste, len(p.Containers), ignoredBy,
+            )
         }
-        t.Render()
+        printDocument(out, printer.Document{
+            Kind:     "PodList",
+            Cluster:  clusterInfo(source),
+            Items:    list,
+            Sections: []printer.Section{{Table: t, Records: podListRecords(list)}},
+        })
     },
 }
 
+// podListRecords lists the pods with unformatted numbers for csv and tsv
+// output; limits are 0 when unset.
+func podListRecords(pods []analysis.PodRecord) *printer.Table {
+    t := printer.NewTable(printer.Columns(
+        "namespace", "pod", "node", "workload_kind", "workload_name", "daemonset", "containers",
+        "cpu_requested_m", "cpu_used_m", "cpu_limit_m", "memory_requested_mi", "memory_used_mi", "memory_limit_mi",
+        "cpu_waste_pct", "memory_waste_pct", "ignored_by",
+    ))
+    for _, p := range pods {
+        t.AddRow(
+            p.Namespace, p.Name, p.NodeName, p.WorkloadKind, p.WorkloadName, p.IsDaemonSet, len(p.Containers),
+            p.CPUReqMilli, p.CPUUsedMilli, p.CPULimitMilli, p.MemReqMi, p.MemUsedMi, p.MemLimitMi,
+            wastePercent(p.CPUReqMilli, p.CPUUsedMilli), wastePercent(p.MemReqMi, p.MemUsedMi), p.IgnoredBy,
+        )
+    }
+    return t
+}
+
 func init() {
     podsCmd.Flags().StringVar(&flagKubeconfig, "kubeconfig", "", "Path to kubeconfig file")
     podsCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "", "Namespace")
-    podsCmd.Flags().BoolVar(&flagJSON, "json", false, "Print output as JSON")
+    addOutputFlag(podsCmd, "table")
+    addDaemonSetFlag(podsCmd)
+    addUsageFlags(podsCmd)
 }
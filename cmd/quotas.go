@@ -0,0 +1,120 @@
+package cmd
+
+import (
+    "fmt"
+    "os"
+    "strconv"
+    "time"
+
+    "github.com/spf13/cobra"
+    "kcap/pkg/analysis"
+    "kcap/pkg/output"
+    "kcap/pkg/printer"
+    "kcap/pkg/usage"
+)
+
+var quotasCmd = &cobra.Command{
+    Use:   "quotas",
+    Short: "ResourceQuota hard vs used vs actual usage, and LimitRange defaults causing over-requesting",
+    Run: func(cmd *cobra.Command, args []string) {
+        out := newPrinter(cmd)
+        ctx, cancel := commandContext(30 * time.Second)
+        defer cancel()
+
+        pol, err := loadPolicy(cmd)
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+
+        source, provider, err := newClusterSource()
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+
+        quotas, err := source.ListResourceQuotas(ctx, flagNamespace)
+        if err != nil {
+            fmt.Println("Error listing resource quotas:", err)
+            os.Exit(1)
+        }
+        limitRanges, err := source.ListLimitRanges(ctx, flagNamespace)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "Warning: LimitRanges not available, their defaults are not analyzed:", err)
+        }
+        pods, err := source.ListPods(ctx, flagNamespace)
+        if err != nil {
+            fmt.Println("Error listing pods:", err)
+            os.Exit(1)
+        }
+
+        podUsage, containerUsage, usageErr := usage.PodAndContainerUsage(ctx, provider, flagNamespace)
+        if usageErr != nil {
+            fmt.Fprintln(os.Stderr, "Warning: Usage metrics not available, actual usage and LimitRange defaults are not analyzed:", usageErr)
+        }
+        // Quotas count every pod in the namespace, DaemonSet pods included.
+        podRecords := analysis.PodRecords(pods, usage.Select(podUsage, flagPercentile), usage.SelectContainers(containerUsage, flagPercentile), "", workloadAnnotations(ctx, source, flagNamespace), ownerGraph(ctx, source, flagNamespace))
+
+        report := output.QuotaReport{
+            Quotas: analysis.QuotaUsages(quotas, podRecords, usageErr == nil),
+        }
+        // Idle defaults can only be told apart with usage.
+        if usageErr == nil {
+            report.LimitRangeDefaults = analysis.LimitRangeDefaults(limitRanges, podRecords, pol)
+        }
+
+        t := printer.NewTable(printer.Columns("NAMESPACE", "QUOTA", "RESOURCE", "HARD", "USED", "ACTUAL", "USED%", "ACTUAL%", "STATUS"))
+        quotaRecords := printer.NewTable(printer.Columns("namespace", "quota", "resource", "unit", "hard", "used", "actual", "used_pct", "actual_pct", "status"))
+        for _, q := range report.Quotas {
+            var actualRecord, actualPctRecord string
+            if q.HasActual {
+                actualRecord, actualPctRecord = strconv.FormatInt(q.Actual, 10), decimal(q.ActualPercent)
+            }
+            quotaRecords.AddRow(q.Namespace, q.Quota, q.Resource, q.Unit, q.Hard, q.Used, actualRecord, decimal(q.UsedPercent), actualPctRecord, q.Status)
+
+            actual, actualPct := "-", "-"
+            if q.HasActual {
+                actual = fmt.Sprintf("%d%s", q.Actual, q.Unit)
+                actualPct = fmt.Sprintf("%.1f", q.ActualPercent)
+            }
+            t.AddRow(
+                q.Namespace, q.Quota, q.Resource,
+                fmt.Sprintf("%d%s", q.Hard, q.Unit), fmt.Sprintf("%d%s", q.Used, q.Unit), actual,
+                fmt.Sprintf("%.1f", q.UsedPercent), actualPct, q.Status,
+            )
+        }
+
+        t2 := printer.NewTable(printer.Columns("NAMESPACE", "LIMITRANGE", "RESOURCE", "DEFAULT → PROPOSED", "CONTAINERS AT DEFAULT", "IDLE", "MAX USAGE"))
+        defaultRecords := printer.NewTable(printer.Columns("namespace", "limitrange", "resource", "unit", "default", "proposed", "containers_at_default", "idle", "max_usage"))
+        for _, d := range report.LimitRangeDefaults {
+            unit := "m"
+            if d.Resource == "memory" {
+                unit = "Mi"
+            }
+            defaultRecords.AddRow(d.Namespace, d.LimitRange, d.Resource, unit, d.Default, d.Proposed, d.Containers, d.Idle, d.MaxUsage)
+            t2.AddRow(
+                d.Namespace, d.LimitRange, d.Resource,
+                fmt.Sprintf("%d%s → %d%s", d.Default, unit, d.Proposed, unit),
+                d.Containers, d.Idle, fmt.Sprintf("%d%s", d.MaxUsage, unit),
+            )
+        }
+
+        printDocument(out, printer.Document{
+            Kind:    "QuotaReport",
+            Cluster: clusterInfo(source),
+            Items:   report,
+            Sections: []printer.Section{
+                {Title: "Resource Quotas", Table: t, Records: quotaRecords},
+                {Title: "LimitRange defaults causing over-requesting", Table: t2, Records: defaultRecords},
+            },
+        })
+    },
+}
+
+func init() {
+    quotasCmd.Flags().StringVar(&flagKubeconfig, "kubeconfig", "", "Path to kubeconfig file")
+    quotasCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "", "Namespace")
+    addOutputFlag(quotasCmd, "table")
+    addPolicyFlags(quotasCmd)
+    addUsageFlags(quotasCmd)
+}
@@ -4,74 +4,215 @@ import (
     "context"
     "fmt"
     "os"
+    "strconv"
+    "strings"
     "time"
 
     "github.com/spf13/cobra"
-    "github.com/jedib0t/go-pretty/v6/table"
     "kcap/pkg/analysis"
     "kcap/pkg/k8s"
+    "kcap/pkg/output"
+    "kcap/pkg/patch"
+    "kcap/pkg/printer"
 )
 
 var recommendCmd = &cobra.Command{
     Use:   "recommend",
     Short: "Provide actionable recommendations for nodes and pods",
     Run: func(cmd *cobra.Command, args []string) {
-        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-        defer cancel()
-
-        kube, err := k8s.NewK8sClientWithConfig(flagKubeconfig)
-        if err != nil {
-            fmt.Println("Error creating kube client:", err)
+        out := newPrinter(cmd)
+        if err := validateEmitFlags(); err != nil {
+            fmt.Println("Error:", err)
             os.Exit(1)
         }
+        ctx, cancel := commandContext(30 * time.Second)
+        defer cancel()
 
-        nodes, err := kube.ListNodes(ctx)
+        pol, err := loadPolicy(cmd)
         if err != nil {
-            fmt.Println("Error listing nodes:", err)
+            fmt.Println("Error:", err)
             os.Exit(1)
         }
 
-        nodeMetrics, err := kube.NodeMetrics(ctx)
+        source, provider, err := newClusterSource()
         if err != nil {
-            fmt.Println("Warning: Metrics-server not available, usage values will be zero")
-            nodeMetrics = nil
+            fmt.Println("Error:", err)
+            os.Exit(1)
         }
 
-        pods, err := kube.ListPods(ctx, flagNamespace)
+        result, err := analyze(ctx, source, provider, pol, flagNamespace)
         if err != nil {
-            fmt.Println("Error listing pods:", err)
+            fmt.Println("Error:", err)
             os.Exit(1)
         }
+        recs := result.Recommendations
 
-        podMetrics, _ := kube.PodMetrics(ctx, flagNamespace)
-
-        nodeStats := analysis.NodeStats(nodes, nodeMetrics, pods)
-        podRecords := analysis.PodRecords(pods, podMetrics, "")
-
-        nodeRecs := analysis.RecommendNodes(nodeStats)
-        podRecs := analysis.RecommendPods(podRecords, flagThreshold)
-
-        recs := append(nodeRecs, podRecs...)
-
-        if flagJSON {
-            printJSON(recs)
+        if flagEmit != "table" || flagApply {
+            // Patches derived from zero usage would cut every request to the minimum.
+            if !result.UsageAvailable {
+                fmt.Println("Error: pod and container usage is required to emit or apply patches")
+                os.Exit(1)
+            }
+            patches := patch.Build(result.Pods, recs, pol)
+            if err := emitPatches(ctx, source, patches); err != nil {
+                fmt.Println("Error:", err)
+                os.Exit(1)
+            }
             return
         }
 
-        t := table.NewWriter()
-        t.SetOutputMirror(os.Stdout)
-        t.AppendHeader(table.Row{"TYPE", "DETAILS", "SUGGESTION"})
-
-        for _, r := range recs {
-            t.AppendRow(table.Row{r.Type, r.Details, r.Suggestion})
+        doc := printer.Document{
+            Kind:     "RecommendationList",
+            Cluster:  clusterInfo(source),
+            Items:    recs,
+            Sections: []printer.Section{{Table: recommendationTable(recs), Records: recommendationRecords(recs)}},
         }
-        t.Render()
+        if flagShowIgnored {
+            doc.Kind = "RecommendationReport"
+            doc.Items = output.RecommendationReport{Recommendations: recs, Suppressed: result.Suppressed}
+            doc.Sections = append(doc.Sections, suppressedSection(result.Suppressed))
+        }
+        printDocument(out, doc)
     },
 }
 
+// recommendationTable lists recommendations with their proposed change and
+// savings.
+func recommendationTable(recs []analysis.Recommendation) *printer.Table {
+    t := printer.NewTable(
+        printer.Columns("TYPE", "DETAILS", "CURRENT → PROPOSED", "SAVINGS", "SUGGESTION"),
+        printer.WideColumns("SEVERITY", "DRAIN RISK"),
+    )
+    for _, r := range recs {
+        drain := "-"
+        if r.Drain != nil {
+            drain = r.Drain.Risk
+        }
+        t.AddRow(r.Type, r.Details, analysis.FormatChange(r), analysis.FormatSavings(r), r.Suggestion, r.Severity, drain)
+    }
+    return t
+}
+
+// recommendationRecords lists recommendations with their target and
+// unformatted values for csv and tsv output; values are empty for
+// recommendations that change no resource.
+func recommendationRecords(recs []analysis.Recommendation) *printer.Table {
+    t := printer.NewTable(printer.Columns(
+        "type", "details", "severity", "node", "namespace", "pod", "container",
+        "resource", "current", "usage", "proposed", "savings", "drain_risk", "suggestion",
+    ))
+    for _, r := range recs {
+        drain := ""
+        if r.Drain != nil {
+            drain = r.Drain.Risk
+        }
+        var current, used, proposed, savings string
+        if r.Resource != "" {
+            current = strconv.FormatInt(r.Current, 10)
+            used = strconv.FormatInt(r.Usage, 10)
+            proposed = strconv.FormatInt(r.Proposed, 10)
+            savings = strconv.FormatInt(max(r.Savings, 0), 10)
+        }
+        t.AddRow(
+            r.Type, r.Details, r.Severity, r.Node, r.Namespace, r.Pod, r.Container,
+            r.Resource, current, used, proposed, savings, drain, r.Suggestion,
+        )
+    }
+    return t
+}
+
+// suppressedSection lists the pods that got no recommendations, and why.
+func suppressedSection(pods []analysis.SuppressedPod) printer.Section {
+    t := printer.NewTable(printer.Columns("NAMESPACE", "POD", "REASON"))
+    records := printer.NewTable(printer.Columns("namespace", "pod", "reason"))
+    for _, p := range pods {
+        t.AddRow(p.Namespace, p.Name, p.Reason)
+        records.AddRow(p.Namespace, p.Name, p.Reason)
+    }
+    return printer.Section{Title: "Suppressed", Table: t, Records: records}
+}
+
 func init() {
     recommendCmd.Flags().StringVar(&flagKubeconfig, "kubeconfig", "", "Path to kubeconfig file")
     recommendCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "", "Namespace")
-    recommendCmd.Flags().BoolVar(&flagJSON, "json", false, "Output in JSON format")
-    recommendCmd.Flags().Float64Var(&flagThreshold, "threshold", 80.0, "Waste threshold percentage")
+    addOutputFlag(recommendCmd, "table")
+    addPolicyFlags(recommendCmd)
+    recommendCmd.Flags().BoolVar(&flagShowIgnored, "show-ignored", false, "List pods suppressed by kcap.io/ignore annotations or policy exclusions, and why")
+    recommendCmd.Flags().StringVar(&flagEmit, "emit", "table", "Emit recommendations as: table, patch, kubectl or kustomize")
+    recommendCmd.Flags().StringVar(&flagOutputDir, "output-dir", "kcap-patches", "Directory for --emit=kustomize patch files")
+    recommendCmd.Flags().BoolVar(&flagApply, "apply", false, "Submit the request patches to the cluster")
+    recommendCmd.Flags().StringVar(&flagDryRun, "dry-run", "server", "With --apply: server validates the patches without changing workloads; none applies them")
+    addDaemonSetFlag(recommendCmd)
+    addUsageFlags(recommendCmd)
+}
+
+// validateEmitFlags checks --emit and --dry-run, so typos fail before the
+// cluster is analyzed.
+func validateEmitFlags() error {
+    switch flagEmit {
+    case "table", "patch", "kubectl", "kustomize":
+    default:
+        return fmt.Errorf("unsupported --emit %q (expected table, patch, kubectl or kustomize)", flagEmit)
+    }
+    switch flagDryRun {
+    case "none", "server":
+    default:
+        return fmt.Errorf("unsupported --dry-run %q (expected none or server)", flagDryRun)
+    }
+    return nil
+}
+
+// emitPatches prints, writes or applies workload patches according to the
+// emit flags, which validateEmitFlags has checked.
+func emitPatches(ctx context.Context, source k8s.ClusterReader, patches []patch.WorkloadPatch) error {
+    if len(patches) == 0 {
+        fmt.Println("No Deployment, StatefulSet or DaemonSet requests to change")
+        return nil
+    }
+
+    if flagApply {
+        kube, ok := source.(*k8s.K8sClient)
+        if !ok {
+            return fmt.Errorf("--apply requires a live cluster and cannot be used with --from-snapshot")
+        }
+        dryRun := flagDryRun != "none"
+        for _, p := range patches {
+            data, err := p.StrategicMerge()
+            if err != nil {
+                return err
+            }
+            if err := kube.PatchWorkload(ctx, p.Kind, p.Namespace, p.Name, data, dryRun); err != nil {
+                return fmt.Errorf("patching %s %s/%s: %w", p.Kind, p.Namespace, p.Name, err)
+            }
+            suffix := ""
+            if dryRun {
+                suffix = " (server dry run)"
+            }
+            fmt.Printf("%s %s/%s patched%s\n", strings.ToLower(p.Kind), p.Namespace, p.Name, suffix)
+        }
+        return nil
+    }
+
+    switch flagEmit {
+    case "patch":
+        for _, p := range patches {
+            data, err := p.Manifest()
+            if err != nil {
+                return err
+            }
+            fmt.Printf("---\n%s", data)
+        }
+    case "kubectl":
+        for _, p := range patches {
+            for _, c := range p.KubectlCommands() {
+                fmt.Println(c)
+            }
+        }
+    case "kustomize":
+        if err := patch.WriteKustomize(flagOutputDir, patches); err != nil {
+            return err
+        }
+        fmt.Printf("Wrote %d patch files to %s\n", len(patches), flagOutputDir)
+    }
+    return nil
 }
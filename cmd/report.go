@@ -1,85 +1,105 @@
 package cmd
 
 import (
-    "context"
     "fmt"
     "os"
     "time"
 
     "github.com/spf13/cobra"
-    "github.com/jedib0t/go-pretty/v6/table"
     "kcap/pkg/analysis"
-    "kcap/pkg/k8s"
+    "kcap/pkg/cost"
+    "kcap/pkg/output"
+    "kcap/pkg/printer"
 )
 
 var reportCmd = &cobra.Command{
     Use:   "report",
     Short: "Full cluster summary including nodes, deployments, and recommendations",
     Run: func(cmd *cobra.Command, args []string) {
-        ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+        out := newPrinter(cmd)
+        ctx, cancel := commandContext(60 * time.Second)
         defer cancel()
 
-        kube, err := k8s.NewK8sClientWithConfig(flagKubeconfig)
+        pol, err := loadPolicy(cmd)
         if err != nil {
-            fmt.Println("Error creating kube client:", err)
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+        pricing, err := loadPricing()
+        if err != nil {
+            fmt.Println("Error:", err)
             os.Exit(1)
         }
 
-        nodes, _ := kube.ListNodes(ctx)
-        nodeMetrics, _ := kube.NodeMetrics(ctx)
-        pods, _ := kube.ListPods(ctx, flagNamespace)
-        podMetrics, _ := kube.PodMetrics(ctx, flagNamespace)
+        source, provider, err := newClusterSource()
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
 
-        nodeStats := analysis.NodeStats(nodes, nodeMetrics, pods)
-        podRecords := analysis.PodRecords(pods, podMetrics, "")
-        deployStats := analysis.DeploymentAggregation(podRecords)
-        nodeRecs := analysis.RecommendNodes(nodeStats)
-        podRecs := analysis.RecommendPods(podRecords, flagThreshold)
-        recs := append(nodeRecs, podRecs...)
+        result, err := analyze(ctx, source, provider, pol, flagNamespace)
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+        deployStats := result.Deployments
+        recs := result.Recommendations
+
+        summary := analysis.Summarize(result.Nodes)
+        costs := cost.Compute(result, pricing)
 
-        fmt.Println("Cluster Summary:")
-        var totalCPUAlloc, totalCPUReq, totalCPUUse int64
-        var totalMemAlloc, totalMemReq, totalMemUse int64
-        for _, n := range nodeStats {
-            totalCPUAlloc += n.CPUAllocMilli
-            totalCPUReq += n.CPUReqMilli
-            totalCPUUse += n.CPUUsedMilli
-            totalMemAlloc += n.MemAllocMi
-            totalMemReq += n.MemReqMi
-            totalMemUse += n.MemUsedMi
+        report := output.Report{
+            Summary:         summary,
+            Deployments:     deployStats,
+            Recommendations: recs,
+            DaemonSets:      costs.DaemonSets,
         }
-        fmt.Printf("CPU Alloc(m): %d  CPU Req(m): %d  CPU Used(m): %d\n", totalCPUAlloc, totalCPUReq, totalCPUUse)
-        fmt.Printf("MEM Alloc(Mi): %d  MEM Req(Mi): %d  MEM Used(Mi): %d\n\n", totalMemAlloc, totalMemReq, totalMemUse)
+        if flagShowIgnored {
+            report.Suppressed = result.Suppressed
+        }
+
+        summaryRecords := printer.NewTable(printer.Columns("cpu_allocatable_m", "cpu_requested_m", "cpu_used_m", "memory_allocatable_mi", "memory_requested_mi", "memory_used_mi"))
+        summaryRecords.AddRow(summary.CPUAllocMilli, summary.CPUReqMilli, summary.CPUUsedMilli, summary.MemAllocMi, summary.MemReqMi, summary.MemUsedMi)
 
-        fmt.Println("Top Over-provisioned Deployments:")
-        t := table.NewWriter()
-        t.SetOutputMirror(os.Stdout)
-        t.AppendHeader(table.Row{"DEPLOYMENT", "CPU(req/use m)", "MEM(req/use Mi)", "PODS", "WASTE% CPU"})
+        t := printer.NewTable(printer.Columns("DEPLOYMENT", "CPU(req/use m)", "MEM(req/use Mi)", "PODS", "WASTE% CPU"))
         for _, d := range deployStats {
-            t.AppendRow(table.Row{
+            t.AddRow(
                 d.Name,
                 fmt.Sprintf("%d / %d", d.CPUReqMilli, d.CPUUsedMilli),
                 fmt.Sprintf("%d / %d", d.MemReqMi, d.MemUsedMi),
                 d.PodCount,
                 fmt.Sprintf("%.1f", d.WasteCPU),
-            })
+            )
         }
-        t.Render()
 
-        fmt.Println("\nRecommendations:")
-        t2 := table.NewWriter()
-        t2.SetOutputMirror(os.Stdout)
-        t2.AppendHeader(table.Row{"TYPE", "DETAILS", "SUGGESTION"})
-        for _, r := range recs {
-            t2.AppendRow(table.Row{r.Type, r.Details, r.Suggestion})
+        sections := []printer.Section{
+            {Title: "Cluster Summary", Text: []string{
+                fmt.Sprintf("CPU Alloc(m): %d  CPU Req(m): %d  CPU Used(m): %d", summary.CPUAllocMilli, summary.CPUReqMilli, summary.CPUUsedMilli),
+                fmt.Sprintf("MEM Alloc(Mi): %d  MEM Req(Mi): %d  MEM Used(Mi): %d", summary.MemAllocMi, summary.MemReqMi, summary.MemUsedMi),
+            }, Records: summaryRecords},
+            {Title: "Top Over-provisioned Deployments", Table: t, Records: workloadRecords(deployStats)},
+            {Title: "Costliest DaemonSets (fleet-wide, monthly)", Table: daemonSetCosts(costs), Records: daemonSetCostRecords(costs)},
+            {Title: "Recommendations", Table: recommendationTable(recs), Records: recommendationRecords(recs)},
+        }
+        if flagShowIgnored {
+            sections = append(sections, suppressedSection(result.Suppressed))
         }
-        t2.Render()
+        printDocument(out, printer.Document{
+            Kind:     "Report",
+            Cluster:  clusterInfo(source),
+            Items:    report,
+            Sections: sections,
+        })
     },
 }
 
 func init() {
     reportCmd.Flags().StringVar(&flagKubeconfig, "kubeconfig", "", "Path to kubeconfig file")
     reportCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "", "Namespace")
-    reportCmd.Flags().BoolVar(&flagJSON, "json", false, "Output in JSON format")
-    reportCmd.Flags().Float64Var(&flagThreshold, "threshold", 80.0, "Waste threshold percentage")
+    addOutputFlag(reportCmd, "table")
+    addPolicyFlags(reportCmd)
+    reportCmd.Flags().BoolVar(&flagShowIgnored, "show-ignored", false, "List pods suppressed by kcap.io/ignore annotations or policy exclusions, and why")
+    addDaemonSetFlag(reportCmd)
+    reportCmd.Flags().StringVar(&flagPricing, "pricing", "", "Pricing file used to price DaemonSets (default: blended rates)")
+    addUsageFlags(reportCmd)
 }
@@ -1,19 +1,68 @@
 package cmd
 
 import (
+    "fmt"
+    "os"
+    "time"
+
     "github.com/spf13/cobra"
+    "kcap/pkg/output"
 )
 
 var (
     flagKubeconfig string
     flagNamespace  string
-    flagJSON       bool
     flagThreshold  float64
+    flagHeadroom   float64
+
+    flagEmit      string
+    flagOutputDir string
+    flagApply     bool
+    flagDryRun    string
+
+    flagFromSnapshot string
+    flagSnapshotFile string
+    flagTimeout      time.Duration
+
+    flagOutputVersion string
+
+    flagChangeThreshold float64
+    flagUnderThreshold  float64
+
+    flagPricing string
+
+    flagShowIgnored bool
+
+    flagKinds []string
+
+    flagIncludeDaemonSets bool
+
+    flagGroupLabel string
+
+    flagGroupBy string
+
+    flagListen          string
+    flagRefreshInterval time.Duration
+
+    flagConfig     string
+    flagCPUScaleIn float64
+    flagMemScaleIn float64
+
+    flagMetricsSource string
+    flagPrometheusURL string
+    flagWindow        string
+    flagPercentile    float64
 )
 
 var rootCmd = &cobra.Command{
     Use:   "kcap",
     Short: "Kubernetes Capacity Analyzer CLI",
+    PersistentPreRun: func(cmd *cobra.Command, args []string) {
+        if err := output.ValidateVersion(flagOutputVersion); err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+    },
 }
 
 func Execute() error {
@@ -21,9 +70,24 @@ func Execute() error {
 }
 
 func init() {
+    rootCmd.AddCommand(configCmd)
+    rootCmd.AddCommand(containersCmd)
+    rootCmd.AddCommand(costCmd)
     rootCmd.AddCommand(deploysCmd)
+    rootCmd.AddCommand(diffCmd)
+    rootCmd.AddCommand(namespacesCmd)
     rootCmd.AddCommand(nodesCmd)
     rootCmd.AddCommand(podsCmd)
+    rootCmd.AddCommand(quotasCmd)
     rootCmd.AddCommand(recommendCmd)
     rootCmd.AddCommand(reportCmd)
+    rootCmd.AddCommand(schemaCmd)
+    rootCmd.AddCommand(serveCmd)
+    rootCmd.AddCommand(snapshotCmd)
+    rootCmd.AddCommand(workloadsCmd)
+
+    rootCmd.PersistentFlags().StringVar(&flagConfig, "config", "", "Policy file (default ~/.kcap.yaml)")
+    rootCmd.PersistentFlags().DurationVar(&flagTimeout, "timeout", 0, "Time limit for reading the cluster, e.g. 5m for large clusters (default 30s or 60s depending on the command)")
+    rootCmd.PersistentFlags().StringVar(&flagOutputVersion, "output-version", output.DefaultVersion, "Version of json, yaml, jsonpath and custom-columns output: v1 (versioned envelope) or v0 (unversioned, Go field names)")
+    rootCmd.PersistentFlags().StringVar(&flagFromSnapshot, "from-snapshot", "", "Run from a snapshot file saved by 'kcap snapshot save' instead of a live cluster")
 }
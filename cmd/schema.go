@@ -0,0 +1,27 @@
+package cmd
+
+import (
+    "fmt"
+    "os"
+
+    "github.com/spf13/cobra"
+    "kcap/pkg/output"
+    "kcap/pkg/printer"
+)
+
+var schemaCmd = &cobra.Command{
+    Use:   "schema",
+    Short: "Print the JSON Schema of the versioned JSON output",
+    Run: func(cmd *cobra.Command, args []string) {
+        out := newPrinter(cmd)
+        if flagOutputVersion != output.V1 {
+            fmt.Printf("Error: no schema for output version %s, which is unversioned\n", flagOutputVersion)
+            os.Exit(1)
+        }
+        printDocument(out, printer.Document{Items: output.Schema()})
+    },
+}
+
+func init() {
+    addOutputFlag(schemaCmd, "json")
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "os"
+    "os/signal"
+    "syscall"
+    "time"
+
+    "github.com/spf13/cobra"
+    "kcap/pkg/k8s"
+    "kcap/pkg/server"
+    "kcap/pkg/snapshot"
+)
+
+var serveCmd = &cobra.Command{
+    Use:   "serve",
+    Short: "Serve capacity metrics for Prometheus and a JSON API",
+    Long: `Periodically capture and analyze the cluster, and expose node, workload and
+recommendation metrics in the Prometheus format on /metrics and the analysis
+as JSON on /api/v1/nodes, /pods, /deployments, /recommendations and /report.
+API requests accept namespace, threshold and selector query parameters and
+are answered from the cached cluster view, which is kept current by watches
+on the cluster. /healthz and /readyz serve liveness and readiness probes for
+running kcap in the cluster.`,
+    Run: func(cmd *cobra.Command, args []string) {
+        if flagRefreshInterval <= 0 {
+            fmt.Println("Error: --refresh-interval must be positive")
+            os.Exit(1)
+        }
+
+        pol, err := loadPolicy(cmd)
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+        pricing, err := loadPricing()
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+
+        source, provider, err := newClusterSource()
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+        cluster := clusterInfo(source)
+
+        ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+        defer stop()
+
+        // Serve the cluster objects from informer caches kept current by
+        // watches, instead of listing the whole cluster on every refresh.
+        if kube, ok := source.(*k8s.K8sClient); ok {
+            informed := k8s.NewInformerReader(ctx, kube.Clientset, flagNamespace, 0)
+            if err := informed.Start(ctx, commandTimeout(2*time.Minute)); err != nil {
+                fmt.Println("Error:", err)
+                os.Exit(1)
+            }
+            source = informed
+        }
+
+        capture := func(ctx context.Context) (*snapshot.Snapshot, error) {
+            snap, err := snapshot.Capture(ctx, source, provider, flagNamespace)
+            if err != nil {
+                fmt.Fprintln(os.Stderr, "Warning: Refreshing the cluster view failed:", err)
+                return nil, err
+            }
+            for _, w := range snap.Warnings {
+                fmt.Fprintln(os.Stderr, "Warning: Partial cluster view:", w)
+            }
+            return snap, nil
+        }
+        cache := server.NewCache(capture, analyze, pol, flagRefreshInterval)
+
+        go cache.Run(ctx)
+
+        srv := &http.Server{Addr: flagListen, Handler: server.NewHandler(cache, cluster, pricing)}
+        go func() {
+            <-ctx.Done()
+            shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+            defer cancel()
+            srv.Shutdown(shutdownCtx)
+        }()
+
+        fmt.Printf("Serving metrics and API on %s, refreshing every %s\n", flagListen, flagRefreshInterval)
+        if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+    },
+}
+
+func init() {
+    serveCmd.Flags().StringVar(&flagKubeconfig, "kubeconfig", "", "Path to kubeconfig file")
+    serveCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "", "Namespace")
+    serveCmd.Flags().StringVar(&flagListen, "listen", ":9090", "Address to serve metrics, the API and health endpoints on")
+    serveCmd.Flags().DurationVar(&flagRefreshInterval, "refresh-interval", 5*time.Minute, "How often to recapture and analyze the cluster")
+    addPolicyFlags(serveCmd)
+    serveCmd.Flags().StringVar(&flagPricing, "pricing", "", "Pricing file used to price DaemonSets in /api/v1/report (default: blended rates)")
+    addDaemonSetFlag(serveCmd)
+    addUsageFlags(serveCmd)
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+    "fmt"
+    "os"
+    "time"
+
+    "github.com/spf13/cobra"
+    "kcap/pkg/snapshot"
+)
+
+var snapshotCmd = &cobra.Command{
+    Use:   "snapshot",
+    Short: "Capture cluster state for offline analysis with --from-snapshot",
+}
+
+var snapshotSaveCmd = &cobra.Command{
+    Use:   "save",
+    Short: "Save nodes, pods and their usage metrics to a JSON file",
+    Run: func(cmd *cobra.Command, args []string) {
+        ctx, cancel := commandContext(60 * time.Second)
+        defer cancel()
+
+        source, provider, err := newClusterSource()
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+
+        snap, err := snapshot.Capture(ctx, source, provider, flagNamespace)
+        if err != nil {
+            fmt.Println("Error capturing snapshot:", err)
+            os.Exit(1)
+        }
+        for _, w := range snap.Warnings {
+            fmt.Fprintln(os.Stderr, "Warning: Not captured:", w)
+        }
+
+        if err := snap.Save(flagSnapshotFile); err != nil {
+            fmt.Println("Error writing snapshot:", err)
+            os.Exit(1)
+        }
+        fmt.Printf("Saved %d nodes and %d pods to %s\n", len(snap.Nodes), len(snap.Pods), flagSnapshotFile)
+    },
+}
+
+func init() {
+    snapshotCmd.AddCommand(snapshotSaveCmd)
+
+    snapshotSaveCmd.Flags().StringVar(&flagKubeconfig, "kubeconfig", "", "Path to kubeconfig file")
+    snapshotSaveCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "", "Namespace")
+    snapshotSaveCmd.Flags().StringVarP(&flagSnapshotFile, "file", "f", "kcap-snapshot.json", "Snapshot file to write")
+    // -o selects the output format of every other command.
+    snapshotSaveCmd.Flags().StringVarP(&flagSnapshotFile, "output", "o", "kcap-snapshot.json", "Snapshot file to write")
+    snapshotSaveCmd.Flags().MarkDeprecated("output", "use -f/--file instead")
+    addUsageFlags(snapshotSaveCmd)
+}
@@ -1,12 +1,352 @@
 package cmd
 
 import (
-    "encoding/json"
+    "context"
+    "fmt"
     "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/spf13/cobra"
+    v1 "k8s.io/api/core/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    "kcap/pkg/analysis"
+    "kcap/pkg/k8s"
+    "kcap/pkg/output"
+    "kcap/pkg/policy"
+    "kcap/pkg/printer"
+    "kcap/pkg/snapshot"
+    "kcap/pkg/usage"
 )
 
-func printJSON(v interface{}) error {
-    enc := json.NewEncoder(os.Stdout)
-    enc.SetIndent("", "  ")
-    return enc.Encode(v)
+// addOutputFlag registers -o/--output with the format printed by default,
+// and --json, which predates it, as a hidden alias of -o json.
+func addOutputFlag(c *cobra.Command, def string) {
+    c.Flags().StringP("output", "o", def, "Output format: "+strings.Join(printer.Formats, ", ")+"; csv and tsv print each table of a command, separated by a blank line")
+    addFormatAlias(c, "json")
+}
+
+// addFormatAlias registers a deprecated boolean flag named after an output
+// format that selects it, as commands took before -o.
+func addFormatAlias(c *cobra.Command, format string) {
+    c.Flags().Bool(format, false, "Print output as "+strings.ToUpper(format))
+    c.Flags().MarkDeprecated(format, "use -o "+format+" instead")
+}
+
+// newPrinter returns a printer for the -o format of cmd, writing JSON in the
+// version selected by --output-version. It exits on an unsupported format
+// before the cluster is read.
+func newPrinter(cmd *cobra.Command) *printer.Printer {
+    format, _ := cmd.Flags().GetString("output")
+    for _, alias := range []string{"json", "csv"} {
+        if set, _ := cmd.Flags().GetBool(alias); set {
+            format = alias
+        }
+    }
+    p, err := printer.New(format, flagOutputVersion)
+    if err != nil {
+        fmt.Println("Error:", err)
+        os.Exit(1)
+    }
+    return p
+}
+
+// decimal formats v with two decimals for csv and tsv records.
+func decimal(v float64) string {
+    return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// wastePercent formats the unused share of a request for csv and tsv
+// records, empty without a request.
+func wastePercent(req, used int64) string {
+    if req == 0 {
+        return ""
+    }
+    return decimal((1.0 - float64(used)/float64(req)) * 100.0)
+}
+
+// printDocument writes doc to stdout.
+func printDocument(p *printer.Printer, doc printer.Document) {
+    if err := p.Print(os.Stdout, doc); err != nil {
+        fmt.Println("Error:", err)
+        os.Exit(1)
+    }
+}
+
+// clusterInfo describes the live cluster or snapshot behind source.
+func clusterInfo(source k8s.ClusterReader) output.Cluster {
+    c := output.Cluster{Namespace: flagNamespace}
+    switch s := source.(type) {
+    case *k8s.K8sClient:
+        c.Context, c.Server = s.Context, s.Server
+    case *snapshot.Snapshot:
+        c.Snapshot = flagFromSnapshot
+        c.CapturedAt = &s.CapturedAt
+    }
+    return c
+}
+
+// formatLimits renders the CPU (m) and memory (Mi) limits of a pod, with "-"
+// for a resource no container limits.
+func formatLimits(p analysis.PodRecord) string {
+    if p.NoLimits {
+        return "none"
+    }
+    return formatLimit(p.CPULimitMilli) + " / " + formatLimit(p.MemLimitMi)
+}
+
+func formatLimit(v int64) string {
+    if v == 0 {
+        return "-"
+    }
+    return strconv.FormatInt(v, 10)
+}
+
+// formatRatio renders a limit-to-request ratio, e.g. "2.0x", or "-" without limits.
+func formatRatio(limit int64, ratio float64) string {
+    if limit == 0 {
+        return "-"
+    }
+    return fmt.Sprintf("%.1fx", ratio)
+}
+
+// commandContext returns the context of a one-shot command, cancelled after
+// --timeout or, without it, after def.
+func commandContext(def time.Duration) (context.Context, context.CancelFunc) {
+    return context.WithTimeout(context.Background(), commandTimeout(def))
+}
+
+// commandTimeout returns --timeout if set, otherwise def.
+func commandTimeout(def time.Duration) time.Duration {
+    if flagTimeout > 0 {
+        return flagTimeout
+    }
+    return def
+}
+
+// addUsageFlags registers the flags selecting where usage metrics come from.
+func addUsageFlags(c *cobra.Command) {
+    c.Flags().StringVar(&flagMetricsSource, "metrics-source", "metrics-server", "Usage metrics source: metrics-server or prometheus")
+    c.Flags().StringVar(&flagPrometheusURL, "prometheus-url", "", "Prometheus base URL (with --metrics-source=prometheus)")
+    c.Flags().StringVar(&flagWindow, "window", usage.DefaultWindow, "Lookback window for Prometheus usage, e.g. 1h, 7d, 2w")
+    c.Flags().Float64Var(&flagPercentile, "percentile", 95, "Usage percentile to analyze: 50, 95, 99 or 100 (max)")
+}
+
+// addDaemonSetFlag registers --include-daemonsets.
+func addDaemonSetFlag(c *cobra.Command) {
+    c.Flags().BoolVar(&flagIncludeDaemonSets, "include-daemonsets", false, "Include DaemonSet pods in pod listings and recommendations")
+}
+
+// filterDaemonSets drops DaemonSet pods unless --include-daemonsets is set.
+func filterDaemonSets(pods []analysis.PodRecord) []analysis.PodRecord {
+    if flagIncludeDaemonSets {
+        return pods
+    }
+    return analysis.WithoutDaemonSets(pods)
+}
+
+// newClusterSource returns the cluster reader and usage provider for a
+// command: the snapshot file given by --from-snapshot, otherwise the live cluster.
+func newClusterSource() (k8s.ClusterReader, usage.Provider, error) {
+    if err := usage.ValidatePercentile(flagPercentile); err != nil {
+        return nil, nil, err
+    }
+    if flagFromSnapshot != "" {
+        snap, err := loadSnapshot(flagFromSnapshot)
+        if err != nil {
+            return nil, nil, fmt.Errorf("loading snapshot: %w", err)
+        }
+        return snap, snap, nil
+    }
+
+    kube, err := k8s.NewK8sClientWithConfig(flagKubeconfig)
+    if err != nil {
+        return nil, nil, fmt.Errorf("creating kube client: %w", err)
+    }
+    provider, err := newUsageProvider(kube)
+    if err != nil {
+        return nil, nil, fmt.Errorf("creating usage provider: %w", err)
+    }
+    return kube, provider, nil
+}
+
+// loadSnapshot loads the snapshot at path and prints a warning for each
+// part of the cluster it was captured without.
+func loadSnapshot(path string) (*snapshot.Snapshot, error) {
+    snap, err := snapshot.Load(path)
+    if err != nil {
+        return nil, err
+    }
+    for _, w := range snap.Warnings {
+        fmt.Fprintf(os.Stderr, "Warning: Snapshot %s is incomplete: %s\n", path, w)
+    }
+    return snap, nil
+}
+
+// listPods lists the pods of every namespace, which node figures and the
+// scale-in simulation count whatever -n selects, and returns them with the
+// pods of namespace (all namespaces if empty). When listing every namespace
+// is forbidden, only namespace is listed and node figures count its pods
+// alone.
+func listPods(ctx context.Context, source k8s.ClusterReader, namespace string) ([]v1.Pod, []v1.Pod, error) {
+    all, err := source.ListPods(ctx, "")
+    if err == nil {
+        return all, podsIn(all, namespace), nil
+    }
+    if namespace == "" || !apierrors.IsForbidden(err) {
+        return nil, nil, err
+    }
+    pods, nsErr := source.ListPods(ctx, namespace)
+    if nsErr != nil {
+        return nil, nil, nsErr
+    }
+    fmt.Fprintf(os.Stderr, "Warning: Pods of other namespaces not available, node figures only count namespace %s: %v\n", namespace, err)
+    return pods, pods, nil
+}
+
+// podAndContainerUsage returns the pod and container usage of every
+// namespace, which the DaemonSets of a namespaced analysis need. If only
+// namespace may be read, it falls back to the usage of namespace.
+func podAndContainerUsage(ctx context.Context, provider usage.Provider, namespace string) (map[k8s.PodKey]usage.Stats, map[k8s.PodKey]map[string]usage.Stats, error) {
+    pods, containers, err := usage.PodAndContainerUsage(ctx, provider, "")
+    if err == nil || namespace == "" || !apierrors.IsForbidden(err) {
+        return pods, containers, err
+    }
+    pods, containers, nsErr := usage.PodAndContainerUsage(ctx, provider, namespace)
+    if nsErr != nil {
+        return nil, nil, nsErr
+    }
+    fmt.Fprintf(os.Stderr, "Warning: Usage of other namespaces not available, DaemonSets only show usage in namespace %s: %v\n", namespace, err)
+    return pods, containers, nil
+}
+
+// podsIn returns the pods of namespace, or all pods if namespace is empty.
+func podsIn(pods []v1.Pod, namespace string) []v1.Pod {
+    if namespace == "" {
+        return pods
+    }
+    var out []v1.Pod
+    for _, p := range pods {
+        if p.Namespace == namespace {
+            out = append(out, p)
+        }
+    }
+    return out
+}
+
+// analyze lists nodes, pods and PDBs from source, selects their usage at the
+// configured percentile and runs the full analysis pipeline under pol. Node
+// figures, the scale-in simulation and drain risk count the pods and PDBs of
+// every namespace; pod results cover namespace (all namespaces if empty).
+func analyze(ctx context.Context, source k8s.ClusterReader, provider usage.Provider, pol *policy.Policy, namespace string) (analysis.Analysis, error) {
+    nodes, err := source.ListNodes(ctx)
+    if err != nil {
+        return analysis.Analysis{}, fmt.Errorf("listing nodes: %w", err)
+    }
+    allPods, pods, err := listPods(ctx, source, namespace)
+    if err != nil {
+        return analysis.Analysis{}, fmt.Errorf("listing pods: %w", err)
+    }
+    // Draining a node evicts the pods of every namespace.
+    pdbs, err := source.ListPDBs(ctx, "")
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Warning: PodDisruptionBudgets not available, drain risk ignores them:", err)
+    }
+    nodeUsage, err := provider.NodeUsage(ctx)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Warning: Usage metrics not available, usage values will be zero:", err)
+    }
+    podUsage, containerUsage, usageErr := podAndContainerUsage(ctx, provider, namespace)
+    if usageErr != nil {
+        fmt.Fprintln(os.Stderr, "Warning: Usage metrics not available, usage values will be zero:", usageErr)
+    }
+
+    nodeStats := analysis.NodeStats(nodes, usage.Select(nodeUsage, flagPercentile), allPods, pol)
+    podMetrics := usage.Select(podUsage, flagPercentile)
+    containerMetrics := usage.SelectContainers(containerUsage, flagPercentile)
+    annotations := workloadAnnotations(ctx, source, namespace)
+    owners := ownerGraph(ctx, source, namespace)
+    allRecords := analysis.PodRecords(pods, podMetrics, containerMetrics, "", annotations, owners)
+    podRecords := filterDaemonSets(allRecords)
+    // DaemonSets run in their own namespaces on every node, so they are
+    // aggregated from the pods and usage of every namespace. DaemonSet pods
+    // are owned directly by their DaemonSet, so the owner graph of namespace
+    // suffices.
+    daemonSetRecords := allRecords
+    if namespace != "" {
+        daemonSetRecords = analysis.PodRecords(allPods, podMetrics, containerMetrics, "", annotations, owners)
+    }
+
+    candidates := analysis.ScaleInCandidates(nodeStats, pol)
+    sim := analysis.SimulateScaleIn(nodes, allPods, candidates)
+    drains := analysis.AssessDrains(candidates, allPods, pdbs)
+    recs := append(analysis.RecommendNodes(nodeStats, sim, drains, pol), analysis.RecommendPods(podRecords, pol)...)
+    recs = append(recs, analysis.RecommendUnderProvisioned(podRecords, pol)...)
+    recs = append(recs, analysis.RecommendLimits(nodeStats, podRecords, pol)...)
+    analysis.SortBySeverity(recs)
+
+    return analysis.Analysis{
+        Nodes:           nodeStats,
+        Pods:            podRecords,
+        Deployments:     analysis.DeploymentAggregation(podRecords),
+        Recommendations: recs,
+        Suppressed:      analysis.SuppressedPods(podRecords, pol),
+        DaemonSets:      analysis.DaemonSetAggregation(daemonSetRecords),
+        UsageAvailable:  usageErr == nil,
+    }, nil
+}
+
+// workloadAnnotations reads the Deployments and namespaces of namespace (all
+// namespaces if empty) for their kcap annotations. Annotations are optional,
+// so failures only print a warning, and none if reading them is forbidden.
+func workloadAnnotations(ctx context.Context, source k8s.ClusterReader, namespace string) analysis.WorkloadAnnotations {
+    deployments, err := source.ListDeployments(ctx, namespace)
+    if err != nil && !apierrors.IsForbidden(err) {
+        fmt.Fprintln(os.Stderr, "Warning: Deployments not available, their kcap annotations are ignored:", err)
+    }
+    var namespaces []v1.Namespace
+    if namespace == "" {
+        namespaces, err = source.ListNamespaces(ctx)
+    } else {
+        var ns *v1.Namespace
+        if ns, err = source.GetNamespace(ctx, namespace); err == nil {
+            namespaces = []v1.Namespace{*ns}
+        }
+    }
+    if err != nil && !apierrors.IsForbidden(err) && !apierrors.IsNotFound(err) {
+        fmt.Fprintln(os.Stderr, "Warning: Namespaces not available, their kcap annotations are ignored:", err)
+    }
+    return analysis.NewWorkloadAnnotations(deployments, namespaces)
+}
+
+// ownerGraph lists the ReplicaSets and Jobs of namespace to resolve pods to
+// their top-level workload. Without them, Deployments are guessed from
+// ReplicaSet names and Jobs are not attributed to their CronJob, so failures
+// only print a warning.
+func ownerGraph(ctx context.Context, source k8s.ClusterReader, namespace string) *analysis.OwnerGraph {
+    replicaSets, err := source.ListReplicaSets(ctx, namespace)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Warning: ReplicaSets not available, Deployments are guessed from pod names:", err)
+    }
+    jobs, err := source.ListJobs(ctx, namespace)
+    if err != nil {
+        fmt.Fprintln(os.Stderr, "Warning: Jobs not available, CronJob pods are grouped by Job:", err)
+    }
+    return analysis.NewOwnerGraph(replicaSets, jobs)
+}
+
+// newUsageProvider returns the usage provider selected by the usage flags.
+func newUsageProvider(kube *k8s.K8sClient) (usage.Provider, error) {
+    switch flagMetricsSource {
+    case "", "metrics-server":
+        return usage.NewMetricsServerProvider(kube), nil
+    case "prometheus":
+        if flagPrometheusURL == "" {
+            return nil, fmt.Errorf("--prometheus-url is required with --metrics-source=prometheus")
+        }
+        return usage.NewPrometheusProvider(flagPrometheusURL, flagWindow)
+    default:
+        return nil, fmt.Errorf("unknown metrics source %q (expected metrics-server or prometheus)", flagMetricsSource)
+    }
 }
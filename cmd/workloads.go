@@ -0,0 +1,123 @@
+package cmd
+
+import (
+    "fmt"
+    "os"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/spf13/cobra"
+    "kcap/pkg/analysis"
+    "kcap/pkg/printer"
+    "kcap/pkg/usage"
+)
+
+var workloadsCmd = &cobra.Command{
+    Use:   "workloads",
+    Short: "Aggregated CPU/memory request vs usage per workload of any kind",
+    Run: func(cmd *cobra.Command, args []string) {
+        out := newPrinter(cmd)
+        ctx, cancel := commandContext(30 * time.Second)
+        defer cancel()
+
+        source, provider, err := newClusterSource()
+        if err != nil {
+            fmt.Println("Error:", err)
+            os.Exit(1)
+        }
+
+        pods, err := source.ListPods(ctx, flagNamespace)
+        if err != nil {
+            fmt.Println("Error listing pods:", err)
+            os.Exit(1)
+        }
+
+        podUsage, err := provider.PodUsage(ctx, flagNamespace)
+        if err != nil {
+            fmt.Fprintln(os.Stderr, "Warning: Usage metrics not available, usage values will be zero:", err)
+        }
+        podMetrics := usage.Select(podUsage, flagPercentile)
+
+        podRecords := analysis.PodRecords(pods, podMetrics, nil, "", workloadAnnotations(ctx, source, flagNamespace), ownerGraph(ctx, source, flagNamespace))
+        var workloads []analysis.WorkloadStat
+        for _, w := range analysis.WorkloadAggregation(podRecords) {
+            if matchesKind(w.Kind) {
+                workloads = append(workloads, w)
+            }
+        }
+
+        // Sort by CPU waste descending
+        sort.SliceStable(workloads, func(i, j int) bool {
+            return workloads[i].WasteCPU > workloads[j].WasteCPU
+        })
+
+        t := printer.NewTable(
+            printer.Columns("NAMESPACE", "KIND", "NAME", "CPU(REQ/USE m)", "MEM(REQ/USE Mi)", "PODS", "NODES", "WASTE% CPU", "WASTE% MEM", "LIMIT/REQ CPU", "LIMIT/REQ MEM", "NO LIMITS"),
+            printer.WideColumns("LIMITS(CPU m/MEM Mi)"),
+        )
+        for _, w := range workloads {
+            cpu := fmt.Sprintf("%d / %d", w.CPUReqMilli, w.CPUUsedMilli)
+            mem := fmt.Sprintf("%d / %d", w.MemReqMi, w.MemUsedMi)
+            wasteCPU := fmt.Sprintf("%.1f", w.WasteCPU)
+            wasteMem := fmt.Sprintf("%.1f", w.WasteMem)
+            t.AddRow(
+                w.Namespace, w.Kind, w.Name, cpu, mem, w.PodCount, w.NodeCount, wasteCPU, wasteMem,
+                formatRatio(w.CPULimitMilli, w.CPULimitRatio), formatRatio(w.MemLimitMi, w.MemLimitRatio), w.PodsWithoutLimits,
+                fmt.Sprintf("%s / %s", formatLimit(w.CPULimitMilli), formatLimit(w.MemLimitMi)),
+            )
+        }
+        printDocument(out, printer.Document{
+            Kind:     "WorkloadList",
+            Cluster:  clusterInfo(source),
+            Items:    workloads,
+            Sections: []printer.Section{{Table: t, Records: workloadRecords(workloads)}},
+        })
+    },
+}
+
+// workloadRecords lists workload or deployment stats with unformatted
+// numbers for csv and tsv output; limit ratios are empty without limits.
+func workloadRecords(workloads []analysis.WorkloadStat) *printer.Table {
+    t := printer.NewTable(printer.Columns(
+        "namespace", "kind", "name", "pods", "nodes",
+        "cpu_requested_m", "cpu_used_m", "cpu_limits_m", "memory_requested_mi", "memory_used_mi", "memory_limits_mi",
+        "cpu_waste_pct", "memory_waste_pct", "cpu_limit_ratio", "memory_limit_ratio", "pods_without_limits",
+    ))
+    ratio := func(limit int64, r float64) string {
+        if limit == 0 {
+            return ""
+        }
+        return decimal(r)
+    }
+    for _, w := range workloads {
+        t.AddRow(
+            w.Namespace, w.Kind, w.Name, w.PodCount, w.NodeCount,
+            w.CPUReqMilli, w.CPUUsedMilli, w.CPULimitMilli, w.MemReqMi, w.MemUsedMi, w.MemLimitMi,
+            decimal(w.WasteCPU), decimal(w.WasteMem), ratio(w.CPULimitMilli, w.CPULimitRatio), ratio(w.MemLimitMi, w.MemLimitRatio), w.PodsWithoutLimits,
+        )
+    }
+    return t
+}
+
+// matchesKind reports whether a workload kind is selected by --kind. Kinds
+// are matched case-insensitively; no --kind selects every kind.
+func matchesKind(kind string) bool {
+    if len(flagKinds) == 0 {
+        return true
+    }
+    for _, k := range flagKinds {
+        if strings.EqualFold(k, kind) {
+            return true
+        }
+    }
+    return false
+}
+
+func init() {
+    workloadsCmd.Flags().StringVar(&flagKubeconfig, "kubeconfig", "", "Path to kubeconfig file")
+    workloadsCmd.Flags().StringVarP(&flagNamespace, "namespace", "n", "", "Namespace")
+    addOutputFlag(workloadsCmd, "table")
+    workloadsCmd.Flags().StringSliceVar(&flagKinds, "kind", nil, "Only show workloads of these kinds, e.g. StatefulSet,DaemonSet")
+    addUsageFlags(workloadsCmd)
+}
@@ -0,0 +1,61 @@
+package analysis
+
+import "k8s.io/apimachinery/pkg/labels"
+
+// Analysis bundles the results of analyzing one capture of a cluster.
+type Analysis struct {
+    Nodes           []NodeStat
+    Pods            []PodRecord
+    Deployments     []DeploymentStat
+    Recommendations []Recommendation
+    // Suppressed lists the pods that got no recommendations, and why.
+    Suppressed []SuppressedPod
+    // DaemonSets aggregates every DaemonSet across the fleet, whether or not
+    // DaemonSet pods are part of Pods.
+    DaemonSets []WorkloadStat
+    // UsageAvailable reports whether pod and container usage was loaded.
+    // Without it every usage value is zero.
+    UsageAvailable bool
+}
+
+// Select narrows a to the pods matching selector: their records,
+// deployments, suppressions and recommendations, including the workload
+// recommendations of their workloads. Nodes, their recommendations and the
+// DaemonSets still describe the whole cluster, so scale-in is judged with
+// every pod.
+func (a Analysis) Select(selector labels.Selector) Analysis {
+    pods := make(map[string]bool)
+    workloads := make(map[string]bool)
+    out := a
+    out.Pods = nil
+    for _, p := range a.Pods {
+        if selector.Matches(labels.Set(p.Labels)) {
+            out.Pods = append(out.Pods, p)
+            pods[p.Namespace+"/"+p.Name] = true
+            workloads[p.Namespace+"/"+p.WorkloadKind+"/"+p.WorkloadName] = true
+        }
+    }
+    out.Deployments = DeploymentAggregation(out.Pods)
+
+    out.Recommendations = nil
+    for _, r := range a.Recommendations {
+        switch {
+        case r.Pod != "":
+            if !pods[r.Namespace+"/"+r.Pod] {
+                continue
+            }
+        case r.Namespace != "":
+            if !workloads[r.Details] {
+                continue
+            }
+        }
+        out.Recommendations = append(out.Recommendations, r)
+    }
+    out.Suppressed = nil
+    for _, p := range a.Suppressed {
+        if pods[p.Namespace+"/"+p.Name] {
+            out.Suppressed = append(out.Suppressed, p)
+        }
+    }
+    return out
+}
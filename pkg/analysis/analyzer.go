@@ -2,81 +2,133 @@ package analysis
 
 import (
     "fmt"
+    "math"
+    "sort"
     "strings"
 
     v1 "k8s.io/api/core/v1"
+    "kcap/pkg/k8s"
+    "kcap/pkg/policy"
 )
 
 const (
-    CPUScaleInThresholdPercent = 30.0 // Scale-in candidate threshold (%)
-    MemScaleInThresholdPercent = 30.0
+    OOMRiskPercent            = 90.0  // Memory usage above this share of the limit risks OOM kills (%)
+    ThrottleRiskPercent       = 90.0  // CPU usage above this share of the limit risks throttling (%)
+    MemLimitOvercommitPercent = 100.0 // Node memory limits above this share of allocatable (%)
+    CPULimitOvercommitPercent = 200.0 // Node CPU limits above this share of allocatable (%)
+
+    CPURequestStepMilli = 50 // Proposed CPU requests are rounded up to this step (m)
+    MemRequestStepMi    = 64 // Proposed memory requests are rounded up to this step (Mi)
+
+    SystemNamespace = "kube-system" // Pods here count as system overhead
 )
 
 type NodeStat struct {
-    Name          string
-    CPUAllocMilli int64
-    CPUReqMilli   int64
-    CPUUsedMilli  int64
-    MemAllocMi    int64
-    MemReqMi      int64
-    MemUsedMi     int64
-    UserPodCount  int
-    Status        string
+    Name          string `json:"name"`
+    CPUAllocMilli int64  `json:"cpuAllocatableMillicores"`
+    CPUReqMilli   int64  `json:"cpuRequestMillicores"`
+    CPUUsedMilli  int64  `json:"cpuUsedMillicores"`
+    MemAllocMi    int64  `json:"memoryAllocatableMebibytes"`
+    MemReqMi      int64  `json:"memoryRequestMebibytes"`
+    MemUsedMi     int64  `json:"memoryUsedMebibytes"`
+    // UserPodCount counts the pods holding requests, leaving out DaemonSet
+    // and kube-system pods.
+    UserPodCount int               `json:"userPodCount"`
+    Status       string            `json:"status"`
+    Labels       map[string]string `json:"labels"`
+    // Sum of container limits and their share of allocatable (%).
+    CPULimitMilli      int64   `json:"cpuLimitMillicores"`
+    MemLimitMi         int64   `json:"memoryLimitMebibytes"`
+    CPULimitOvercommit float64 `json:"cpuLimitOvercommit"`
+    MemLimitOvercommit float64 `json:"memoryLimitOvercommit"`
+    // System overhead: the requests of DaemonSet and kube-system pods plus
+    // the capacity reserved for the kubelet and OS (capacity minus
+    // allocatable), and its share of capacity (%).
+    CPUCapacityMilli int64   `json:"cpuCapacityMillicores"`
+    MemCapacityMi    int64   `json:"memoryCapacityMebibytes"`
+    SystemCPUMilli   int64   `json:"systemCPUMillicores"`
+    SystemMemMi      int64   `json:"systemMemoryMebibytes"`
+    SystemCPUPercent float64 `json:"systemCPUPercent"`
+    SystemMemPercent float64 `json:"systemMemoryPercent"`
 }
 
-type DeploymentStat struct {
-    Namespace    string
-    Name         string
-    CPUReqMilli  int64
-    CPUUsedMilli int64
-    MemReqMi     int64
-    MemUsedMi    int64
-    PodCount     int
-    WasteCPU     float64
-    WasteMem     float64
-}
+// DeploymentStat is the WorkloadStat of a Deployment.
+type DeploymentStat = WorkloadStat
 
 type Recommendation struct {
-    Type       string
-    Details    string
-    Suggestion string
-    Severity   string
+    Type       string `json:"type"`
+    Details    string `json:"details"`
+    Suggestion string `json:"suggestion"`
+    Severity   string `json:"severity"`
+    // Target of the recommendation: Node for node recommendations,
+    // Namespace/Pod/Container for right-sizing recommendations.
+    Node      string `json:"node"`
+    Namespace string `json:"namespace"`
+    Pod       string `json:"pod"`
+    Container string `json:"container"`
+    // Right-sizing values, set for CPU (millicores) and memory (Mi) recommendations.
+    Resource string `json:"resource"`
+    Current  int64  `json:"current"`
+    Usage    int64  `json:"usage"`
+    Proposed int64  `json:"proposed"`
+    Savings  int64  `json:"savings"`
+    // Drain is set for scale-in candidates.
+    Drain *DrainAssessment `json:"drain,omitempty"`
 }
 
 type PodRecord struct {
-    Namespace    string
-    Name         string
-    NodeName     string
-    CPUReqMilli  int64
-    CPUUsedMilli int64
-    MemReqMi     int64
-    MemUsedMi    int64
-    Owner        string
-    Deployment   string
-    IsDaemonSet  bool
+    Namespace    string            `json:"namespace"`
+    Name         string            `json:"name"`
+    UID          string            `json:"uid"`
+    NodeName     string            `json:"nodeName"`
+    CPUReqMilli  int64             `json:"cpuRequestMillicores"`
+    CPUUsedMilli int64             `json:"cpuUsedMillicores"`
+    MemReqMi     int64             `json:"memoryRequestMebibytes"`
+    MemUsedMi    int64             `json:"memoryUsedMebibytes"`
+    Owner        string            `json:"owner"`
+    OwnerName    string            `json:"ownerName"`
+    Deployment   string            `json:"deployment"`
+    WorkloadKind string            `json:"workloadKind"`
+    WorkloadName string            `json:"workloadName"`
+    IsDaemonSet  bool              `json:"isDaemonSet"`
+    Containers   []ContainerRecord `json:"containers"`
+    Labels       map[string]string `json:"labels"`
+    // Set from kcap.io annotations on the pod, its Deployment or its namespace.
+    Ignored         bool     `json:"ignored"`
+    IgnoredBy       string   `json:"ignoredBy"`
+    MinCPUMilli     int64    `json:"minCPUMillicores"`
+    HeadroomPercent *float64 `json:"headroomPercent,omitempty"`
+    // Sums of the limits set by containers; NoLimits is true when no
+    // container sets any limit.
+    CPULimitMilli int64 `json:"cpuLimitMillicores"`
+    MemLimitMi    int64 `json:"memoryLimitMebibytes"`
+    NoLimits      bool  `json:"noLimits"`
+    // HasUsage is false when no usage was reported for the pod, in which
+    // case the usage fields are zero rather than measured.
+    HasUsage bool `json:"-"`
 }
 
-func ResolveDeploymentName(pod v1.Pod) string {
-    for _, ownerRef := range pod.OwnerReferences {
-        if ownerRef.Kind == "Deployment" {
-            return ownerRef.Name
-        }
-        if ownerRef.Kind == "ReplicaSet" {
-            rsName := ownerRef.Name
-            idx := strings.LastIndex(rsName, "-")
-            if idx > 0 {
-                return rsName[:idx]
-            }
-            return rsName
-        }
-    }
-    if appName, ok := pod.Labels["app.kubernetes.io/name"]; ok {
-        return appName
-    }
-    if app, ok := pod.Labels["app"]; ok {
-        return app
-    }
-    return pod.Name
+type ContainerRecord struct {
+    Namespace    string `json:"namespace"`
+    Pod          string `json:"pod"`
+    Name         string `json:"name"`
+    NodeName     string `json:"nodeName"`
+    CPUReqMilli  int64  `json:"cpuRequestMillicores"`
+    CPUUsedMilli int64  `json:"cpuUsedMillicores"`
+    MemReqMi     int64  `json:"memoryRequestMebibytes"`
+    MemUsedMi    int64  `json:"memoryUsedMebibytes"`
+    Deployment   string `json:"deployment"`
+    // Limits are zero when not set.
+    CPULimitMilli int64 `json:"cpuLimitMillicores"`
+    MemLimitMi    int64 `json:"memoryLimitMebibytes"`
+    // HasUsage is false when no usage was reported for the container, in
+    // which case the usage fields are zero rather than measured.
+    HasUsage bool `json:"-"`
+}
+
+// Key returns the namespace/pod/container key of the container.
+func (c ContainerRecord) Key() string {
+    return c.Namespace + "/" + c.Pod + "/" + c.Name
 }
 
 func getNodeCondition(conditions []v1.NodeCondition, condType v1.NodeConditionType) *v1.NodeCondition {
@@ -88,7 +140,10 @@ func getNodeCondition(conditions []v1.NodeCondition, condType v1.NodeConditionTy
     return nil
 }
 
-func NodeStats(nodes []v1.Node, nodeMetrics map[string]v1.ResourceList, pods []v1.Pod) []NodeStat {
+// NodeStats totals requests, limits and usage per node. Pods that succeeded
+// or failed hold no requests and are left out. Ready nodes below the policy's
+// scale-in thresholds for both CPU and memory are scale-in candidates.
+func NodeStats(nodes []v1.Node, nodeMetrics map[string]v1.ResourceList, pods []v1.Pod, pol *policy.Policy) []NodeStat {
     var stats []NodeStat
 
     for _, n := range nodes {
@@ -96,6 +151,8 @@ func NodeStats(nodes []v1.Node, nodeMetrics map[string]v1.ResourceList, pods []v
         status := "Unknown"
         cpuAlloc := n.Status.Allocatable.Cpu().MilliValue()
         memAlloc := n.Status.Allocatable.Memory().Value() / 1024 / 1024
+        cpuCapacity := n.Status.Capacity.Cpu().MilliValue()
+        memCapacity := n.Status.Capacity.Memory().Value() / 1024 / 1024
 
         var cpuUsed int64 = 0
         var memUsed int64 = 0
@@ -114,7 +171,8 @@ func NodeStats(nodes []v1.Node, nodeMetrics map[string]v1.ResourceList, pods []v
         }
 
         if readyCondition != nil && readyCondition.Status == v1.ConditionTrue {
-            if cpuUsagePercent < CPUScaleInThresholdPercent && memUsagePercent < MemScaleInThresholdPercent {
+            thresholds := pol.ForNode(n.Labels)
+            if cpuUsagePercent < thresholds.CPUScaleInPercent && memUsagePercent < thresholds.MemScaleInPercent {
                 if len(nodes) == 1 {
                     status = "Downsize candidate"
                 } else {
@@ -129,18 +187,48 @@ func NodeStats(nodes []v1.Node, nodeMetrics map[string]v1.ResourceList, pods []v
 
         var cpuReqTotal int64 = 0
         var memReqTotal int64 = 0
+        var cpuLimitTotal, memLimitTotal int64
         podCount := 0
+        cpuSystem := max(cpuCapacity-cpuAlloc, 0)
+        memSystem := max(memCapacity-memAlloc, 0)
 
         for _, pod := range pods {
-            if pod.Spec.NodeName == n.Name {
-                podCount++
+            if pod.Spec.NodeName == n.Name && isActive(pod) {
+                // Requests count init containers and pod overhead as the
+                // scheduler does.
+                cpuReq, memReq := podRequests(pod)
+                cpuReqTotal += cpuReq
+                memReqTotal += memReq / (1024 * 1024)
+                if isDaemonSetPod(pod) || pod.Namespace == SystemNamespace {
+                    cpuSystem += cpuReq
+                    memSystem += memReq / (1024 * 1024)
+                } else {
+                    podCount++
+                }
                 for _, c := range pod.Spec.Containers {
-                    cpuReqTotal += c.Resources.Requests.Cpu().MilliValue()
-                    memReqTotal += c.Resources.Requests.Memory().Value() / (1024 * 1024)
+                    cpuLimitTotal += c.Resources.Limits.Cpu().MilliValue()
+                    memLimitTotal += c.Resources.Limits.Memory().Value() / (1024 * 1024)
                 }
             }
         }
 
+        cpuOvercommit := 0.0
+        memOvercommit := 0.0
+        if cpuAlloc > 0 {
+            cpuOvercommit = float64(cpuLimitTotal) / float64(cpuAlloc) * 100.0
+        }
+        if memAlloc > 0 {
+            memOvercommit = float64(memLimitTotal) / float64(memAlloc) * 100.0
+        }
+        cpuSystemPercent := 0.0
+        memSystemPercent := 0.0
+        if cpuCapacity > 0 {
+            cpuSystemPercent = float64(cpuSystem) / float64(cpuCapacity) * 100.0
+        }
+        if memCapacity > 0 {
+            memSystemPercent = float64(memSystem) / float64(memCapacity) * 100.0
+        }
+
         stats = append(stats, NodeStat{
             Name:          n.Name,
             Status:        status,
@@ -151,125 +239,273 @@ func NodeStats(nodes []v1.Node, nodeMetrics map[string]v1.ResourceList, pods []v
             MemReqMi:      memReqTotal,
             MemUsedMi:     memUsed,
             UserPodCount:  podCount,
+            Labels:        n.Labels,
+
+            CPULimitMilli:      cpuLimitTotal,
+            MemLimitMi:         memLimitTotal,
+            CPULimitOvercommit: cpuOvercommit,
+            MemLimitOvercommit: memOvercommit,
+
+            CPUCapacityMilli: cpuCapacity,
+            MemCapacityMi:    memCapacity,
+            SystemCPUMilli:   cpuSystem,
+            SystemMemMi:      memSystem,
+            SystemCPUPercent: cpuSystemPercent,
+            SystemMemPercent: memSystemPercent,
         })
     }
     return stats
 }
 
-func PodRecords(pods []v1.Pod, podMetrics map[string]v1.ResourceList, filter string) []PodRecord {
+// PodRecords builds per-pod records, including a record for each spec
+// container. Container usage is matched to spec containers by name, each pod
+// is attributed to its top-level workload through owners, and kcap
+// annotations are resolved from the pod, its Deployment and its namespace.
+// DaemonSet pods are included and marked IsDaemonSet.
+func PodRecords(pods []v1.Pod, podMetrics map[k8s.PodKey]v1.ResourceList, containerMetrics map[k8s.PodKey]map[string]v1.ResourceList, filter string, annotations WorkloadAnnotations, owners *OwnerGraph) []PodRecord {
     var records []PodRecord
     for _, p := range pods {
-        isDaemon := false
-        for _, ownerRef := range p.OwnerReferences {
-            if ownerRef.Kind == "DaemonSet" {
-                isDaemon = true
-                break
-            }
-        }
-        if isDaemon {
-            continue // Ignore DaemonSet pods
-        }
-
+        isDaemon := isDaemonSetPod(p)
         owner := "None"
+        ownerName := ""
         for _, ownerRef := range p.OwnerReferences {
             owner = ownerRef.Kind
+            ownerName = ownerRef.Name
             break
         }
+        key := k8s.KeyForPod(p)
+        workload := owners.Root(p)
+        deployment := workload.Name
         cpuReq := int64(0)
         memReq := int64(0)
+        var cpuLimit, memLimit int64
+        noLimits := true
+        var containers []ContainerRecord
         for _, c := range p.Spec.Containers {
+            cr := ContainerRecord{
+                Namespace:  p.Namespace,
+                Pod:        p.Name,
+                Name:       c.Name,
+                NodeName:   p.Spec.NodeName,
+                Deployment: deployment,
+            }
             if r := c.Resources.Requests.Cpu(); r != nil {
-                cpuReq += r.MilliValue()
+                cr.CPUReqMilli = r.MilliValue()
             }
             if r := c.Resources.Requests.Memory(); r != nil {
-                memReq += r.Value() / 1024 / 1024
+                cr.MemReqMi = r.Value() / 1024 / 1024
+            }
+            if l, ok := c.Resources.Limits[v1.ResourceCPU]; ok {
+                cr.CPULimitMilli = l.MilliValue()
+                noLimits = false
             }
+            if l, ok := c.Resources.Limits[v1.ResourceMemory]; ok {
+                cr.MemLimitMi = l.Value() / 1024 / 1024
+                noLimits = false
+            }
+            if usage, ok := containerMetrics[key][c.Name]; ok {
+                cr.CPUUsedMilli = usage.Cpu().MilliValue()
+                cr.MemUsedMi = usage.Memory().Value() / 1024 / 1024
+                cr.HasUsage = true
+            }
+            cpuReq += cr.CPUReqMilli
+            memReq += cr.MemReqMi
+            cpuLimit += cr.CPULimitMilli
+            memLimit += cr.MemLimitMi
+            containers = append(containers, cr)
         }
 
         var cpuUsed int64 = 0
         var memUsed int64 = 0
-        if usage, ok := podMetrics[p.Name]; ok {
+        usage, hasUsage := podMetrics[key]
+        if hasUsage {
             cpuUsed = usage.Cpu().MilliValue()
             memUsed = usage.Memory().Value() / 1024 / 1024
         }
 
-        records = append(records, PodRecord{
+        record := PodRecord{
             Namespace:    p.Namespace,
             Name:         p.Name,
+            UID:          string(p.UID),
             NodeName:     p.Spec.NodeName,
             CPUReqMilli:  cpuReq,
             CPUUsedMilli: cpuUsed,
             MemReqMi:     memReq,
             MemUsedMi:    memUsed,
             Owner:        owner,
-            Deployment:   ResolveDeploymentName(p),
+            OwnerName:    ownerName,
+            Deployment:   deployment,
+            WorkloadKind: workload.Kind,
+            WorkloadName: workload.Name,
             IsDaemonSet:  isDaemon,
-        })
+            Containers:   containers,
+            Labels:       p.Labels,
+
+            CPULimitMilli: cpuLimit,
+            MemLimitMi:    memLimit,
+            NoLimits:      noLimits,
+            HasUsage:      hasUsage,
+        }
+        ownerDeployment := ""
+        if workload.Kind == "Deployment" {
+            ownerDeployment = workload.Name
+        }
+        annotations.apply(&record, p.Annotations, ownerDeployment)
+        records = append(records, record)
     }
     return records
 }
 
-func DeploymentAggregation(pods []PodRecord) []DeploymentStat {
-    m := make(map[string]*DeploymentStat)
+// ContainerRecords flattens the container records of the given pods.
+func ContainerRecords(pods []PodRecord) []ContainerRecord {
+    var records []ContainerRecord
     for _, p := range pods {
-        key := p.Namespace + "/" + p.Deployment
-        d, ok := m[key]
-        if !ok {
-            d = &DeploymentStat{
-                Namespace: p.Namespace,
-                Name:      p.Deployment,
-            }
-            m[key] = d
-        }
-        d.PodCount++
-        d.CPUReqMilli += p.CPUReqMilli
-        d.CPUUsedMilli += p.CPUUsedMilli
-        d.MemReqMi += p.MemReqMi
-        d.MemUsedMi += p.MemUsedMi
+        records = append(records, p.Containers...)
     }
+    return records
+}
+
+// DeploymentAggregation aggregates the pods of Deployments. Pods of other
+// workloads are left out; see WorkloadAggregation.
+func DeploymentAggregation(pods []PodRecord) []DeploymentStat {
     var deployments []DeploymentStat
-    for _, d := range m {
-        if d.CPUReqMilli > 0 {
-            d.WasteCPU = (1.0 - float64(d.CPUUsedMilli)/float64(d.CPUReqMilli)) * 100
-        }
-        if d.MemReqMi > 0 {
-            d.WasteMem = (1.0 - float64(d.MemUsedMi)/float64(d.MemReqMi)) * 100
+    for _, w := range WorkloadAggregation(pods) {
+        if w.Kind == "Deployment" {
+            deployments = append(deployments, w)
         }
-        deployments = append(deployments, *d)
     }
     return deployments
 }
 
-func severityLevel(waste float64) string {
+// riskDirection tells whether a resource is over- or under-provisioned.
+type riskDirection int
+
+const (
+    overProvisioned riskDirection = iota
+    underProvisioned
+)
+
+var severityRanks = map[string]int{"Critical": 4, "High": 3, "Medium": 2, "Low": 1, "Info": 0}
+
+// SeverityRank orders severities from Info (0) to Critical (4).
+func SeverityRank(severity string) int {
+    return severityRanks[severity]
+}
+
+// SortBySeverity orders recommendations from most to least severe. Within a
+// severity, request increases come first, memory before CPU; otherwise the
+// order is kept.
+func SortBySeverity(recs []Recommendation) {
+    sort.SliceStable(recs, func(i, j int) bool {
+        if ri, rj := SeverityRank(recs[i].Severity), SeverityRank(recs[j].Severity); ri != rj {
+            return ri > rj
+        }
+        return increaseRank(recs[i]) > increaseRank(recs[j])
+    })
+}
+
+func increaseRank(r Recommendation) int {
+    if r.Proposed <= r.Current {
+        return 0
+    }
+    switch r.Resource {
+    case "memory":
+        return 2
+    case "cpu":
+        return 1
+    }
+    return 0
+}
+
+// severityLevel rates a recommendation by its risk direction.
+// Over-provisioning is rated by waste percent against the policy's severity
+// bands and only costs money. Under-provisioning is rated by usage as a
+// percent of the request: memory ranks highest, as pods using more memory
+// than requested are the first to be OOM-killed or evicted, while pods short
+// of CPU only slow down or starve their neighbours.
+func severityLevel(pct float64, resource string, dir riskDirection, bands policy.SeverityBands) string {
+    if dir == underProvisioned {
+        if resource == "memory" {
+            if pct >= 100 {
+                return "Critical"
+            }
+            return "High"
+        }
+        switch {
+        case pct >= 200:
+            return "High"
+        case pct >= 150:
+            return "Medium"
+        default:
+            return "Low"
+        }
+    }
+    waste := pct
     switch {
-    case waste >= 90:
+    case waste >= bands.High:
         return "High"
-    case waste >= 70:
+    case waste >= bands.Medium:
         return "Medium"
-    case waste >= 50:
+    case waste >= bands.Low:
         return "Low"
     default:
         return "Info"
     }
 }
 
-func RecommendNodes(nodes []NodeStat) []Recommendation {
+// RecommendNodes returns node recommendations. Scale-in candidates are only
+// suggested for draining when the scale-in simulation could reschedule their
+// pods, and carry the drain assessment from drains when present.
+func RecommendNodes(nodes []NodeStat, sim ScaleInResult, drains map[string]DrainAssessment, pol *policy.Policy) []Recommendation {
     var recs []Recommendation
     for _, n := range nodes {
+        if pol.ExcludesNode(n.Name) {
+            continue
+        }
         switch n.Status {
         case "Scale-in candidate":
-            recs = append(recs, Recommendation{
-                Type:       "Scale-in candidate",
-                Details:    n.Name,
-                Suggestion: "Consider draining this node",
-                Severity:   "Medium",
-            })
+            var drain *DrainAssessment
+            if d, ok := drains[n.Name]; ok {
+                drain = &d
+            }
+            if sim.IsRemovable(n.Name) {
+                suggestion := "Consider draining this node"
+                severity := "Medium"
+                if drain != nil && drain.Risk == DrainBlocked {
+                    suggestion = "Resolve drain blockers before draining: " + strings.Join(drain.Blockers, "; ")
+                    severity = "Low"
+                } else if drain != nil && drain.Risk == DrainRisky {
+                    suggestion = "Consider draining this node after reviewing: " + strings.Join(drain.Blockers, "; ")
+                }
+                recs = append(recs, Recommendation{
+                    Type:       "Scale-in candidate",
+                    Details:    n.Name,
+                    Suggestion: suggestion,
+                    Severity:   severity,
+                    Node:       n.Name,
+                    Drain:      drain,
+                })
+            } else {
+                reason := sim.Blocked[n.Name]
+                if reason == "" {
+                    reason = "scale-in was not simulated"
+                }
+                recs = append(recs, Recommendation{
+                    Type:       "Scale-in blocked",
+                    Details:    n.Name,
+                    Suggestion: "Keep this node: " + reason,
+                    Severity:   "Info",
+                    Node:       n.Name,
+                    Drain:      drain,
+                })
+            }
         case "Downsize candidate":
             recs = append(recs, Recommendation{
                 Type:       "Downsize candidate",
                 Details:    n.Name,
                 Suggestion: "Replace the node with a smaller instance type",
                 Severity:   "Medium",
+                Node:       n.Name,
             })
         case "NotReady":
             recs = append(recs, Recommendation{
@@ -277,37 +513,182 @@ func RecommendNodes(nodes []NodeStat) []Recommendation {
                 Details:    n.Name + " is NotReady",
                 Suggestion: "Check node health and connectivity",
                 Severity:   "High",
+                Node:       n.Name,
             })
         }
     }
+    if sim.Candidates > 0 {
+        recs = append(recs, Recommendation{
+            Type:       "Scale-in simulation",
+            Details:    fmt.Sprintf("%d of %d candidate nodes removable", len(sim.Removable), sim.Candidates),
+            Suggestion: scaleInSummary(sim),
+            Severity:   "Info",
+        })
+    }
+    return recs
+}
+
+func scaleInSummary(sim ScaleInResult) string {
+    if len(sim.Removable) == 0 {
+        return "No candidate node can be removed without leaving pods unschedulable"
+    }
+    return "Pods fit on the remaining nodes after removing " + strings.Join(sim.Removable, ", ")
+}
+
+// RecommendPods returns right-sizing recommendations for each container of
+// the given pods whose waste is at or above the waste threshold the policy
+// sets for the pod, with headroom and minimum CPU adjusted by the pod's kcap
+// annotations. Ignored and excluded pods, and containers without reported
+// usage, are skipped.
+func RecommendPods(pods []PodRecord, pol *policy.Policy) []Recommendation {
+    var recs []Recommendation
+    for _, p := range pods {
+        if skipPod(p, pol) {
+            continue
+        }
+        recs = append(recs, RecommendContainers(p.Containers, podThresholds(p, pol), pol.Severity)...)
+    }
     return recs
 }
 
-func RecommendPods(pods []PodRecord, threshold float64) []Recommendation {
+func RecommendContainers(containers []ContainerRecord, t policy.PodThresholds, bands policy.SeverityBands) []Recommendation {
+    var recs []Recommendation
+    for _, c := range containers {
+        // Without usage the container would look idle and be cut to the
+        // minimum request.
+        if !c.HasUsage {
+            continue
+        }
+        if c.CPUReqMilli > 0 {
+            cpuWaste := 100 * (1.0 - float64(c.CPUUsedMilli)/float64(c.CPUReqMilli))
+            proposed := max(ProposeCPURequest(c.CPUUsedMilli, t.CPUHeadroomPercent), t.MinCPUMilli)
+            if cpuWaste >= t.WastePercent && proposed < c.CPUReqMilli {
+                recs = append(recs, Recommendation{
+                    Type:       "Container (CPU)",
+                    Details:    c.Key(),
+                    Suggestion: fmt.Sprintf("Reduce CPU request of container %s from %dm to %dm", c.Name, c.CPUReqMilli, proposed),
+                    Severity:   severityLevel(cpuWaste, "cpu", overProvisioned, bands),
+                    Namespace:  c.Namespace,
+                    Pod:        c.Pod,
+                    Container:  c.Name,
+                    Resource:   "cpu",
+                    Current:    c.CPUReqMilli,
+                    Usage:      c.CPUUsedMilli,
+                    Proposed:   proposed,
+                    Savings:    c.CPUReqMilli - proposed,
+                })
+            }
+        }
+        if c.MemReqMi > 0 {
+            memWaste := 100 * (1.0 - float64(c.MemUsedMi)/float64(c.MemReqMi))
+            proposed := ProposeMemRequest(c.MemUsedMi, t.MemHeadroomPercent)
+            if memWaste >= t.WastePercent && proposed < c.MemReqMi {
+                recs = append(recs, Recommendation{
+                    Type:       "Container (Memory)",
+                    Details:    c.Key(),
+                    Suggestion: fmt.Sprintf("Reduce Memory request of container %s from %dMi to %dMi", c.Name, c.MemReqMi, proposed),
+                    Severity:   severityLevel(memWaste, "memory", overProvisioned, bands),
+                    Namespace:  c.Namespace,
+                    Pod:        c.Pod,
+                    Container:  c.Name,
+                    Resource:   "memory",
+                    Current:    c.MemReqMi,
+                    Usage:      c.MemUsedMi,
+                    Proposed:   proposed,
+                    Savings:    c.MemReqMi - proposed,
+                })
+            }
+        }
+    }
+    return recs
+}
+
+// RecommendUnderProvisioned returns request increases for each container of
+// the given pods whose usage is at or above the under-provisioning threshold
+// the policy sets for the pod. Containers using a resource without requesting
+// it are always reported. Increases are capped at the container's limit and
+// save nothing, so their Savings is zero. Ignored and excluded pods are
+// skipped.
+func RecommendUnderProvisioned(pods []PodRecord, pol *policy.Policy) []Recommendation {
     var recs []Recommendation
     for _, p := range pods {
-        if p.CPUReqMilli > 0 {
-            cpuWaste := 100 * (1.0 - float64(p.CPUUsedMilli)/float64(p.CPUReqMilli))
-            if cpuWaste >= threshold {
+        if skipPod(p, pol) {
+            continue
+        }
+        recs = append(recs, recommendIncreases(p.Containers, podThresholds(p, pol), pol.Severity)...)
+    }
+    return recs
+}
+
+func recommendIncreases(containers []ContainerRecord, t policy.PodThresholds, bands policy.SeverityBands) []Recommendation {
+    var recs []Recommendation
+    for _, c := range containers {
+        if c.CPUUsedMilli > 0 {
+            used := usagePercent(c.CPUUsedMilli, c.CPUReqMilli)
+            needed := max(ProposeCPURequest(c.CPUUsedMilli, t.CPUHeadroomPercent), t.MinCPUMilli)
+            proposed := capAtLimit(needed, c.CPULimitMilli)
+            if used >= t.UnderProvisionPercent && proposed > c.CPUReqMilli {
                 recs = append(recs, Recommendation{
-                    Type:       "Pod (CPU)",
-                    Details:    fmt.Sprintf("%s/%s", p.Namespace, p.Name),
-                    Suggestion: "Consider reducing CPU requests",
-                    Severity:   severityLevel(cpuWaste),
+                    Type:       "Container (CPU under-provisioned)",
+                    Details:    c.Key(),
+                    Suggestion: fmt.Sprintf("Increase CPU request of container %s from %dm to %dm%s", c.Name, c.CPUReqMilli, proposed, cappedNote(needed, c.CPULimitMilli)),
+                    Severity:   severityLevel(used, "cpu", underProvisioned, bands),
+                    Namespace:  c.Namespace,
+                    Pod:        c.Pod,
+                    Container:  c.Name,
+                    Resource:   "cpu",
+                    Current:    c.CPUReqMilli,
+                    Usage:      c.CPUUsedMilli,
+                    Proposed:   proposed,
                 })
             }
         }
-        if p.MemReqMi > 0 {
-            memWaste := 100 * (1.0 - float64(p.MemUsedMi)/float64(p.MemReqMi))
-            if memWaste >= threshold {
+        if c.MemUsedMi > 0 {
+            used := usagePercent(c.MemUsedMi, c.MemReqMi)
+            needed := ProposeMemRequest(c.MemUsedMi, t.MemHeadroomPercent)
+            proposed := capAtLimit(needed, c.MemLimitMi)
+            if used >= t.UnderProvisionPercent && proposed > c.MemReqMi {
                 recs = append(recs, Recommendation{
-                    Type:       "Pod (Memory)",
-                    Details:    fmt.Sprintf("%s/%s", p.Namespace, p.Name),
-                    Suggestion: "Consider reducing Memory requests",
-                    Severity:   severityLevel(memWaste),
+                    Type:       "Container (Memory under-provisioned)",
+                    Details:    c.Key(),
+                    Suggestion: fmt.Sprintf("Increase Memory request of container %s from %dMi to %dMi%s", c.Name, c.MemReqMi, proposed, cappedNote(needed, c.MemLimitMi)),
+                    Severity:   severityLevel(used, "memory", underProvisioned, bands),
+                    Namespace:  c.Namespace,
+                    Pod:        c.Pod,
+                    Container:  c.Name,
+                    Resource:   "memory",
+                    Current:    c.MemReqMi,
+                    Usage:      c.MemUsedMi,
+                    Proposed:   proposed,
                 })
             }
         }
     }
     return recs
 }
+
+// capAtLimit caps a proposed request at the container's limit, if it sets
+// one, as the API server rejects requests above the limit.
+func capAtLimit(proposed, limit int64) int64 {
+    if limit > 0 {
+        return min(proposed, limit)
+    }
+    return proposed
+}
+
+// cappedNote explains a proposed request that was capped at the limit
+// below the needed request.
+func cappedNote(needed, limit int64) string {
+    if limit > 0 && needed > limit {
+        return " (capped at the limit; raise the limit to go higher)"
+    }
+    return ""
+}
+
+// usagePercent returns used as a percent of requested, or +Inf without a request.
+func usagePercent(used, requested int64) float64 {
+    if requested == 0 {
+        return math.Inf(1)
+    }
+    return float64(used) / float64(requested) * 100
+}
@@ -0,0 +1,92 @@
+package analysis
+
+import (
+    "context"
+    "testing"
+
+    v1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/client-go/kubernetes/fake"
+    metricsv "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+    metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+    "kcap/pkg/k8s"
+)
+
+// TestPodRecordsMatchUsageByNamespace checks that pods sharing a name in
+// different namespaces each get their own usage, read through the client
+// and matched by PodRecords.
+func TestPodRecordsMatchUsageByNamespace(t *testing.T) {
+    ctx := context.Background()
+    usage := map[string]struct {
+        cpu, memory string
+        cpuMilli    int64
+        memMi       int64
+    }{
+        "team-a": {"100m", "128Mi", 100, 128},
+        "team-b": {"900m", "1Gi", 900, 1024},
+    }
+
+    var pods []runtime.Object
+    metricsClient := metricsfake.NewSimpleClientset()
+    for namespace, u := range usage {
+        pods = append(pods, &v1.Pod{
+            ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "web-0"},
+            Spec: v1.PodSpec{Containers: []v1.Container{{
+                Name: "app",
+                Resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+                    v1.ResourceCPU:    resource.MustParse("1"),
+                    v1.ResourceMemory: resource.MustParse("2Gi"),
+                }},
+            }}},
+        })
+        pm := &metricsv.PodMetrics{
+            ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "web-0"},
+            Containers: []metricsv.ContainerMetrics{{
+                Name: "app",
+                Usage: v1.ResourceList{
+                    v1.ResourceCPU:    resource.MustParse(u.cpu),
+                    v1.ResourceMemory: resource.MustParse(u.memory),
+                },
+            }},
+        }
+        // The fake guesses the resource "podmetricses" from the kind, while
+        // the metrics API serves PodMetrics as "pods".
+        if err := metricsClient.Tracker().Create(metricsv.SchemeGroupVersion.WithResource("pods"), pm, namespace); err != nil {
+            t.Fatalf("adding pod metrics: %v", err)
+        }
+    }
+    client := k8s.NewK8sClient(fake.NewSimpleClientset(pods...), metricsClient)
+
+    list, err := client.ListPods(ctx, "")
+    if err != nil {
+        t.Fatalf("ListPods: %v", err)
+    }
+    podMetrics, err := client.PodMetrics(ctx, "")
+    if err != nil {
+        t.Fatalf("PodMetrics: %v", err)
+    }
+    containerMetrics, err := client.ContainerMetrics(ctx, "")
+    if err != nil {
+        t.Fatalf("ContainerMetrics: %v", err)
+    }
+
+    records := PodRecords(list, podMetrics, containerMetrics, "", WorkloadAnnotations{}, nil)
+    if len(records) != 2 {
+        t.Fatalf("PodRecords returned %d records, want 2", len(records))
+    }
+    for _, r := range records {
+        want := usage[r.Namespace]
+        if r.CPUUsedMilli != want.cpuMilli || r.MemUsedMi != want.memMi {
+            t.Errorf("%s/%s usage = %dm/%dMi, want %dm/%dMi", r.Namespace, r.Name, r.CPUUsedMilli, r.MemUsedMi, want.cpuMilli, want.memMi)
+        }
+        if len(r.Containers) != 1 {
+            t.Fatalf("%s/%s has %d containers, want 1", r.Namespace, r.Name, len(r.Containers))
+        }
+        c := r.Containers[0]
+        if !c.HasUsage || c.CPUUsedMilli != want.cpuMilli || c.MemUsedMi != want.memMi {
+            t.Errorf("%s/%s container usage = %dm/%dMi (reported %v), want %dm/%dMi", r.Namespace, r.Name, c.CPUUsedMilli, c.MemUsedMi, c.HasUsage, want.cpuMilli, want.memMi)
+        }
+    }
+}
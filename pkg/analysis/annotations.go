@@ -0,0 +1,125 @@
+package analysis
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+
+    appsv1 "k8s.io/api/apps/v1"
+    v1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+    "kcap/pkg/policy"
+)
+
+// Annotations honored on pods, Deployments and namespaces. A pod's own
+// annotation wins over its Deployment's, which wins over its namespace's.
+const (
+    AnnotationIgnore   = "kcap.io/ignore"   // "true" suppresses all recommendations
+    AnnotationMinCPU   = "kcap.io/min-cpu"  // lowest CPU request to propose, e.g. "250m"
+    AnnotationHeadroom = "kcap.io/headroom" // headroom percent, e.g. "50" or "50%"
+)
+
+// WorkloadAnnotations holds the annotations of Deployments and namespaces,
+// which apply to the pods they contain.
+type WorkloadAnnotations struct {
+    Deployments map[string]map[string]string // namespace/name -> annotations
+    Namespaces  map[string]map[string]string // name -> annotations
+}
+
+// NewWorkloadAnnotations collects the annotations of the given Deployments and namespaces.
+func NewWorkloadAnnotations(deployments []appsv1.Deployment, namespaces []v1.Namespace) WorkloadAnnotations {
+    w := WorkloadAnnotations{
+        Deployments: make(map[string]map[string]string, len(deployments)),
+        Namespaces:  make(map[string]map[string]string, len(namespaces)),
+    }
+    for _, d := range deployments {
+        w.Deployments[d.Namespace+"/"+d.Name] = d.Annotations
+    }
+    for _, ns := range namespaces {
+        w.Namespaces[ns.Name] = ns.Annotations
+    }
+    return w
+}
+
+type annotationSource struct {
+    name        string
+    annotations map[string]string
+}
+
+// apply sets the annotation-driven fields of a pod record. deployment is the
+// name of the pod's Deployment, or "" when it has none. Invalid values are
+// ignored.
+func (w WorkloadAnnotations) apply(r *PodRecord, annotations map[string]string, deployment string) {
+    sources := []annotationSource{{"pod " + r.Namespace + "/" + r.Name, annotations}}
+    if deployment != "" {
+        sources = append(sources, annotationSource{"Deployment " + r.Namespace + "/" + deployment, w.Deployments[r.Namespace+"/"+deployment]})
+    }
+    sources = append(sources, annotationSource{"namespace " + r.Namespace, w.Namespaces[r.Namespace]})
+
+    if value, source, ok := lookupAnnotation(sources, AnnotationIgnore); ok {
+        if ignore, err := strconv.ParseBool(value); err == nil && ignore {
+            r.Ignored = true
+            r.IgnoredBy = fmt.Sprintf("%s=%s on %s", AnnotationIgnore, value, source)
+        }
+    }
+    if value, _, ok := lookupAnnotation(sources, AnnotationMinCPU); ok {
+        if q, err := resource.ParseQuantity(value); err == nil {
+            r.MinCPUMilli = q.MilliValue()
+        }
+    }
+    if value, _, ok := lookupAnnotation(sources, AnnotationHeadroom); ok {
+        if h, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64); err == nil && h >= 0 {
+            r.HeadroomPercent = &h
+        }
+    }
+}
+
+// lookupAnnotation returns the value of key from the first source that sets it.
+func lookupAnnotation(sources []annotationSource, key string) (string, string, bool) {
+    for _, s := range sources {
+        if value, ok := s.annotations[key]; ok {
+            return value, s.name, true
+        }
+    }
+    return "", "", false
+}
+
+// podThresholds returns the policy thresholds for a pod with its annotations applied.
+func podThresholds(p PodRecord, pol *policy.Policy) policy.PodThresholds {
+    t := pol.ForPod(p.Namespace, p.Labels)
+    if p.HeadroomPercent != nil {
+        t.CPUHeadroomPercent = *p.HeadroomPercent
+        t.MemHeadroomPercent = *p.HeadroomPercent
+    }
+    if p.MinCPUMilli > 0 {
+        t.MinCPUMilli = p.MinCPUMilli
+    }
+    return t
+}
+
+// skipPod reports whether a pod gets no recommendations, because it is
+// ignored by annotation or excluded by the policy.
+func skipPod(p PodRecord, pol *policy.Policy) bool {
+    return p.Ignored || pol.ExcludesPod(p.Namespace, p.Labels)
+}
+
+// SuppressedPod is a pod that gets no recommendations, and why.
+type SuppressedPod struct {
+    Namespace string `json:"namespace"`
+    Name      string `json:"name"`
+    Reason    string `json:"reason"`
+}
+
+// SuppressedPods returns the pods ignored by annotation or excluded by the policy.
+func SuppressedPods(pods []PodRecord, pol *policy.Policy) []SuppressedPod {
+    var out []SuppressedPod
+    for _, p := range pods {
+        switch {
+        case p.Ignored:
+            out = append(out, SuppressedPod{Namespace: p.Namespace, Name: p.Name, Reason: p.IgnoredBy})
+        case pol.ExcludesPod(p.Namespace, p.Labels):
+            out = append(out, SuppressedPod{Namespace: p.Namespace, Name: p.Name, Reason: "excluded by policy"})
+        }
+    }
+    return out
+}
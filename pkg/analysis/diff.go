@@ -0,0 +1,215 @@
+package analysis
+
+import (
+    "math"
+    "sort"
+)
+
+// Diff describes how a cluster changed between two analyses.
+type Diff struct {
+    NodesAdded   []string           `json:"nodesAdded"`
+    NodesRemoved []string           `json:"nodesRemoved"`
+    PodsAdded    []string           `json:"podsAdded"`
+    PodsRemoved  []string           `json:"podsRemoved"`
+    Deployments  []DeploymentChange `json:"deployments"`
+    // Waste is nil when either analysis lacks usage.
+    Waste                   *WasteTrend      `json:"waste"`
+    RecommendationsAppeared []Recommendation `json:"recommendationsAppeared"`
+    RecommendationsResolved []Recommendation `json:"recommendationsResolved"`
+}
+
+// DeploymentChange compares a deployment across two analyses. Changes are in
+// percent of the old value; waste deltas are in percentage points.
+type DeploymentChange struct {
+    Namespace     string         `json:"namespace"`
+    Name          string         `json:"name"`
+    Status        string         `json:"status"` // Added, Removed or Changed
+    Old           DeploymentStat `json:"old"`
+    New           DeploymentStat `json:"new"`
+    CPUReqChange  float64        `json:"cpuRequestChange"`
+    CPUUsedChange float64        `json:"cpuUsedChange"`
+    MemReqChange  float64        `json:"memoryRequestChange"`
+    MemUsedChange float64        `json:"memoryUsedChange"`
+    WasteCPUDelta float64        `json:"wasteCPUDelta"`
+    WasteMemDelta float64        `json:"wasteMemoryDelta"`
+}
+
+// WasteTrend holds request-weighted cluster waste percentages before and after.
+type WasteTrend struct {
+    OldCPU float64 `json:"oldCPU"`
+    NewCPU float64 `json:"newCPU"`
+    OldMem float64 `json:"oldMemory"`
+    NewMem float64 `json:"newMemory"`
+}
+
+// DiffAnalyses compares two analyses. Deployments are reported when added,
+// removed, or when requests or usage changed by at least threshold percent.
+// Other workload kinds are not compared.
+func DiffAnalyses(old, cur Analysis, threshold float64) Diff {
+    var d Diff
+
+    d.NodesAdded, d.NodesRemoved = diffKeys(nodeNames(old.Nodes), nodeNames(cur.Nodes))
+    d.PodsAdded, d.PodsRemoved = diffKeys(podKeys(old.Pods), podKeys(cur.Pods))
+
+    oldDeploys := make(map[string]DeploymentStat, len(old.Deployments))
+    for _, dep := range old.Deployments {
+        oldDeploys[dep.Namespace+"/"+dep.Name] = dep
+    }
+    curDeploys := make(map[string]DeploymentStat, len(cur.Deployments))
+    for _, dep := range cur.Deployments {
+        curDeploys[dep.Namespace+"/"+dep.Name] = dep
+    }
+    for key, n := range curDeploys {
+        o, ok := oldDeploys[key]
+        if !ok {
+            d.Deployments = append(d.Deployments, DeploymentChange{Namespace: n.Namespace, Name: n.Name, Status: "Added", New: n})
+            continue
+        }
+        c := DeploymentChange{
+            Namespace:     n.Namespace,
+            Name:          n.Name,
+            Status:        "Changed",
+            Old:           o,
+            New:           n,
+            CPUReqChange:  percentChange(o.CPUReqMilli, n.CPUReqMilli),
+            CPUUsedChange: percentChange(o.CPUUsedMilli, n.CPUUsedMilli),
+            MemReqChange:  percentChange(o.MemReqMi, n.MemReqMi),
+            MemUsedChange: percentChange(o.MemUsedMi, n.MemUsedMi),
+            WasteCPUDelta: n.WasteCPU - o.WasteCPU,
+            WasteMemDelta: n.WasteMem - o.WasteMem,
+        }
+        if math.Abs(c.CPUReqChange) >= threshold || math.Abs(c.CPUUsedChange) >= threshold ||
+            math.Abs(c.MemReqChange) >= threshold || math.Abs(c.MemUsedChange) >= threshold {
+            d.Deployments = append(d.Deployments, c)
+        }
+    }
+    for key, o := range oldDeploys {
+        if _, ok := curDeploys[key]; !ok {
+            d.Deployments = append(d.Deployments, DeploymentChange{Namespace: o.Namespace, Name: o.Name, Status: "Removed", Old: o})
+        }
+    }
+    sort.Slice(d.Deployments, func(i, j int) bool {
+        if d.Deployments[i].Namespace != d.Deployments[j].Namespace {
+            return d.Deployments[i].Namespace < d.Deployments[j].Namespace
+        }
+        return d.Deployments[i].Name < d.Deployments[j].Name
+    })
+
+    if old.UsageAvailable && cur.UsageAvailable {
+        d.Waste = &WasteTrend{
+            OldCPU: podWaste(old.Pods, func(p PodRecord) (int64, int64) { return p.CPUReqMilli, p.CPUUsedMilli }),
+            NewCPU: podWaste(cur.Pods, func(p PodRecord) (int64, int64) { return p.CPUReqMilli, p.CPUUsedMilli }),
+            OldMem: podWaste(old.Pods, func(p PodRecord) (int64, int64) { return p.MemReqMi, p.MemUsedMi }),
+            NewMem: podWaste(cur.Pods, func(p PodRecord) (int64, int64) { return p.MemReqMi, p.MemUsedMi }),
+        }
+    }
+
+    oldKeys := recommendationKeys(old)
+    curKeys := recommendationKeys(cur)
+    d.RecommendationsAppeared = recommendationsOnlyIn(cur.Recommendations, curKeys, oldKeys)
+    d.RecommendationsResolved = recommendationsOnlyIn(old.Recommendations, oldKeys, curKeys)
+    return d
+}
+
+func nodeNames(nodes []NodeStat) map[string]bool {
+    m := make(map[string]bool, len(nodes))
+    for _, n := range nodes {
+        m[n.Name] = true
+    }
+    return m
+}
+
+func podKeys(pods []PodRecord) map[string]bool {
+    m := make(map[string]bool, len(pods))
+    for _, p := range pods {
+        m[p.Namespace+"/"+p.Name] = true
+    }
+    return m
+}
+
+// diffKeys returns the sorted keys only in cur (added) and only in old (removed).
+func diffKeys(old, cur map[string]bool) ([]string, []string) {
+    var added, removed []string
+    for k := range cur {
+        if !old[k] {
+            added = append(added, k)
+        }
+    }
+    for k := range old {
+        if !cur[k] {
+            removed = append(removed, k)
+        }
+    }
+    sort.Strings(added)
+    sort.Strings(removed)
+    return added, removed
+}
+
+func percentChange(old, cur int64) float64 {
+    if old == 0 {
+        if cur == 0 {
+            return 0
+        }
+        return 100
+    }
+    return float64(cur-old) / float64(old) * 100
+}
+
+// podWaste returns the request-weighted waste of the pods that reported
+// usage; pods without usage would otherwise count as idle.
+func podWaste(pods []PodRecord, values func(PodRecord) (int64, int64)) float64 {
+    var req, used int64
+    for _, p := range pods {
+        if !p.HasUsage {
+            continue
+        }
+        r, u := values(p)
+        req += r
+        used += u
+    }
+    if req == 0 {
+        return 0
+    }
+    return (1.0 - float64(used)/float64(req)) * 100
+}
+
+// recommendationKeys returns the key of each recommendation of a, which
+// identifies it independently of the usage-dependent values in its
+// suggestion. Pod recommendations are keyed by the workload owning the pod,
+// so a replica replaced by a new pod keeps its recommendations.
+func recommendationKeys(a Analysis) []string {
+    workloads := make(map[string]string, len(a.Pods))
+    for _, p := range a.Pods {
+        workloads[p.Namespace+"/"+p.Name] = p.WorkloadKind + "/" + p.WorkloadName
+    }
+    keys := make([]string, len(a.Recommendations))
+    for i, r := range a.Recommendations {
+        if r.Pod == "" {
+            keys[i] = r.Type + "|" + r.Details
+            continue
+        }
+        workload, ok := workloads[r.Namespace+"/"+r.Pod]
+        if !ok {
+            workload = "Pod/" + r.Pod
+        }
+        keys[i] = r.Type + "|" + r.Namespace + "/" + workload + "/" + r.Container + "/" + r.Resource
+    }
+    return keys
+}
+
+// recommendationsOnlyIn returns the recommendations whose key is not in
+// other, once per key.
+func recommendationsOnlyIn(recs []Recommendation, keys, other []string) []Recommendation {
+    skip := make(map[string]bool, len(other)+len(keys))
+    for _, k := range other {
+        skip[k] = true
+    }
+    var out []Recommendation
+    for i, r := range recs {
+        if !skip[keys[i]] {
+            skip[keys[i]] = true
+            out = append(out, r)
+        }
+    }
+    return out
+}
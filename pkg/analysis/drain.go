@@ -0,0 +1,136 @@
+package analysis
+
+import (
+    "fmt"
+    "sort"
+
+    v1 "k8s.io/api/core/v1"
+    policyv1 "k8s.io/api/policy/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+    DrainSafe    = "Safe"
+    DrainRisky   = "Risky"
+    DrainBlocked = "Blocked"
+)
+
+// DrainAssessment describes what draining a node would disrupt.
+type DrainAssessment struct {
+    Node     string   `json:"node"`
+    Risk     string   `json:"risk"`     // Safe, Risky or Blocked
+    Blockers []string `json:"blockers"` // pods that prevent or complicate the drain, with the reason
+    PDBs     []string `json:"pdbs"`     // PodDisruptionBudgets that would be violated
+}
+
+// AssessDrains assesses draining each of the named nodes, keyed by node name.
+func AssessDrains(nodeNames []string, pods []v1.Pod, pdbs []policyv1.PodDisruptionBudget) map[string]DrainAssessment {
+    out := make(map[string]DrainAssessment, len(nodeNames))
+    for _, n := range nodeNames {
+        out[n] = AssessDrain(n, pods, pdbs)
+    }
+    return out
+}
+
+// AssessDrain checks whether evicting the pods on a node would violate a
+// PodDisruptionBudget (blocked), delete a pod without a controller (blocked),
+// lose local storage (risky) or evict the only replica of a workload (risky).
+// DaemonSet and mirror pods are ignored, as a drain does not evict them.
+func AssessDrain(nodeName string, pods []v1.Pod, pdbs []policyv1.PodDisruptionBudget) DrainAssessment {
+    a := DrainAssessment{Node: nodeName, Risk: DrainSafe}
+
+    replicas := make(map[string]int)
+    for _, p := range pods {
+        if owner := controllerOf(p); owner != nil && isActive(p) {
+            replicas[p.Namespace+"/"+owner.Kind+"/"+owner.Name]++
+        }
+    }
+
+    evicted := make(map[string]int) // PDB namespace/name -> pods evicted from this node
+    pdbFor := make(map[string]policyv1.PodDisruptionBudget)
+    for _, p := range pods {
+        if p.Spec.NodeName != nodeName || !isActive(p) || isDaemonSetPod(p) || isMirrorPod(p) {
+            continue
+        }
+        name := p.Namespace + "/" + p.Name
+
+        owner := controllerOf(p)
+        if owner == nil {
+            a.block(name + ": no controller, the pod would not be recreated")
+        } else if replicas[p.Namespace+"/"+owner.Kind+"/"+owner.Name] == 1 {
+            a.risk(fmt.Sprintf("%s: only replica of %s %s", name, owner.Kind, owner.Name))
+        }
+        if hasLocalStorage(p) {
+            a.risk(name + ": uses emptyDir local storage")
+        }
+
+        for _, pdb := range pdbs {
+            if pdb.Namespace != p.Namespace || !pdbSelects(pdb, p) {
+                continue
+            }
+            key := pdb.Namespace + "/" + pdb.Name
+            evicted[key]++
+            pdbFor[key] = pdb
+        }
+    }
+
+    var keys []string
+    for k := range evicted {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    for _, key := range keys {
+        allowed := pdbFor[key].Status.DisruptionsAllowed
+        if int32(evicted[key]) > allowed {
+            a.PDBs = append(a.PDBs, key)
+            a.block(fmt.Sprintf("PDB %s: allows %d disruptions, drain would evict %d pods", key, allowed, evicted[key]))
+        }
+    }
+    return a
+}
+
+func (a *DrainAssessment) block(reason string) {
+    a.Risk = DrainBlocked
+    a.Blockers = append(a.Blockers, reason)
+}
+
+func (a *DrainAssessment) risk(reason string) {
+    if a.Risk == DrainSafe {
+        a.Risk = DrainRisky
+    }
+    a.Blockers = append(a.Blockers, reason)
+}
+
+func controllerOf(p v1.Pod) *metav1.OwnerReference {
+    for i, ownerRef := range p.OwnerReferences {
+        if ownerRef.Controller != nil && *ownerRef.Controller {
+            return &p.OwnerReferences[i]
+        }
+    }
+    if len(p.OwnerReferences) > 0 {
+        return &p.OwnerReferences[0]
+    }
+    return nil
+}
+
+func hasLocalStorage(p v1.Pod) bool {
+    for _, vol := range p.Spec.Volumes {
+        if vol.EmptyDir != nil {
+            return true
+        }
+    }
+    return false
+}
+
+func pdbSelects(pdb policyv1.PodDisruptionBudget, p v1.Pod) bool {
+    if pdb.Spec.Selector == nil {
+        return false
+    }
+    // In policy/v1 an empty selector matches every pod in the namespace.
+    selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+    if err != nil {
+        return false
+    }
+    return selector.Matches(labels.Set(p.Labels))
+}
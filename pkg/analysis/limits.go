@@ -0,0 +1,110 @@
+package analysis
+
+import (
+    "fmt"
+
+    "kcap/pkg/policy"
+)
+
+// RecommendLimits returns limit recommendations: nodes whose limits overcommit
+// allocatable, workloads whose pods set no limits, and containers whose
+// memory usage is close to the limit (OOM risk) or whose CPU usage reaches
+// the limit (throttling risk). Proposed limits cover usage plus the policy's
+// headroom. Excluded nodes and ignored or excluded pods are skipped, and
+// system and DaemonSet pods are not asked to set limits.
+func RecommendLimits(nodes []NodeStat, pods []PodRecord, pol *policy.Policy) []Recommendation {
+    var recs []Recommendation
+    for _, n := range nodes {
+        if pol.ExcludesNode(n.Name) {
+            continue
+        }
+        if n.MemLimitOvercommit > MemLimitOvercommitPercent {
+            recs = append(recs, Recommendation{
+                Type:       "Limit overcommit (Memory)",
+                Details:    n.Name,
+                Suggestion: fmt.Sprintf("Memory limits are %.0f%% of allocatable; pods may be OOM-killed or evicted under load", n.MemLimitOvercommit),
+                Severity:   "Medium",
+                Node:       n.Name,
+            })
+        }
+        if n.CPULimitOvercommit > CPULimitOvercommitPercent {
+            recs = append(recs, Recommendation{
+                Type:       "Limit overcommit (CPU)",
+                Details:    n.Name,
+                Suggestion: fmt.Sprintf("CPU limits are %.0f%% of allocatable; pods will be throttled if they burst together", n.CPULimitOvercommit),
+                Severity:   "Low",
+                Node:       n.Name,
+            })
+        }
+    }
+
+    noLimits := make(map[string]bool)
+    for _, p := range pods {
+        if skipPod(p, pol) {
+            continue
+        }
+        t := podThresholds(p, pol)
+        // Replicas share their limits, and system and DaemonSet pods are
+        // sized by the cluster operator rather than the workload owner.
+        key := p.Namespace + "/" + p.WorkloadKind + "/" + p.WorkloadName
+        if p.NoLimits && !p.IsDaemonSet && p.Namespace != SystemNamespace && !noLimits[key] {
+            noLimits[key] = true
+            recs = append(recs, Recommendation{
+                Type:       "Workload (No limits)",
+                Details:    key,
+                Suggestion: "Set a memory limit so its pods cannot exhaust node memory",
+                Severity:   "Low",
+                Namespace:  p.Namespace,
+            })
+        }
+        for _, c := range p.Containers {
+            if c.MemLimitMi > 0 && c.MemUsedMi > 0 {
+                used := float64(c.MemUsedMi) / float64(c.MemLimitMi) * 100
+                if used >= OOMRiskPercent {
+                    proposed := max(ProposeMemRequest(c.MemUsedMi, t.MemHeadroomPercent), c.MemLimitMi+MemRequestStepMi)
+                    severity := "Medium"
+                    if used >= 100 {
+                        severity = "High"
+                    }
+                    recs = append(recs, Recommendation{
+                        Type:       "Container (OOM risk)",
+                        Details:    c.Key(),
+                        Suggestion: fmt.Sprintf("Memory usage is %.0f%% of the limit; raise the memory limit of container %s from %dMi to %dMi", used, c.Name, c.MemLimitMi, proposed),
+                        Severity:   severity,
+                        Namespace:  c.Namespace,
+                        Pod:        c.Pod,
+                        Container:  c.Name,
+                        Resource:   "memory-limit",
+                        Current:    c.MemLimitMi,
+                        Usage:      c.MemUsedMi,
+                        Proposed:   proposed,
+                    })
+                }
+            }
+            if c.CPULimitMilli > 0 && c.CPUUsedMilli > 0 {
+                used := float64(c.CPUUsedMilli) / float64(c.CPULimitMilli) * 100
+                if used >= ThrottleRiskPercent {
+                    proposed := max(ProposeCPURequest(c.CPUUsedMilli, t.CPUHeadroomPercent), c.CPULimitMilli+CPURequestStepMilli)
+                    severity := "Low"
+                    if used >= 100 {
+                        severity = "Medium"
+                    }
+                    recs = append(recs, Recommendation{
+                        Type:       "Container (CPU throttling)",
+                        Details:    c.Key(),
+                        Suggestion: fmt.Sprintf("CPU usage is %.0f%% of the limit; raise the CPU limit of container %s from %dm to %dm or remove it", used, c.Name, c.CPULimitMilli, proposed),
+                        Severity:   severity,
+                        Namespace:  c.Namespace,
+                        Pod:        c.Pod,
+                        Container:  c.Name,
+                        Resource:   "cpu-limit",
+                        Current:    c.CPULimitMilli,
+                        Usage:      c.CPUUsedMilli,
+                        Proposed:   proposed,
+                    })
+                }
+            }
+        }
+    }
+    return recs
+}
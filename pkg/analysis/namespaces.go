@@ -0,0 +1,145 @@
+package analysis
+
+import (
+    "sort"
+
+    v1 "k8s.io/api/core/v1"
+)
+
+// NamespaceStat aggregates the pods of a namespace for chargeback, or of a
+// group of namespaces sharing a label value. Shares are requests as a
+// percentage of cluster allocatable; quotas sum the tightest CPU and memory
+// request quota of each namespace.
+type NamespaceStat struct {
+    Name         string   `json:"name"`
+    Namespaces   []string `json:"namespaces"`
+    PodCount     int      `json:"podCount"`
+    CPUReqMilli  int64    `json:"cpuRequestMillicores"`
+    CPUUsedMilli int64    `json:"cpuUsedMillicores"`
+    MemReqMi     int64    `json:"memoryRequestMebibytes"`
+    MemUsedMi    int64    `json:"memoryUsedMebibytes"`
+    CPUShare     float64  `json:"cpuShare"`
+    MemShare     float64  `json:"memoryShare"`
+    WasteCPU     float64  `json:"wasteCPU"`
+    WasteMem     float64  `json:"wasteMemory"`
+    // Requested but unused resources.
+    CPUWasteMilli int64 `json:"cpuWasteMillicores"`
+    MemWasteMi    int64 `json:"memoryWasteMebibytes"`
+    // ResourceQuota hard limits and consumption; zero without quotas.
+    QuotaCPUHardMilli int64 `json:"quotaCPUHardMillicores"`
+    QuotaCPUUsedMilli int64 `json:"quotaCPUUsedMillicores"`
+    QuotaMemHardMi    int64 `json:"quotaMemoryHardMebibytes"`
+    QuotaMemUsedMi    int64 `json:"quotaMemoryUsedMebibytes"`
+}
+
+// NamespaceAggregation aggregates pods by namespace; callers pass active pods
+// only. With groups, which maps
+// namespaces to a group name such as a team, namespaces of the same group are
+// aggregated together; namespaces missing from groups form the "" group.
+// Stats are ordered by CPU requests, largest first.
+func NamespaceAggregation(pods []PodRecord, quotas []v1.ResourceQuota, cluster ClusterSummary, groups map[string]string) []NamespaceStat {
+    m := make(map[string]*NamespaceStat)
+    seen := make(map[string]bool)
+    stat := func(namespace string) *NamespaceStat {
+        name := namespace
+        if groups != nil {
+            name = groups[namespace]
+        }
+        s, ok := m[name]
+        if !ok {
+            s = &NamespaceStat{Name: name}
+            m[name] = s
+        }
+        if !seen[namespace] {
+            seen[namespace] = true
+            s.Namespaces = append(s.Namespaces, namespace)
+        }
+        return s
+    }
+
+    for _, p := range pods {
+        s := stat(p.Namespace)
+        s.PodCount++
+        s.CPUReqMilli += p.CPUReqMilli
+        s.CPUUsedMilli += p.CPUUsedMilli
+        s.MemReqMi += p.MemReqMi
+        s.MemUsedMi += p.MemUsedMi
+        s.CPUWasteMilli += max(p.CPUReqMilli-p.CPUUsedMilli, 0)
+        s.MemWasteMi += max(p.MemReqMi-p.MemUsedMi, 0)
+    }
+    // Every quota of a namespace applies, so the tightest one is its limit;
+    // namespaces of a group then add up.
+    tightest := make(map[string]*NamespaceStat)
+    var quotaNamespaces []string
+    for _, q := range quotas {
+        t, ok := tightest[q.Namespace]
+        if !ok {
+            t = &NamespaceStat{}
+            tightest[q.Namespace] = t
+            quotaNamespaces = append(quotaNamespaces, q.Namespace)
+        }
+        if hard := quotaCPU(q.Status.Hard); hard > 0 && (t.QuotaCPUHardMilli == 0 || hard < t.QuotaCPUHardMilli) {
+            t.QuotaCPUHardMilli = hard
+            t.QuotaCPUUsedMilli = quotaCPU(q.Status.Used)
+        }
+        if hard := quotaMemory(q.Status.Hard); hard > 0 && (t.QuotaMemHardMi == 0 || hard < t.QuotaMemHardMi) {
+            t.QuotaMemHardMi = hard
+            t.QuotaMemUsedMi = quotaMemory(q.Status.Used)
+        }
+    }
+    for _, namespace := range quotaNamespaces {
+        t := tightest[namespace]
+        s := stat(namespace)
+        s.QuotaCPUHardMilli += t.QuotaCPUHardMilli
+        s.QuotaCPUUsedMilli += t.QuotaCPUUsedMilli
+        s.QuotaMemHardMi += t.QuotaMemHardMi
+        s.QuotaMemUsedMi += t.QuotaMemUsedMi
+    }
+
+    var stats []NamespaceStat
+    for _, s := range m {
+        sort.Strings(s.Namespaces)
+        if cluster.CPUAllocMilli > 0 {
+            s.CPUShare = float64(s.CPUReqMilli) / float64(cluster.CPUAllocMilli) * 100
+        }
+        if cluster.MemAllocMi > 0 {
+            s.MemShare = float64(s.MemReqMi) / float64(cluster.MemAllocMi) * 100
+        }
+        if s.CPUReqMilli > 0 {
+            s.WasteCPU = float64(s.CPUWasteMilli) / float64(s.CPUReqMilli) * 100
+        }
+        if s.MemReqMi > 0 {
+            s.WasteMem = float64(s.MemWasteMi) / float64(s.MemReqMi) * 100
+        }
+        stats = append(stats, *s)
+    }
+    sort.Slice(stats, func(i, j int) bool {
+        if stats[i].CPUReqMilli != stats[j].CPUReqMilli {
+            return stats[i].CPUReqMilli > stats[j].CPUReqMilli
+        }
+        return stats[i].Name < stats[j].Name
+    })
+    return stats
+}
+
+// quotaCPU returns the CPU request quota (m) of a quota's hard or used list.
+func quotaCPU(list v1.ResourceList) int64 {
+    if q, ok := list[v1.ResourceRequestsCPU]; ok {
+        return q.MilliValue()
+    }
+    if q, ok := list[v1.ResourceCPU]; ok {
+        return q.MilliValue()
+    }
+    return 0
+}
+
+// quotaMemory returns the memory request quota (Mi) of a quota's hard or used list.
+func quotaMemory(list v1.ResourceList) int64 {
+    if q, ok := list[v1.ResourceRequestsMemory]; ok {
+        return q.Value() / 1024 / 1024
+    }
+    if q, ok := list[v1.ResourceMemory]; ok {
+        return q.Value() / 1024 / 1024
+    }
+    return 0
+}
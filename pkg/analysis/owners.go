@@ -0,0 +1,88 @@
+package analysis
+
+import (
+    "strings"
+
+    appsv1 "k8s.io/api/apps/v1"
+    batchv1 "k8s.io/api/batch/v1"
+    v1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxOwnerDepth bounds the walk up the owner graph, guarding against cycles.
+const maxOwnerDepth = 10
+
+// Workload is the top-level controller of a pod, e.g. a Deployment,
+// StatefulSet, CronJob or Argo Rollout. Bare pods are their own workload.
+type Workload struct {
+    Kind string
+    Name string
+}
+
+// OwnerGraph resolves pods to their top-level controller by walking
+// OwnerReferences through ReplicaSets and Jobs. Any other owner kind is
+// treated as a root. Roots are cached, so pods sharing an owner walk the
+// graph once.
+type OwnerGraph struct {
+    owners           map[string]*metav1.OwnerReference // namespace/kind/name -> controller, nil for none
+    replicaSetsKnown bool
+    roots            map[string]Workload
+}
+
+// NewOwnerGraph builds the owner graph from ReplicaSets and Jobs. A nil slice
+// means the objects could not be listed: the Deployment of a ReplicaSet is
+// then guessed from the ReplicaSet name, and Jobs are their own root.
+func NewOwnerGraph(replicaSets []appsv1.ReplicaSet, jobs []batchv1.Job) *OwnerGraph {
+    g := &OwnerGraph{
+        owners:           make(map[string]*metav1.OwnerReference, len(replicaSets)+len(jobs)),
+        replicaSetsKnown: replicaSets != nil,
+        roots:            make(map[string]Workload),
+    }
+    for _, rs := range replicaSets {
+        g.owners[ownerKey(rs.Namespace, "ReplicaSet", rs.Name)] = metav1.GetControllerOf(&rs)
+    }
+    for _, j := range jobs {
+        g.owners[ownerKey(j.Namespace, "Job", j.Name)] = metav1.GetControllerOf(&j)
+    }
+    return g
+}
+
+// Root returns the top-level controller of a pod. A nil graph resolves
+// through the pod's own OwnerReferences only.
+func (g *OwnerGraph) Root(p v1.Pod) Workload {
+    ref := controllerOf(p)
+    if ref == nil {
+        return Workload{Kind: "Pod", Name: p.Name}
+    }
+    if g == nil {
+        g = NewOwnerGraph(nil, nil)
+    }
+    key := ownerKey(p.Namespace, ref.Kind, ref.Name)
+    if w, ok := g.roots[key]; ok {
+        return w
+    }
+    w := g.walk(p.Namespace, *ref)
+    g.roots[key] = w
+    return w
+}
+
+func (g *OwnerGraph) walk(namespace string, ref metav1.OwnerReference) Workload {
+    for range maxOwnerDepth {
+        parent, ok := g.owners[ownerKey(namespace, ref.Kind, ref.Name)]
+        if !ok || parent == nil {
+            break
+        }
+        ref = *parent
+    }
+    if ref.Kind == "ReplicaSet" && !g.replicaSetsKnown {
+        // ReplicaSets created by a Deployment are named <deployment>-<pod-template-hash>.
+        if idx := strings.LastIndex(ref.Name, "-"); idx > 0 {
+            return Workload{Kind: "Deployment", Name: ref.Name[:idx]}
+        }
+    }
+    return Workload{Kind: ref.Kind, Name: ref.Name}
+}
+
+func ownerKey(namespace, kind, name string) string {
+    return namespace + "/" + kind + "/" + name
+}
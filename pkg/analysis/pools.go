@@ -0,0 +1,108 @@
+package analysis
+
+import (
+    "fmt"
+    "sort"
+)
+
+// DefaultPoolLabels are the node labels tried, in order, to find the pool a
+// node belongs to.
+var DefaultPoolLabels = []string{
+    "eks.amazonaws.com/nodegroup",
+    "cloud.google.com/gke-nodepool",
+    "agentpool",
+    "node.kubernetes.io/instance-type",
+    "topology.kubernetes.io/zone",
+}
+
+// PoolStat aggregates the nodes of a pool: the nodes sharing the value of
+// Label. Nodes carrying none of the grouping labels form a pool with an empty
+// Label and Name. Percentages are of the pool's allocatable resources.
+type PoolStat struct {
+    Label         string   `json:"label"`
+    Name          string   `json:"name"`
+    Nodes         []string `json:"nodes"`
+    CPUAllocMilli int64    `json:"cpuAllocatableMillicores"`
+    CPUReqMilli   int64    `json:"cpuRequestMillicores"`
+    CPUUsedMilli  int64    `json:"cpuUsedMillicores"`
+    MemAllocMi    int64    `json:"memoryAllocatableMebibytes"`
+    MemReqMi      int64    `json:"memoryRequestMebibytes"`
+    MemUsedMi     int64    `json:"memoryUsedMebibytes"`
+    CPUReqPercent float64  `json:"cpuRequestPercent"`
+    CPUUsePercent float64  `json:"cpuUsePercent"`
+    MemReqPercent float64  `json:"memoryRequestPercent"`
+    MemUsePercent float64  `json:"memoryUsePercent"`
+    // Removable lists the pool's nodes the scale-in simulation could remove
+    // and that can be drained.
+    Removable  []string `json:"removable"`
+    Suggestion string   `json:"suggestion"`
+}
+
+// PoolAggregation groups nodes into pools by the first of labels each node
+// carries, ordered by label and name. sim attributes the removable nodes of
+// a scale-in simulation to their pools, leaving out nodes whose drain drains
+// assesses as blocked.
+func PoolAggregation(nodes []NodeStat, labels []string, sim ScaleInResult, drains map[string]DrainAssessment) []PoolStat {
+    m := make(map[string]*PoolStat)
+    for _, n := range nodes {
+        label, name := poolOf(n.Labels, labels)
+        key := label + "=" + name
+        p, ok := m[key]
+        if !ok {
+            p = &PoolStat{Label: label, Name: name}
+            m[key] = p
+        }
+        p.Nodes = append(p.Nodes, n.Name)
+        p.CPUAllocMilli += n.CPUAllocMilli
+        p.CPUReqMilli += n.CPUReqMilli
+        p.CPUUsedMilli += n.CPUUsedMilli
+        p.MemAllocMi += n.MemAllocMi
+        p.MemReqMi += n.MemReqMi
+        p.MemUsedMi += n.MemUsedMi
+        if sim.IsRemovable(n.Name) && drains[n.Name].Risk != DrainBlocked {
+            p.Removable = append(p.Removable, n.Name)
+        }
+    }
+
+    var pools []PoolStat
+    for _, p := range m {
+        sort.Strings(p.Nodes)
+        sort.Strings(p.Removable)
+        if p.CPUAllocMilli > 0 {
+            p.CPUReqPercent = float64(p.CPUReqMilli) / float64(p.CPUAllocMilli) * 100
+            p.CPUUsePercent = float64(p.CPUUsedMilli) / float64(p.CPUAllocMilli) * 100
+        }
+        if p.MemAllocMi > 0 {
+            p.MemReqPercent = float64(p.MemReqMi) / float64(p.MemAllocMi) * 100
+            p.MemUsePercent = float64(p.MemUsedMi) / float64(p.MemAllocMi) * 100
+        }
+        if len(p.Removable) > 0 {
+            p.Suggestion = fmt.Sprintf("Pool %s can lose %d of %d nodes", p.DisplayName(), len(p.Removable), len(p.Nodes))
+        }
+        pools = append(pools, *p)
+    }
+    sort.Slice(pools, func(i, j int) bool {
+        if pools[i].Label != pools[j].Label {
+            return pools[i].Label < pools[j].Label
+        }
+        return pools[i].Name < pools[j].Name
+    })
+    return pools
+}
+
+// DisplayName returns the pool name, or "<none>" for nodes without a pool label.
+func (p PoolStat) DisplayName() string {
+    if p.Label == "" {
+        return "<none>"
+    }
+    return p.Name
+}
+
+func poolOf(nodeLabels map[string]string, labels []string) (string, string) {
+    for _, l := range labels {
+        if v, ok := nodeLabels[l]; ok {
+            return l, v
+        }
+    }
+    return "", ""
+}
@@ -0,0 +1,180 @@
+package analysis
+
+import (
+    "sort"
+    "strings"
+
+    v1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+    "kcap/pkg/policy"
+)
+
+const (
+    QuotaExhaustedPercent = 90.0 // Quotas used at or above this share of hard are nearly exhausted (%)
+    QuotaOversizedPercent = 25.0 // Quotas whose actual usage is below this share of hard are oversized (%)
+)
+
+// QuotaUsage compares one resource of a ResourceQuota with its consumption.
+// CPU quantities are in m, memory and storage in Mi, anything else is a count.
+type QuotaUsage struct {
+    Namespace   string  `json:"namespace"`
+    Quota       string  `json:"quota"`
+    Resource    string  `json:"resource"`
+    Unit        string  `json:"unit"`
+    Hard        int64   `json:"hard"`
+    Used        int64   `json:"used"`
+    UsedPercent float64 `json:"usedPercent"`
+    // Actual is the real usage of the namespace's pods; HasActual is false
+    // for resources other than CPU and memory, and when usage is unavailable.
+    Actual        int64   `json:"actual"`
+    HasActual     bool    `json:"hasActual"`
+    ActualPercent float64 `json:"actualPercent"`
+    Status        string  `json:"status"`
+}
+
+// QuotaUsages returns the usage of every resource of every quota, ordered by
+// namespace, quota and resource. A quota is "Nearly exhausted" when used
+// reaches QuotaExhaustedPercent of hard, and "Oversized" when the pods
+// actually use less than QuotaOversizedPercent of it. Without usage
+// (hasUsage false) actual usage is not reported, so no quota is oversized.
+func QuotaUsages(quotas []v1.ResourceQuota, pods []PodRecord, hasUsage bool) []QuotaUsage {
+    cpuUsed := make(map[string]int64)
+    memUsed := make(map[string]int64)
+    for _, p := range pods {
+        cpuUsed[p.Namespace] += p.CPUUsedMilli
+        memUsed[p.Namespace] += p.MemUsedMi
+    }
+
+    var out []QuotaUsage
+    for _, q := range quotas {
+        for name, hardQty := range q.Status.Hard {
+            hard, unit := quotaValue(name, hardQty)
+            used, _ := quotaValue(name, q.Status.Used[name])
+            u := QuotaUsage{
+                Namespace: q.Namespace,
+                Quota:     q.Name,
+                Resource:  string(name),
+                Unit:      unit,
+                Hard:      hard,
+                Used:      used,
+                Status:    "OK",
+            }
+            switch name {
+            case v1.ResourceCPU, v1.ResourceRequestsCPU, v1.ResourceLimitsCPU:
+                u.Actual, u.HasActual = cpuUsed[q.Namespace], hasUsage
+            case v1.ResourceMemory, v1.ResourceRequestsMemory, v1.ResourceLimitsMemory:
+                u.Actual, u.HasActual = memUsed[q.Namespace], hasUsage
+            }
+            if hard > 0 {
+                u.UsedPercent = float64(used) / float64(hard) * 100
+                if u.HasActual {
+                    u.ActualPercent = float64(u.Actual) / float64(hard) * 100
+                }
+            }
+            switch {
+            case hard > 0 && u.UsedPercent >= QuotaExhaustedPercent:
+                u.Status = "Nearly exhausted"
+            case hard > 0 && u.HasActual && u.ActualPercent < QuotaOversizedPercent:
+                u.Status = "Oversized"
+            }
+            out = append(out, u)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool {
+        a, b := out[i], out[j]
+        if a.Namespace != b.Namespace {
+            return a.Namespace < b.Namespace
+        }
+        if a.Quota != b.Quota {
+            return a.Quota < b.Quota
+        }
+        return a.Resource < b.Resource
+    })
+    return out
+}
+
+// quotaValue converts a quota quantity to m for CPU, Mi for memory and
+// storage, and a plain count otherwise, and returns the unit.
+func quotaValue(name v1.ResourceName, q resource.Quantity) (int64, string) {
+    switch n := string(name); {
+    case strings.HasSuffix(n, "cpu"):
+        return q.MilliValue(), "m"
+    case strings.HasSuffix(n, "memory"), strings.HasSuffix(n, "storage"):
+        return q.Value() / 1024 / 1024, "Mi"
+    }
+    return q.Value(), ""
+}
+
+// LimitRangeDefault reports a LimitRange default request that most of the
+// containers requesting exactly that amount leave idle, so the default
+// causes systematic over-requesting. Default, MaxUsage and Proposed are in m
+// for cpu and Mi for memory.
+type LimitRangeDefault struct {
+    Namespace  string `json:"namespace"`
+    LimitRange string `json:"limitRange"`
+    Resource   string `json:"resource"`
+    Default    int64  `json:"default"`
+    Containers int    `json:"containers"`
+    Idle       int    `json:"idle"`
+    MaxUsage   int64  `json:"maxUsage"`
+    Proposed   int64  `json:"proposed"`
+}
+
+// LimitRangeDefaults finds container default requests of LimitRanges that
+// more than half of the containers at the default leave idle, i.e. waste at
+// least the waste threshold of the policy. The proposed default covers the
+// highest usage of those containers plus headroom. Ignored and excluded pods
+// are skipped.
+func LimitRangeDefaults(limitRanges []v1.LimitRange, pods []PodRecord, pol *policy.Policy) []LimitRangeDefault {
+    var out []LimitRangeDefault
+    for _, lr := range limitRanges {
+        for _, item := range lr.Spec.Limits {
+            if item.Type != v1.LimitTypeContainer {
+                continue
+            }
+            for _, res := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+                qty, ok := item.DefaultRequest[res]
+                if !ok {
+                    // Without a default request, the default limit is also the request.
+                    if qty, ok = item.Default[res]; !ok {
+                        continue
+                    }
+                }
+                d := LimitRangeDefault{Namespace: lr.Namespace, LimitRange: lr.Name, Resource: string(res)}
+                if d.Default, _ = quotaValue(res, qty); d.Default == 0 {
+                    continue
+                }
+                t := pol.ForPod(lr.Namespace, nil)
+                for _, p := range pods {
+                    if p.Namespace != lr.Namespace || skipPod(p, pol) {
+                        continue
+                    }
+                    waste := podThresholds(p, pol).WastePercent
+                    for _, c := range p.Containers {
+                        req, used := c.CPUReqMilli, c.CPUUsedMilli
+                        if res == v1.ResourceMemory {
+                            req, used = c.MemReqMi, c.MemUsedMi
+                        }
+                        if req != d.Default {
+                            continue
+                        }
+                        d.Containers++
+                        d.MaxUsage = max(d.MaxUsage, used)
+                        if 100*(1.0-float64(used)/float64(req)) >= waste {
+                            d.Idle++
+                        }
+                    }
+                }
+                if res == v1.ResourceCPU {
+                    d.Proposed = ProposeCPURequest(d.MaxUsage, t.CPUHeadroomPercent)
+                } else {
+                    d.Proposed = ProposeMemRequest(d.MaxUsage, t.MemHeadroomPercent)
+                }
+                if d.Idle*2 > d.Containers && d.Proposed < d.Default {
+                    out = append(out, d)
+                }
+            }
+        }
+    }
+    return out
+}
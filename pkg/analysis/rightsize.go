@@ -0,0 +1,70 @@
+package analysis
+
+import (
+    "fmt"
+    "math"
+
+    "kcap/pkg/policy"
+)
+
+// ProposeCPURequest returns a CPU request (m) covering the observed usage plus
+// headroom percent, rounded up to CPURequestStepMilli.
+func ProposeCPURequest(usedMilli int64, headroom float64) int64 {
+    return roundUp(withHeadroom(usedMilli, headroom), CPURequestStepMilli)
+}
+
+// ProposeMemRequest returns a memory request (Mi) covering the observed usage
+// plus headroom percent, rounded up to MemRequestStepMi.
+func ProposeMemRequest(usedMi int64, headroom float64) int64 {
+    return roundUp(withHeadroom(usedMi, headroom), MemRequestStepMi)
+}
+
+// ProposeRequests returns the CPU (m) and memory (Mi) requests proposed for
+// the usage of container c of pod p, with the policy thresholds and the pod's
+// kcap annotations applied as for its right-sizing recommendations, and
+// capped at the container's limits.
+func ProposeRequests(p PodRecord, c ContainerRecord, pol *policy.Policy) (int64, int64) {
+    t := podThresholds(p, pol)
+    cpu := max(ProposeCPURequest(c.CPUUsedMilli, t.CPUHeadroomPercent), t.MinCPUMilli)
+    mem := ProposeMemRequest(c.MemUsedMi, t.MemHeadroomPercent)
+    return capAtLimit(cpu, c.CPULimitMilli), capAtLimit(mem, c.MemLimitMi)
+}
+
+// FormatChange renders the current and proposed request or limit of a
+// recommendation, e.g. "500m → 150m". It returns "" for other recommendations.
+func FormatChange(r Recommendation) string {
+    switch r.Resource {
+    case "cpu", "cpu-limit":
+        return fmt.Sprintf("%dm → %dm", r.Current, r.Proposed)
+    case "memory", "memory-limit":
+        return fmt.Sprintf("%dMi → %dMi", r.Current, r.Proposed)
+    }
+    return ""
+}
+
+// FormatSavings renders the savings of a right-sizing recommendation, e.g.
+// "350m". It returns "" for increases and other recommendations.
+func FormatSavings(r Recommendation) string {
+    if r.Savings <= 0 {
+        return ""
+    }
+    switch r.Resource {
+    case "cpu":
+        return fmt.Sprintf("%dm", r.Savings)
+    case "memory":
+        return fmt.Sprintf("%dMi", r.Savings)
+    }
+    return ""
+}
+
+func withHeadroom(v int64, headroom float64) int64 {
+    return int64(math.Ceil(float64(v) * (1 + headroom/100)))
+}
+
+// roundUp rounds v up to the next multiple of step, never returning less than one step.
+func roundUp(v, step int64) int64 {
+    if v <= step {
+        return step
+    }
+    return (v + step - 1) / step * step
+}
@@ -0,0 +1,380 @@
+package analysis
+
+import (
+    "fmt"
+    "math"
+    "sort"
+    "strconv"
+
+    v1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/apimachinery/pkg/labels"
+    "kcap/pkg/policy"
+)
+
+// ScaleInResult reports which scale-in candidates can really be removed
+// because their pods fit on the remaining nodes.
+type ScaleInResult struct {
+    Candidates int
+    Removable  []string
+    Blocked    map[string]string // node name -> reason
+}
+
+// IsRemovable reports whether the simulation removed the named node.
+func (r ScaleInResult) IsRemovable(node string) bool {
+    for _, n := range r.Removable {
+        if n == node {
+            return true
+        }
+    }
+    return false
+}
+
+// ScaleInCandidates returns the names of nodes marked "Scale-in candidate",
+// leaving out nodes excluded by the policy.
+func ScaleInCandidates(stats []NodeStat, pol *policy.Policy) []string {
+    var names []string
+    for _, s := range stats {
+        if s.Status == "Scale-in candidate" && !pol.ExcludesNode(s.Name) {
+            names = append(names, s.Name)
+        }
+    }
+    return names
+}
+
+type simNode struct {
+    node    v1.Node
+    cpuFree int64 // m
+    memFree int64 // bytes
+    podFree int64
+    pods    []v1.Pod
+}
+
+// SimulateScaleIn removes candidate nodes one at a time, least requested
+// first, and tries to reschedule their pods onto the remaining schedulable
+// nodes by requests. Placement honors nodeSelector, taints and tolerations,
+// required node affinity and required pod anti-affinity. A node is only
+// removed when all of its pods fit; later candidates see the pods moved by
+// earlier removals.
+func SimulateScaleIn(nodes []v1.Node, pods []v1.Pod, candidates []string) ScaleInResult {
+    result := ScaleInResult{Candidates: len(candidates), Blocked: make(map[string]string)}
+
+    state := make(map[string]*simNode, len(nodes))
+    var order []string
+    for _, n := range nodes {
+        podFree := n.Status.Allocatable.Pods().Value()
+        if podFree == 0 {
+            podFree = math.MaxInt32 // pod capacity not reported
+        }
+        state[n.Name] = &simNode{
+            node:    n,
+            cpuFree: n.Status.Allocatable.Cpu().MilliValue(),
+            memFree: n.Status.Allocatable.Memory().Value(),
+            podFree: podFree,
+        }
+        order = append(order, n.Name)
+    }
+    sort.Strings(order)
+    for _, p := range pods {
+        sn, ok := state[p.Spec.NodeName]
+        if !ok || !isActive(p) {
+            continue
+        }
+        cpu, mem := podRequests(p)
+        sn.cpuFree -= cpu
+        sn.memFree -= mem
+        sn.podFree--
+        sn.pods = append(sn.pods, p)
+    }
+
+    sorted := append([]string(nil), candidates...)
+    sort.SliceStable(sorted, func(i, j int) bool {
+        return requestedCPU(state[sorted[i]]) < requestedCPU(state[sorted[j]])
+    })
+
+    removed := make(map[string]bool)
+    for _, name := range sorted {
+        candidate, ok := state[name]
+        if !ok {
+            result.Blocked[name] = "node not found"
+            continue
+        }
+
+        // Work on copies so a failed attempt leaves the cluster state untouched.
+        trial := make(map[string]*simNode, len(state))
+        for n, sn := range state {
+            if n == name || removed[n] {
+                continue
+            }
+            c := *sn
+            c.pods = append([]v1.Pod(nil), sn.pods...)
+            trial[n] = &c
+        }
+
+        reason := ""
+        for _, p := range candidate.pods {
+            if isDaemonSetPod(p) || isMirrorPod(p) {
+                continue // recreated or gone with the node
+            }
+            target := findFit(p, trial, order)
+            if target == nil {
+                reason = fmt.Sprintf("pod %s/%s does not fit on the remaining nodes", p.Namespace, p.Name)
+                break
+            }
+            cpu, mem := podRequests(p)
+            target.cpuFree -= cpu
+            target.memFree -= mem
+            target.podFree--
+            target.pods = append(target.pods, p)
+        }
+        if reason != "" {
+            result.Blocked[name] = reason
+            continue
+        }
+
+        for n, sn := range trial {
+            state[n] = sn
+        }
+        removed[name] = true
+        result.Removable = append(result.Removable, name)
+    }
+    sort.Strings(result.Removable)
+    return result
+}
+
+func findFit(p v1.Pod, nodes map[string]*simNode, order []string) *simNode {
+    cpu, mem := podRequests(p)
+    for _, name := range order {
+        sn, ok := nodes[name]
+        if !ok {
+            continue
+        }
+        if sn.cpuFree < cpu || sn.memFree < mem || sn.podFree < 1 {
+            continue
+        }
+        if !isSchedulable(sn.node) || !matchesNodeSelector(p, sn.node) || !toleratesTaints(p, sn.node) || !matchesNodeAffinity(p, sn.node) {
+            continue
+        }
+        if violatesAntiAffinity(p, sn, nodes) {
+            continue
+        }
+        return sn
+    }
+    return nil
+}
+
+// podRequests returns the CPU (m) and memory (bytes) the scheduler reserves
+// for a pod: the larger of what its containers and sidecars request together
+// and what any init container requests while it runs, plus the pod overhead.
+func podRequests(p v1.Pod) (int64, int64) {
+    var cpu, mem int64
+    for _, c := range p.Spec.Containers {
+        cpu += c.Resources.Requests.Cpu().MilliValue()
+        mem += c.Resources.Requests.Memory().Value()
+    }
+    // Sidecars are init containers that keep running next to the containers
+    // and every init container started after them.
+    var sidecarCPU, sidecarMem, initCPU, initMem int64
+    for _, c := range p.Spec.InitContainers {
+        reqCPU := c.Resources.Requests.Cpu().MilliValue()
+        reqMem := c.Resources.Requests.Memory().Value()
+        initCPU = max(initCPU, sidecarCPU+reqCPU)
+        initMem = max(initMem, sidecarMem+reqMem)
+        if c.RestartPolicy != nil && *c.RestartPolicy == v1.ContainerRestartPolicyAlways {
+            sidecarCPU += reqCPU
+            sidecarMem += reqMem
+        }
+    }
+    cpu = max(cpu+sidecarCPU, initCPU) + p.Spec.Overhead.Cpu().MilliValue()
+    mem = max(mem+sidecarMem, initMem) + p.Spec.Overhead.Memory().Value()
+    return cpu, mem
+}
+
+func requestedCPU(sn *simNode) int64 {
+    if sn == nil {
+        return 0
+    }
+    return sn.node.Status.Allocatable.Cpu().MilliValue() - sn.cpuFree
+}
+
+func isActive(p v1.Pod) bool {
+    return p.Status.Phase != v1.PodSucceeded && p.Status.Phase != v1.PodFailed
+}
+
+// ActivePods returns the pods that have not succeeded or failed and so still
+// hold their requests.
+func ActivePods(pods []v1.Pod) []v1.Pod {
+    var out []v1.Pod
+    for _, p := range pods {
+        if isActive(p) {
+            out = append(out, p)
+        }
+    }
+    return out
+}
+
+func isDaemonSetPod(p v1.Pod) bool {
+    for _, ownerRef := range p.OwnerReferences {
+        if ownerRef.Kind == "DaemonSet" {
+            return true
+        }
+    }
+    return false
+}
+
+func isMirrorPod(p v1.Pod) bool {
+    _, ok := p.Annotations[v1.MirrorPodAnnotationKey]
+    return ok
+}
+
+func isSchedulable(n v1.Node) bool {
+    if n.Spec.Unschedulable {
+        return false
+    }
+    ready := getNodeCondition(n.Status.Conditions, v1.NodeReady)
+    return ready != nil && ready.Status == v1.ConditionTrue
+}
+
+func matchesNodeSelector(p v1.Pod, n v1.Node) bool {
+    for k, v := range p.Spec.NodeSelector {
+        if n.Labels[k] != v {
+            return false
+        }
+    }
+    return true
+}
+
+func toleratesTaints(p v1.Pod, n v1.Node) bool {
+    for i := range n.Spec.Taints {
+        taint := &n.Spec.Taints[i]
+        if taint.Effect != v1.TaintEffectNoSchedule && taint.Effect != v1.TaintEffectNoExecute {
+            continue
+        }
+        tolerated := false
+        for _, t := range p.Spec.Tolerations {
+            if t.ToleratesTaint(taint) {
+                tolerated = true
+                break
+            }
+        }
+        if !tolerated {
+            return false
+        }
+    }
+    return true
+}
+
+func matchesNodeAffinity(p v1.Pod, n v1.Node) bool {
+    if p.Spec.Affinity == nil || p.Spec.Affinity.NodeAffinity == nil {
+        return true
+    }
+    required := p.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+    if required == nil || len(required.NodeSelectorTerms) == 0 {
+        return true
+    }
+    // Terms are ORed; requirements within a term are ANDed.
+    for _, term := range required.NodeSelectorTerms {
+        if matchesNodeSelectorTerm(term, n) {
+            return true
+        }
+    }
+    return false
+}
+
+func matchesNodeSelectorTerm(term v1.NodeSelectorTerm, n v1.Node) bool {
+    if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+        return false
+    }
+    for _, req := range term.MatchExpressions {
+        value, ok := n.Labels[req.Key]
+        if !matchesRequirement(req, value, ok) {
+            return false
+        }
+    }
+    for _, req := range term.MatchFields {
+        if req.Key != "metadata.name" || !matchesRequirement(req, n.Name, true) {
+            return false
+        }
+    }
+    return true
+}
+
+func matchesRequirement(req v1.NodeSelectorRequirement, value string, present bool) bool {
+    switch req.Operator {
+    case v1.NodeSelectorOpIn:
+        return present && contains(req.Values, value)
+    case v1.NodeSelectorOpNotIn:
+        return !present || !contains(req.Values, value)
+    case v1.NodeSelectorOpExists:
+        return present
+    case v1.NodeSelectorOpDoesNotExist:
+        return !present
+    case v1.NodeSelectorOpGt, v1.NodeSelectorOpLt:
+        if !present || len(req.Values) != 1 {
+            return false
+        }
+        have, err1 := strconv.ParseInt(value, 10, 64)
+        want, err2 := strconv.ParseInt(req.Values[0], 10, 64)
+        if err1 != nil || err2 != nil {
+            return false
+        }
+        if req.Operator == v1.NodeSelectorOpGt {
+            return have > want
+        }
+        return have < want
+    }
+    return false
+}
+
+func contains(values []string, v string) bool {
+    for _, s := range values {
+        if s == v {
+            return true
+        }
+    }
+    return false
+}
+
+// violatesAntiAffinity checks required pod anti-affinity in both directions:
+// the incoming pod's terms against pods in the target topology domain, and
+// the terms of those pods against the incoming pod.
+func violatesAntiAffinity(p v1.Pod, target *simNode, nodes map[string]*simNode) bool {
+    for _, sn := range nodes {
+        for _, existing := range sn.pods {
+            if antiAffinityConflict(p, existing, target.node, sn.node) || antiAffinityConflict(existing, p, sn.node, target.node) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+// antiAffinityConflict reports whether owner's required anti-affinity terms
+// forbid it from sharing a topology domain with other, given the nodes each
+// pod runs on.
+func antiAffinityConflict(owner, other v1.Pod, ownerNode, otherNode v1.Node) bool {
+    if owner.Spec.Affinity == nil || owner.Spec.Affinity.PodAntiAffinity == nil {
+        return false
+    }
+    for _, term := range owner.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution {
+        domain, ok := ownerNode.Labels[term.TopologyKey]
+        if !ok || otherNode.Labels[term.TopologyKey] != domain {
+            continue
+        }
+        namespaces := term.Namespaces
+        if len(namespaces) == 0 && term.NamespaceSelector == nil {
+            namespaces = []string{owner.Namespace}
+        }
+        if len(namespaces) > 0 && !contains(namespaces, other.Namespace) {
+            continue
+        }
+        selector, err := metav1.LabelSelectorAsSelector(term.LabelSelector)
+        if err != nil || term.LabelSelector == nil {
+            continue
+        }
+        if selector.Matches(labels.Set(other.Labels)) {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,470 @@
+package analysis
+
+import (
+    "reflect"
+    "testing"
+
+    v1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testNode(name, cpu, memory string, nodeLabels map[string]string) v1.Node {
+    return v1.Node{
+        ObjectMeta: metav1.ObjectMeta{Name: name, Labels: nodeLabels},
+        Status: v1.NodeStatus{
+            Allocatable: v1.ResourceList{
+                v1.ResourceCPU:    resource.MustParse(cpu),
+                v1.ResourceMemory: resource.MustParse(memory),
+            },
+            Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+        },
+    }
+}
+
+func testContainer(name, cpu, memory string) v1.Container {
+    return v1.Container{
+        Name: name,
+        Resources: v1.ResourceRequirements{Requests: v1.ResourceList{
+            v1.ResourceCPU:    resource.MustParse(cpu),
+            v1.ResourceMemory: resource.MustParse(memory),
+        }},
+    }
+}
+
+func testSimPod(name, node, cpu, memory string) v1.Pod {
+    return v1.Pod{
+        ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name, Labels: map[string]string{"app": name}},
+        Spec: v1.PodSpec{
+            NodeName:   node,
+            Containers: []v1.Container{testContainer("app", cpu, memory)},
+        },
+    }
+}
+
+func sidecar(c v1.Container) v1.Container {
+    always := v1.ContainerRestartPolicyAlways
+    c.RestartPolicy = &always
+    return c
+}
+
+// antiAffinity returns a required anti-affinity against pods labelled
+// app=app within topologyKey.
+func antiAffinity(app, topologyKey string) *v1.Affinity {
+    return &v1.Affinity{PodAntiAffinity: &v1.PodAntiAffinity{
+        RequiredDuringSchedulingIgnoredDuringExecution: []v1.PodAffinityTerm{{
+            LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}},
+            TopologyKey:   topologyKey,
+        }},
+    }}
+}
+
+func requiredNodeAffinity(terms ...v1.NodeSelectorTerm) *v1.Affinity {
+    return &v1.Affinity{NodeAffinity: &v1.NodeAffinity{
+        RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{NodeSelectorTerms: terms},
+    }}
+}
+
+func TestPodRequests(t *testing.T) {
+    tests := []struct {
+        name     string
+        spec     v1.PodSpec
+        cpuMilli int64
+        memMi    int64
+    }{
+        {
+            name:     "containers are summed",
+            spec:     v1.PodSpec{Containers: []v1.Container{testContainer("a", "100m", "64Mi"), testContainer("b", "200m", "128Mi")}},
+            cpuMilli: 300,
+            memMi:    192,
+        },
+        {
+            name: "larger init container wins",
+            spec: v1.PodSpec{
+                InitContainers: []v1.Container{testContainer("init", "1", "32Mi")},
+                Containers:     []v1.Container{testContainer("app", "100m", "64Mi")},
+            },
+            cpuMilli: 1000,
+            memMi:    64,
+        },
+        {
+            name: "sidecar runs next to the containers",
+            spec: v1.PodSpec{
+                InitContainers: []v1.Container{sidecar(testContainer("proxy", "50m", "32Mi"))},
+                Containers:     []v1.Container{testContainer("app", "100m", "64Mi")},
+            },
+            cpuMilli: 150,
+            memMi:    96,
+        },
+        {
+            name: "init container after a sidecar runs next to it",
+            spec: v1.PodSpec{
+                InitContainers: []v1.Container{
+                    sidecar(testContainer("proxy", "50m", "32Mi")),
+                    testContainer("migrate", "500m", "256Mi"),
+                },
+                Containers: []v1.Container{testContainer("app", "100m", "64Mi")},
+            },
+            cpuMilli: 550,
+            memMi:    288,
+        },
+        {
+            name: "init container before a sidecar runs alone",
+            spec: v1.PodSpec{
+                InitContainers: []v1.Container{
+                    testContainer("migrate", "500m", "256Mi"),
+                    sidecar(testContainer("proxy", "50m", "32Mi")),
+                },
+                Containers: []v1.Container{testContainer("app", "100m", "64Mi")},
+            },
+            cpuMilli: 500,
+            memMi:    256,
+        },
+        {
+            name: "overhead is added",
+            spec: v1.PodSpec{
+                Containers: []v1.Container{testContainer("app", "100m", "64Mi")},
+                Overhead: v1.ResourceList{
+                    v1.ResourceCPU:    resource.MustParse("10m"),
+                    v1.ResourceMemory: resource.MustParse("16Mi"),
+                },
+            },
+            cpuMilli: 110,
+            memMi:    80,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            cpu, mem := podRequests(v1.Pod{Spec: tt.spec})
+            if cpu != tt.cpuMilli || mem != tt.memMi*1024*1024 {
+                t.Errorf("podRequests = %dm/%dMi, want %dm/%dMi", cpu, mem/1024/1024, tt.cpuMilli, tt.memMi)
+            }
+        })
+    }
+}
+
+func TestMatchesRequirement(t *testing.T) {
+    tests := []struct {
+        name     string
+        op       v1.NodeSelectorOperator
+        values   []string
+        value    string
+        present  bool
+        expected bool
+    }{
+        {"In matches", v1.NodeSelectorOpIn, []string{"a", "b"}, "b", true, true},
+        {"In misses", v1.NodeSelectorOpIn, []string{"a"}, "b", true, false},
+        {"In needs the label", v1.NodeSelectorOpIn, []string{""}, "", false, false},
+        {"NotIn misses", v1.NodeSelectorOpNotIn, []string{"a"}, "b", true, true},
+        {"NotIn matches", v1.NodeSelectorOpNotIn, []string{"a"}, "a", true, false},
+        {"NotIn without the label", v1.NodeSelectorOpNotIn, []string{"a"}, "", false, true},
+        {"Exists", v1.NodeSelectorOpExists, nil, "", true, true},
+        {"DoesNotExist", v1.NodeSelectorOpDoesNotExist, nil, "", true, false},
+        {"Gt greater", v1.NodeSelectorOpGt, []string{"4"}, "8", true, true},
+        {"Gt equal", v1.NodeSelectorOpGt, []string{"8"}, "8", true, false},
+        {"Gt not a number", v1.NodeSelectorOpGt, []string{"4"}, "large", true, false},
+        {"Gt needs one value", v1.NodeSelectorOpGt, []string{"4", "6"}, "8", true, false},
+        {"Lt smaller", v1.NodeSelectorOpLt, []string{"4"}, "2", true, true},
+        {"Lt greater", v1.NodeSelectorOpLt, []string{"4"}, "8", true, false},
+        {"Lt needs the label", v1.NodeSelectorOpLt, []string{"4"}, "", false, false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            req := v1.NodeSelectorRequirement{Key: "k", Operator: tt.op, Values: tt.values}
+            if got := matchesRequirement(req, tt.value, tt.present); got != tt.expected {
+                t.Errorf("matchesRequirement = %v, want %v", got, tt.expected)
+            }
+        })
+    }
+}
+
+func TestMatchesNodeAffinity(t *testing.T) {
+    node := testNode("node-a", "4", "8Gi", map[string]string{"zone": "a", "cores": "16"})
+    zone := func(op v1.NodeSelectorOperator, values ...string) v1.NodeSelectorRequirement {
+        return v1.NodeSelectorRequirement{Key: "zone", Operator: op, Values: values}
+    }
+    name := func(op v1.NodeSelectorOperator, values ...string) v1.NodeSelectorRequirement {
+        return v1.NodeSelectorRequirement{Key: "metadata.name", Operator: op, Values: values}
+    }
+    tests := []struct {
+        name     string
+        affinity *v1.Affinity
+        expected bool
+    }{
+        {"no affinity", nil, true},
+        {"no terms", requiredNodeAffinity(), true},
+        {"matching term", requiredNodeAffinity(v1.NodeSelectorTerm{
+            MatchExpressions: []v1.NodeSelectorRequirement{zone(v1.NodeSelectorOpIn, "a")},
+        }), true},
+        {"requirements are ANDed", requiredNodeAffinity(v1.NodeSelectorTerm{
+            MatchExpressions: []v1.NodeSelectorRequirement{
+                zone(v1.NodeSelectorOpIn, "a"),
+                {Key: "cores", Operator: v1.NodeSelectorOpGt, Values: []string{"32"}},
+            },
+        }), false},
+        {"terms are ORed", requiredNodeAffinity(
+            v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{zone(v1.NodeSelectorOpIn, "b")}},
+            v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{zone(v1.NodeSelectorOpNotIn, "b")}},
+        ), true},
+        {"empty term matches nothing", requiredNodeAffinity(v1.NodeSelectorTerm{}), false},
+        {"matchFields on the name", requiredNodeAffinity(v1.NodeSelectorTerm{
+            MatchFields: []v1.NodeSelectorRequirement{name(v1.NodeSelectorOpIn, "node-a")},
+        }), true},
+        {"matchFields on another name", requiredNodeAffinity(v1.NodeSelectorTerm{
+            MatchFields: []v1.NodeSelectorRequirement{name(v1.NodeSelectorOpNotIn, "node-a")},
+        }), false},
+        {"matchFields on another field", requiredNodeAffinity(v1.NodeSelectorTerm{
+            MatchFields: []v1.NodeSelectorRequirement{{Key: "metadata.uid", Operator: v1.NodeSelectorOpExists}},
+        }), false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            p := v1.Pod{Spec: v1.PodSpec{Affinity: tt.affinity}}
+            if got := matchesNodeAffinity(p, node); got != tt.expected {
+                t.Errorf("matchesNodeAffinity = %v, want %v", got, tt.expected)
+            }
+        })
+    }
+}
+
+func TestToleratesTaints(t *testing.T) {
+    taint := func(effect v1.TaintEffect) v1.Taint {
+        return v1.Taint{Key: "dedicated", Value: "gpu", Effect: effect}
+    }
+    tests := []struct {
+        name        string
+        taints      []v1.Taint
+        tolerations []v1.Toleration
+        expected    bool
+    }{
+        {"no taints", nil, nil, true},
+        {"NoSchedule", []v1.Taint{taint(v1.TaintEffectNoSchedule)}, nil, false},
+        {"NoExecute", []v1.Taint{taint(v1.TaintEffectNoExecute)}, nil, false},
+        {"PreferNoSchedule is ignored", []v1.Taint{taint(v1.TaintEffectPreferNoSchedule)}, nil, true},
+        {"tolerated by value", []v1.Taint{taint(v1.TaintEffectNoSchedule)}, []v1.Toleration{{
+            Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "gpu", Effect: v1.TaintEffectNoSchedule,
+        }}, true},
+        {"other value", []v1.Taint{taint(v1.TaintEffectNoSchedule)}, []v1.Toleration{{
+            Key: "dedicated", Operator: v1.TolerationOpEqual, Value: "db", Effect: v1.TaintEffectNoSchedule,
+        }}, false},
+        {"tolerated by Exists", []v1.Taint{taint(v1.TaintEffectNoExecute)}, []v1.Toleration{{
+            Key: "dedicated", Operator: v1.TolerationOpExists,
+        }}, true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            n := testNode("node-a", "4", "8Gi", nil)
+            n.Spec.Taints = tt.taints
+            p := v1.Pod{Spec: v1.PodSpec{Tolerations: tt.tolerations}}
+            if got := toleratesTaints(p, n); got != tt.expected {
+                t.Errorf("toleratesTaints = %v, want %v", got, tt.expected)
+            }
+        })
+    }
+}
+
+func TestAntiAffinityConflict(t *testing.T) {
+    zoneA := testNode("node-a", "4", "8Gi", map[string]string{"zone": "a"})
+    zoneA2 := testNode("node-a2", "4", "8Gi", map[string]string{"zone": "a"})
+    zoneB := testNode("node-b", "4", "8Gi", map[string]string{"zone": "b"})
+
+    owner := testSimPod("web-0", "", "100m", "64Mi")
+    owner.Labels = map[string]string{"app": "web"}
+    owner.Spec.Affinity = antiAffinity("web", "zone")
+    other := testSimPod("web-1", "", "100m", "64Mi")
+    other.Labels = map[string]string{"app": "web"}
+
+    elsewhere := other
+    elsewhere.Namespace = "blog"
+    listed := owner
+    listed.Spec.Affinity = antiAffinity("web", "zone")
+    listed.Spec.Affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution[0].Namespaces = []string{"blog"}
+    unlabelled := other
+    unlabelled.Labels = map[string]string{"app": "api"}
+
+    tests := []struct {
+        name         string
+        owner, other v1.Pod
+        otherNode    v1.Node
+        expected     bool
+    }{
+        {"same domain", owner, other, zoneA2, true},
+        {"other domain", owner, other, zoneB, false},
+        {"other labels", owner, unlabelled, zoneA, false},
+        {"other namespace", owner, elsewhere, zoneA, false},
+        {"listed namespace", listed, elsewhere, zoneA, true},
+        {"no anti-affinity", other, owner, zoneA, false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := antiAffinityConflict(tt.owner, tt.other, zoneA, tt.otherNode); got != tt.expected {
+                t.Errorf("antiAffinityConflict = %v, want %v", got, tt.expected)
+            }
+        })
+    }
+
+    // The terms of pods already placed apply to an incoming pod without
+    // terms of its own.
+    nodes := map[string]*simNode{
+        "node-a":  {node: zoneA, pods: []v1.Pod{owner}},
+        "node-a2": {node: zoneA2},
+        "node-b":  {node: zoneB},
+    }
+    if !violatesAntiAffinity(other, nodes["node-a2"], nodes) {
+        t.Error("placing web-1 next to web-0's zone did not violate web-0's anti-affinity")
+    }
+    if violatesAntiAffinity(other, nodes["node-b"], nodes) {
+        t.Error("placing web-1 in another zone violated web-0's anti-affinity")
+    }
+}
+
+func TestFindFit(t *testing.T) {
+    tainted := testNode("node-b", "4", "8Gi", nil)
+    tainted.Spec.Taints = []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}}
+    cordoned := testNode("node-c", "4", "8Gi", nil)
+    cordoned.Spec.Unschedulable = true
+    full := testNode("node-d", "4", "8Gi", nil)
+    full.Status.Allocatable[v1.ResourcePods] = resource.MustParse("0")
+
+    nodes := map[string]*simNode{
+        "node-a": {node: testNode("node-a", "1", "1Gi", map[string]string{"pool": "small"}), cpuFree: 500, memFree: 512 << 20, podFree: 10},
+        "node-b": {node: tainted, cpuFree: 4000, memFree: 8 << 30, podFree: 10},
+        "node-c": {node: cordoned, cpuFree: 4000, memFree: 8 << 30, podFree: 10},
+        "node-d": {node: full, cpuFree: 4000, memFree: 8 << 30, podFree: 0},
+    }
+    order := []string{"node-a", "node-b", "node-c", "node-d"}
+
+    small := testSimPod("small", "", "100m", "64Mi")
+    big := testSimPod("big", "", "2", "1Gi")
+    tolerating := big
+    tolerating.Spec.Tolerations = []v1.Toleration{{Key: "dedicated", Operator: v1.TolerationOpExists}}
+    selecting := small
+    selecting.Spec.NodeSelector = map[string]string{"pool": "large"}
+    withSidecar := small
+    withSidecar.Spec.InitContainers = []v1.Container{sidecar(testContainer("proxy", "450m", "64Mi"))}
+
+    tests := []struct {
+        name     string
+        pod      v1.Pod
+        expected string
+    }{
+        {"first node with room", small, "node-a"},
+        {"no room, tainted, cordoned or full", big, ""},
+        {"tolerates the taint", tolerating, "node-b"},
+        {"nodeSelector", selecting, ""},
+        {"sidecar requests count", withSidecar, ""},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := ""
+            if sn := findFit(tt.pod, nodes, order); sn != nil {
+                got = sn.node.Name
+            }
+            if got != tt.expected {
+                t.Errorf("findFit = %q, want %q", got, tt.expected)
+            }
+        })
+    }
+}
+
+func TestSimulateScaleIn(t *testing.T) {
+    daemon := testSimPod("agent", "node-c", "3", "1Gi")
+    daemon.OwnerReferences = []metav1.OwnerReference{{Kind: "DaemonSet", Name: "agent"}}
+    pinned := testSimPod("pinned", "node-c", "100m", "64Mi")
+    pinned.Spec.NodeSelector = map[string]string{"disk": "ssd"}
+    tainted := testNode("node-b", "4", "8Gi", nil)
+    tainted.Spec.Taints = []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectNoSchedule}}
+    spread := testSimPod("web-1", "node-c", "100m", "64Mi")
+    spread.Labels = map[string]string{"app": "web"}
+    spread.Spec.Affinity = antiAffinity("web", "kubernetes.io/hostname")
+    placed := testSimPod("web-0", "node-a", "100m", "64Mi")
+    placed.Labels = map[string]string{"app": "web"}
+    meshed := testSimPod("meshed", "node-c", "100m", "64Mi")
+    meshed.Spec.InitContainers = []v1.Container{sidecar(testContainer("proxy", "900m", "64Mi"))}
+
+    hostname := func(n v1.Node) v1.Node {
+        n.Labels = map[string]string{"kubernetes.io/hostname": n.Name}
+        return n
+    }
+
+    tests := []struct {
+        name       string
+        nodes      []v1.Node
+        pods       []v1.Pod
+        candidates []string
+        removable  []string
+        blocked    []string
+    }{
+        {
+            name:       "pods move to the remaining node",
+            nodes:      []v1.Node{testNode("node-a", "2", "4Gi", nil), testNode("node-c", "2", "4Gi", nil)},
+            pods:       []v1.Pod{testSimPod("web-0", "node-c", "500m", "1Gi"), daemon},
+            candidates: []string{"node-c"},
+            removable:  []string{"node-c"},
+        },
+        {
+            name:       "nodeSelector",
+            nodes:      []v1.Node{testNode("node-a", "2", "4Gi", nil), testNode("node-c", "2", "4Gi", map[string]string{"disk": "ssd"})},
+            pods:       []v1.Pod{pinned},
+            candidates: []string{"node-c"},
+            blocked:    []string{"node-c"},
+        },
+        {
+            name:       "taint",
+            nodes:      []v1.Node{tainted, testNode("node-c", "2", "4Gi", nil)},
+            pods:       []v1.Pod{testSimPod("web-0", "node-c", "500m", "1Gi")},
+            candidates: []string{"node-c"},
+            blocked:    []string{"node-c"},
+        },
+        {
+            name:       "anti-affinity",
+            nodes:      []v1.Node{hostname(testNode("node-a", "2", "4Gi", nil)), hostname(testNode("node-c", "2", "4Gi", nil))},
+            pods:       []v1.Pod{placed, spread},
+            candidates: []string{"node-c"},
+            blocked:    []string{"node-c"},
+        },
+        {
+            name:  "earlier removals use up capacity",
+            nodes: []v1.Node{testNode("node-a", "2", "4Gi", nil), testNode("node-b", "2", "4Gi", nil), testNode("node-c", "2", "4Gi", nil)},
+            pods: []v1.Pod{
+                testSimPod("web-0", "node-a", "1", "1Gi"),
+                testSimPod("web-1", "node-b", "600m", "1Gi"),
+                testSimPod("web-2", "node-c", "800m", "1Gi"),
+            },
+            candidates: []string{"node-c", "node-b"},
+            removable:  []string{"node-b"},
+            blocked:    []string{"node-c"},
+        },
+        {
+            name:       "sidecar",
+            nodes:      []v1.Node{testNode("node-a", "1", "4Gi", nil), testNode("node-c", "2", "4Gi", nil)},
+            pods:       []v1.Pod{testSimPod("web-0", "node-a", "500m", "1Gi"), meshed},
+            candidates: []string{"node-c"},
+            blocked:    []string{"node-c"},
+        },
+        {
+            name:       "unknown node",
+            nodes:      []v1.Node{testNode("node-a", "2", "4Gi", nil)},
+            candidates: []string{"node-x"},
+            blocked:    []string{"node-x"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            result := SimulateScaleIn(tt.nodes, tt.pods, tt.candidates)
+            if result.Candidates != len(tt.candidates) {
+                t.Errorf("Candidates = %d, want %d", result.Candidates, len(tt.candidates))
+            }
+            if !reflect.DeepEqual(result.Removable, tt.removable) {
+                t.Errorf("Removable = %v, want %v", result.Removable, tt.removable)
+            }
+            var blocked []string
+            for name := range result.Blocked {
+                blocked = append(blocked, name)
+            }
+            if !reflect.DeepEqual(blocked, tt.blocked) {
+                t.Errorf("Blocked = %v, want %v", result.Blocked, tt.blocked)
+            }
+        })
+    }
+}
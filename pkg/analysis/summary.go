@@ -0,0 +1,25 @@
+package analysis
+
+// ClusterSummary holds cluster-wide totals across all nodes.
+type ClusterSummary struct {
+    CPUAllocMilli int64 `json:"cpuAllocatableMillicores"`
+    CPUReqMilli   int64 `json:"cpuRequestMillicores"`
+    CPUUsedMilli  int64 `json:"cpuUsedMillicores"`
+    MemAllocMi    int64 `json:"memoryAllocatableMebibytes"`
+    MemReqMi      int64 `json:"memoryRequestMebibytes"`
+    MemUsedMi     int64 `json:"memoryUsedMebibytes"`
+}
+
+// Summarize totals allocatable, requested and used resources across nodes.
+func Summarize(nodes []NodeStat) ClusterSummary {
+    var s ClusterSummary
+    for _, n := range nodes {
+        s.CPUAllocMilli += n.CPUAllocMilli
+        s.CPUReqMilli += n.CPUReqMilli
+        s.CPUUsedMilli += n.CPUUsedMilli
+        s.MemAllocMi += n.MemAllocMi
+        s.MemReqMi += n.MemReqMi
+        s.MemUsedMi += n.MemUsedMi
+    }
+    return s
+}
@@ -0,0 +1,126 @@
+package analysis
+
+import "sort"
+
+// WorkloadStat aggregates the pods of a top-level workload of any kind:
+// Deployment, StatefulSet, DaemonSet, Job, CronJob, ReplicaSet, a custom
+// controller, or a bare Pod.
+type WorkloadStat struct {
+    Kind         string  `json:"kind"`
+    Namespace    string  `json:"namespace"`
+    Name         string  `json:"name"`
+    CPUReqMilli  int64   `json:"cpuRequestMillicores"`
+    CPUUsedMilli int64   `json:"cpuUsedMillicores"`
+    MemReqMi     int64   `json:"memoryRequestMebibytes"`
+    MemUsedMi    int64   `json:"memoryUsedMebibytes"`
+    PodCount     int     `json:"podCount"`
+    NodeCount    int     `json:"nodeCount"`
+    WasteCPU     float64 `json:"wasteCPU"`
+    WasteMem     float64 `json:"wasteMemory"`
+    // Sum of container limits, their ratio to the requests of the containers
+    // that set them and the number of pods that set no limits.
+    CPULimitMilli     int64   `json:"cpuLimitMillicores"`
+    MemLimitMi        int64   `json:"memoryLimitMebibytes"`
+    CPULimitRatio     float64 `json:"cpuLimitRatio"`
+    MemLimitRatio     float64 `json:"memoryLimitRatio"`
+    PodsWithoutLimits int     `json:"podsWithoutLimits"`
+}
+
+// Key returns the namespace/kind/name key of the workload.
+func (w WorkloadStat) Key() string {
+    return w.Namespace + "/" + w.Kind + "/" + w.Name
+}
+
+// WorkloadAggregation aggregates pods by their top-level workload, ordered by
+// namespace, kind and name.
+func WorkloadAggregation(pods []PodRecord) []WorkloadStat {
+    m := make(map[string]*WorkloadStat)
+    nodes := make(map[string]map[string]bool)
+    // Requests of the containers that set a CPU or memory limit.
+    limitedCPUReq := make(map[string]int64)
+    limitedMemReq := make(map[string]int64)
+    for _, p := range pods {
+        key := p.Namespace + "/" + p.WorkloadKind + "/" + p.WorkloadName
+        w, ok := m[key]
+        if !ok {
+            w = &WorkloadStat{
+                Kind:      p.WorkloadKind,
+                Namespace: p.Namespace,
+                Name:      p.WorkloadName,
+            }
+            m[key] = w
+            nodes[key] = make(map[string]bool)
+        }
+        w.PodCount++
+        w.CPUReqMilli += p.CPUReqMilli
+        w.CPUUsedMilli += p.CPUUsedMilli
+        w.MemReqMi += p.MemReqMi
+        w.MemUsedMi += p.MemUsedMi
+        w.CPULimitMilli += p.CPULimitMilli
+        w.MemLimitMi += p.MemLimitMi
+        if p.NoLimits {
+            w.PodsWithoutLimits++
+        }
+        for _, c := range p.Containers {
+            if c.CPULimitMilli > 0 {
+                limitedCPUReq[key] += c.CPUReqMilli
+            }
+            if c.MemLimitMi > 0 {
+                limitedMemReq[key] += c.MemReqMi
+            }
+        }
+        if p.NodeName != "" {
+            nodes[key][p.NodeName] = true
+        }
+    }
+    var workloads []WorkloadStat
+    for key, w := range m {
+        w.NodeCount = len(nodes[key])
+        if w.CPUReqMilli > 0 {
+            w.WasteCPU = (1.0 - float64(w.CPUUsedMilli)/float64(w.CPUReqMilli)) * 100
+        }
+        if w.MemReqMi > 0 {
+            w.WasteMem = (1.0 - float64(w.MemUsedMi)/float64(w.MemReqMi)) * 100
+        }
+        if req := limitedCPUReq[key]; req > 0 {
+            w.CPULimitRatio = float64(w.CPULimitMilli) / float64(req)
+        }
+        if req := limitedMemReq[key]; req > 0 {
+            w.MemLimitRatio = float64(w.MemLimitMi) / float64(req)
+        }
+        workloads = append(workloads, *w)
+    }
+    sort.Slice(workloads, func(i, j int) bool {
+        return workloads[i].Key() < workloads[j].Key()
+    })
+    return workloads
+}
+
+// DaemonSetAggregation aggregates the DaemonSet pods, ordered by total CPU
+// and memory requests, largest first.
+func DaemonSetAggregation(pods []PodRecord) []WorkloadStat {
+    var daemonSets []WorkloadStat
+    for _, w := range WorkloadAggregation(pods) {
+        if w.Kind == "DaemonSet" {
+            daemonSets = append(daemonSets, w)
+        }
+    }
+    sort.SliceStable(daemonSets, func(i, j int) bool {
+        if daemonSets[i].CPUReqMilli != daemonSets[j].CPUReqMilli {
+            return daemonSets[i].CPUReqMilli > daemonSets[j].CPUReqMilli
+        }
+        return daemonSets[i].MemReqMi > daemonSets[j].MemReqMi
+    })
+    return daemonSets
+}
+
+// WithoutDaemonSets returns the pods that are not run by a DaemonSet.
+func WithoutDaemonSets(pods []PodRecord) []PodRecord {
+    var out []PodRecord
+    for _, p := range pods {
+        if !p.IsDaemonSet {
+            out = append(out, p)
+        }
+    }
+    return out
+}
@@ -0,0 +1,270 @@
+package cost
+
+import (
+    "fmt"
+    "sort"
+
+    "kcap/pkg/analysis"
+)
+
+// NodeCost is the monthly cost of a node. Allocated is the cost of the
+// resources requested by its pods, Used the cost of the resources they use
+// and Idle the cost of capacity no pod requests.
+type NodeCost struct {
+    Name         string  `json:"name"`
+    InstanceType string  `json:"instanceType"`
+    Hourly       float64 `json:"hourly"`
+    Monthly      float64 `json:"monthly"`
+    Allocated    float64 `json:"allocated"`
+    Used         float64 `json:"used"`
+    Idle         float64 `json:"idle"`
+}
+
+// NamespaceCost is the monthly cost of the pods in a namespace. Waste is the
+// cost of requested resources that are not used.
+type NamespaceCost struct {
+    Namespace string  `json:"namespace"`
+    PodCount  int     `json:"podCount"`
+    Allocated float64 `json:"allocated"`
+    Used      float64 `json:"used"`
+    Waste     float64 `json:"waste"`
+}
+
+// WorkloadCost is the monthly cost of the pods of a top-level workload.
+type WorkloadCost struct {
+    Kind      string  `json:"kind"`
+    Namespace string  `json:"namespace"`
+    Name      string  `json:"name"`
+    PodCount  int     `json:"podCount"`
+    Allocated float64 `json:"allocated"`
+    Used      float64 `json:"used"`
+    Waste     float64 `json:"waste"`
+}
+
+// DaemonSetCost is the monthly cost of the requests of a DaemonSet across
+// all the nodes it runs on.
+type DaemonSetCost struct {
+    Namespace      string  `json:"namespace"`
+    Name           string  `json:"name"`
+    Nodes          int     `json:"nodes"`
+    CPUReqMilli    int64   `json:"cpuRequestMillicores"`
+    MemReqMi       int64   `json:"memoryRequestMebibytes"`
+    PerNodeMonthly float64 `json:"perNodeMonthly"`
+    Monthly        float64 `json:"monthly"`
+}
+
+// RecommendationSavings is the monthly saving of applying a recommendation.
+type RecommendationSavings struct {
+    Type           string  `json:"type"`
+    Details        string  `json:"details"`
+    Severity       string  `json:"severity"`
+    MonthlySavings float64 `json:"monthlySavings"`
+}
+
+// Totals sums the monthly cost of the cluster. Savings from removing nodes
+// and from right-sizing requests are totalled apart: right-sizing frees
+// capacity that node removal then saves, so the two do not add up.
+type Totals struct {
+    Monthly            float64 `json:"monthly"`
+    Allocated          float64 `json:"allocated"`
+    Used               float64 `json:"used"`
+    Idle               float64 `json:"idle"`
+    NodeRemovalSavings float64 `json:"nodeRemovalSavings"`
+    RightsizingSavings float64 `json:"rightsizingSavings"`
+}
+
+// Report is the cost breakdown of an analysis.
+type Report struct {
+    Currency        string                  `json:"currency"`
+    Totals          Totals                  `json:"totals"`
+    Nodes           []NodeCost              `json:"nodes"`
+    Namespaces      []NamespaceCost         `json:"namespaces"`
+    Workloads       []WorkloadCost          `json:"workloads"`
+    DaemonSets      []DaemonSetCost         `json:"daemonSets"`
+    Recommendations []RecommendationSavings `json:"recommendations"`
+}
+
+// Compute prices an analysis. Pods are priced at the unit rates of the node
+// they run on; pods without a known node use the default rate. Only
+// recommendations that save money are reported, and scale-in candidates
+// only if their drain is not blocked.
+func Compute(a analysis.Analysis, p *Pricing) Report {
+    report := Report{Currency: p.Currency}
+
+    rates := make(map[string]UnitRate, len(a.Nodes))
+    for _, n := range a.Nodes {
+        rate := p.UnitRateFor(n.Labels, n.CPUAllocMilli, n.MemAllocMi)
+        rates[n.Name] = rate
+
+        instanceType := n.Labels[InstanceTypeLabel]
+        if instanceType == "" {
+            instanceType = n.Labels[LegacyInstanceTypeLabel]
+        }
+        hourly := rate.Hourly(n.CPUAllocMilli, n.MemAllocMi)
+        nc := NodeCost{
+            Name:         n.Name,
+            InstanceType: instanceType,
+            Hourly:       hourly,
+            Monthly:      hourly * HoursPerMonth,
+            Allocated:    rate.Hourly(min(n.CPUReqMilli, n.CPUAllocMilli), min(n.MemReqMi, n.MemAllocMi)) * HoursPerMonth,
+            Used:         rate.Hourly(n.CPUUsedMilli, n.MemUsedMi) * HoursPerMonth,
+        }
+        nc.Idle = nc.Monthly - nc.Allocated
+        report.Nodes = append(report.Nodes, nc)
+
+        report.Totals.Monthly += nc.Monthly
+        report.Totals.Allocated += nc.Allocated
+        report.Totals.Used += nc.Used
+        report.Totals.Idle += nc.Idle
+    }
+    sort.Slice(report.Nodes, func(i, j int) bool {
+        return report.Nodes[i].Name < report.Nodes[j].Name
+    })
+
+    defaultRate := UnitRate{CPUCoreHourly: p.Default.CPUCoreHourly, MemGiBHourly: p.Default.MemGiBHourly}
+    rateOf := func(node string) UnitRate {
+        if r, ok := rates[node]; ok {
+            return r
+        }
+        return defaultRate
+    }
+
+    namespaces := make(map[string]*NamespaceCost)
+    workloads := make(map[string]*WorkloadCost)
+    podNodes := make(map[string]string, len(a.Pods))
+    for _, pod := range a.Pods {
+        podNodes[pod.Namespace+"/"+pod.Name] = pod.NodeName
+        rate := rateOf(pod.NodeName)
+        allocated := rate.Hourly(pod.CPUReqMilli, pod.MemReqMi) * HoursPerMonth
+        used := rate.Hourly(pod.CPUUsedMilli, pod.MemUsedMi) * HoursPerMonth
+        waste := rate.Hourly(max(pod.CPUReqMilli-pod.CPUUsedMilli, 0), max(pod.MemReqMi-pod.MemUsedMi, 0)) * HoursPerMonth
+
+        ns, ok := namespaces[pod.Namespace]
+        if !ok {
+            ns = &NamespaceCost{Namespace: pod.Namespace}
+            namespaces[pod.Namespace] = ns
+        }
+        ns.PodCount++
+        ns.Allocated += allocated
+        ns.Used += used
+        ns.Waste += waste
+
+        key := pod.Namespace + "/" + pod.WorkloadKind + "/" + pod.WorkloadName
+        w, ok := workloads[key]
+        if !ok {
+            w = &WorkloadCost{Kind: pod.WorkloadKind, Namespace: pod.Namespace, Name: pod.WorkloadName}
+            workloads[key] = w
+        }
+        w.PodCount++
+        w.Allocated += allocated
+        w.Used += used
+        w.Waste += waste
+    }
+    for _, ns := range namespaces {
+        report.Namespaces = append(report.Namespaces, *ns)
+    }
+    sort.Slice(report.Namespaces, func(i, j int) bool {
+        if report.Namespaces[i].Allocated != report.Namespaces[j].Allocated {
+            return report.Namespaces[i].Allocated > report.Namespaces[j].Allocated
+        }
+        return report.Namespaces[i].Namespace < report.Namespaces[j].Namespace
+    })
+    for _, w := range workloads {
+        report.Workloads = append(report.Workloads, *w)
+    }
+    sort.Slice(report.Workloads, func(i, j int) bool {
+        if report.Workloads[i].Waste != report.Workloads[j].Waste {
+            return report.Workloads[i].Waste > report.Workloads[j].Waste
+        }
+        wi, wj := report.Workloads[i], report.Workloads[j]
+        return wi.Namespace+"/"+wi.Kind+"/"+wi.Name < wj.Namespace+"/"+wj.Kind+"/"+wj.Name
+    })
+
+    report.DaemonSets = daemonSetCosts(a.DaemonSets, averageRate(rates, defaultRate))
+
+    nodeMonthly := make(map[string]float64, len(report.Nodes))
+    for _, n := range report.Nodes {
+        nodeMonthly[n.Name] = n.Monthly
+    }
+    for _, r := range a.Recommendations {
+        var savings float64
+        nodeRemoval := r.Type == "Scale-in candidate"
+        switch {
+        case nodeRemoval:
+            if r.Drain != nil && r.Drain.Risk == analysis.DrainBlocked {
+                continue
+            }
+            savings = nodeMonthly[r.Node]
+        case r.Savings <= 0:
+            // Request increases cost money rather than save it.
+            continue
+        case r.Resource == "cpu":
+            savings = rateOf(podNodes[r.Namespace+"/"+r.Pod]).Hourly(r.Savings, 0) * HoursPerMonth
+        case r.Resource == "memory":
+            savings = rateOf(podNodes[r.Namespace+"/"+r.Pod]).Hourly(0, r.Savings) * HoursPerMonth
+        }
+        if savings <= 0 {
+            continue
+        }
+        report.Recommendations = append(report.Recommendations, RecommendationSavings{
+            Type:           r.Type,
+            Details:        r.Details,
+            Severity:       r.Severity,
+            MonthlySavings: savings,
+        })
+        if nodeRemoval {
+            report.Totals.NodeRemovalSavings += savings
+        } else {
+            report.Totals.RightsizingSavings += savings
+        }
+    }
+    sort.SliceStable(report.Recommendations, func(i, j int) bool {
+        return report.Recommendations[i].MonthlySavings > report.Recommendations[j].MonthlySavings
+    })
+    return report
+}
+
+// daemonSetCosts prices DaemonSets at one rate, ordered by monthly cost,
+// largest first.
+func daemonSetCosts(daemonSets []analysis.WorkloadStat, rate UnitRate) []DaemonSetCost {
+    var out []DaemonSetCost
+    for _, d := range daemonSets {
+        dc := DaemonSetCost{
+            Namespace:   d.Namespace,
+            Name:        d.Name,
+            Nodes:       d.NodeCount,
+            CPUReqMilli: d.CPUReqMilli,
+            MemReqMi:    d.MemReqMi,
+            Monthly:     rate.Hourly(d.CPUReqMilli, d.MemReqMi) * HoursPerMonth,
+        }
+        if d.NodeCount > 0 {
+            dc.PerNodeMonthly = dc.Monthly / float64(d.NodeCount)
+        }
+        out = append(out, dc)
+    }
+    sort.SliceStable(out, func(i, j int) bool {
+        return out[i].Monthly > out[j].Monthly
+    })
+    return out
+}
+
+// averageRate returns the mean of the node rates, or def without nodes. A
+// DaemonSet runs on most nodes, so it is priced at the fleet's average rate.
+func averageRate(rates map[string]UnitRate, def UnitRate) UnitRate {
+    if len(rates) == 0 {
+        return def
+    }
+    var avg UnitRate
+    for _, r := range rates {
+        avg.CPUCoreHourly += r.CPUCoreHourly
+        avg.MemGiBHourly += r.MemGiBHourly
+    }
+    avg.CPUCoreHourly /= float64(len(rates))
+    avg.MemGiBHourly /= float64(len(rates))
+    return avg
+}
+
+// FormatMoney renders an amount in the report currency, e.g. "$12.34".
+func (r Report) FormatMoney(v float64) string {
+    return fmt.Sprintf("%s%.2f", r.Currency, v)
+}
@@ -0,0 +1,146 @@
+package cost
+
+import (
+    "fmt"
+    "os"
+
+    "sigs.k8s.io/yaml"
+)
+
+const (
+    HoursPerMonth = 730.0
+
+    // Blended on-demand rates used when no pricing file is given.
+    DefaultCPUCoreHourly = 0.0316 // per vCPU-hour
+    DefaultMemGiBHourly  = 0.0042 // per GiB-hour
+
+    InstanceTypeLabel       = "node.kubernetes.io/instance-type"
+    LegacyInstanceTypeLabel = "beta.kubernetes.io/instance-type"
+)
+
+// Rate is an hourly price. Either NodeHourly prices the whole node, or
+// CPUCoreHourly and MemGiBHourly price its resources.
+type Rate struct {
+    NodeHourly    float64 `json:"nodeHourly,omitempty"`
+    CPUCoreHourly float64 `json:"cpuCoreHourly,omitempty"`
+    MemGiBHourly  float64 `json:"memoryGiBHourly,omitempty"`
+}
+
+// LabelRate applies a rate to nodes carrying all of the given labels.
+type LabelRate struct {
+    Labels map[string]string `json:"labels"`
+    Rate
+}
+
+// Pricing maps nodes to rates. Label rules are tried first, in order, then
+// the node's instance type, then the default blended rate.
+type Pricing struct {
+    Currency      string          `json:"currency,omitempty"`
+    Default       Rate            `json:"default"`
+    InstanceTypes map[string]Rate `json:"instanceTypes,omitempty"`
+    Labels        []LabelRate     `json:"labels,omitempty"`
+}
+
+// UnitRate is the hourly price of one CPU core and one GiB of memory on a node.
+type UnitRate struct {
+    CPUCoreHourly float64
+    MemGiBHourly  float64
+}
+
+// DefaultPricing returns pricing with the built-in blended rates only.
+func DefaultPricing() *Pricing {
+    return &Pricing{
+        Currency: "$",
+        Default:  Rate{CPUCoreHourly: DefaultCPUCoreHourly, MemGiBHourly: DefaultMemGiBHourly},
+    }
+}
+
+// LoadPricing reads a pricing file. Missing default rates fall back to the
+// built-in blended rates.
+func LoadPricing(path string) (*Pricing, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    p := DefaultPricing()
+    p.Default = Rate{}
+    if err := yaml.UnmarshalStrict(data, p); err != nil {
+        return nil, fmt.Errorf("parsing pricing file %s: %w", path, err)
+    }
+    if p.Default.CPUCoreHourly == 0 {
+        p.Default.CPUCoreHourly = DefaultCPUCoreHourly
+    }
+    if p.Default.MemGiBHourly == 0 {
+        p.Default.MemGiBHourly = DefaultMemGiBHourly
+    }
+    if p.Default.NodeHourly != 0 {
+        return nil, fmt.Errorf("parsing pricing file %s: default rate must be per CPU core and GiB, not per node", path)
+    }
+    return p, nil
+}
+
+// RateFor returns the rate matching a node's labels.
+func (p *Pricing) RateFor(labels map[string]string) Rate {
+    for _, rule := range p.Labels {
+        if matchesLabels(rule.Labels, labels) {
+            return rule.Rate
+        }
+    }
+    for _, key := range []string{InstanceTypeLabel, LegacyInstanceTypeLabel} {
+        if r, ok := p.InstanceTypes[labels[key]]; ok && labels[key] != "" {
+            return r
+        }
+    }
+    return p.Default
+}
+
+// UnitRateFor returns the per-core and per-GiB hourly prices of a node with the
+// given labels and allocatable resources. A whole-node price is split between
+// CPU and memory in the proportion of the default rates, so that the node's
+// allocatable resources add up to its price.
+func (p *Pricing) UnitRateFor(labels map[string]string, cpuAllocMilli, memAllocMi int64) UnitRate {
+    r := p.RateFor(labels)
+    if r.NodeHourly == 0 {
+        u := UnitRate{CPUCoreHourly: r.CPUCoreHourly, MemGiBHourly: r.MemGiBHourly}
+        if u.CPUCoreHourly == 0 {
+            u.CPUCoreHourly = p.Default.CPUCoreHourly
+        }
+        if u.MemGiBHourly == 0 {
+            u.MemGiBHourly = p.Default.MemGiBHourly
+        }
+        return u
+    }
+
+    cores := float64(cpuAllocMilli) / 1000
+    gib := float64(memAllocMi) / 1024
+    cpuWeight := cores * p.Default.CPUCoreHourly
+    memWeight := gib * p.Default.MemGiBHourly
+    if cpuWeight+memWeight == 0 {
+        return UnitRate{}
+    }
+    var u UnitRate
+    if cores > 0 {
+        u.CPUCoreHourly = r.NodeHourly * cpuWeight / (cpuWeight + memWeight) / cores
+    }
+    if gib > 0 {
+        u.MemGiBHourly = r.NodeHourly * memWeight / (cpuWeight + memWeight) / gib
+    }
+    return u
+}
+
+// Hourly returns the hourly price of the given CPU (m) and memory (Mi).
+func (u UnitRate) Hourly(cpuMilli, memMi int64) float64 {
+    return float64(cpuMilli)/1000*u.CPUCoreHourly + float64(memMi)/1024*u.MemGiBHourly
+}
+
+func matchesLabels(selector, labels map[string]string) bool {
+    if len(selector) == 0 {
+        return false
+    }
+    for k, v := range selector {
+        if labels[k] != v {
+            return false
+        }
+    }
+    return true
+}
@@ -2,12 +2,17 @@ package k8s
 
 import (
     "context"
+    "fmt"
     "os"
     "path/filepath"
 
+    appsv1 "k8s.io/api/apps/v1"
+    batchv1 "k8s.io/api/batch/v1"
     v1 "k8s.io/api/core/v1"
+    policyv1 "k8s.io/api/policy/v1"
     metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
     "k8s.io/apimachinery/pkg/api/resource"
+    "k8s.io/apimachinery/pkg/types"
     "k8s.io/client-go/kubernetes"
     "k8s.io/client-go/rest"
     "k8s.io/client-go/tools/clientcmd"
@@ -15,9 +20,36 @@ import (
     metricsv "k8s.io/metrics/pkg/apis/metrics/v1beta1"
 )
 
+// ClusterReader lists the cluster objects kcap analyzes. It is implemented
+// by K8sClient and by offline snapshots.
+type ClusterReader interface {
+    ListNodes(ctx context.Context) ([]v1.Node, error)
+    ListPods(ctx context.Context, namespace string) ([]v1.Pod, error)
+    ListPDBs(ctx context.Context, namespace string) ([]policyv1.PodDisruptionBudget, error)
+    ListDeployments(ctx context.Context, namespace string) ([]appsv1.Deployment, error)
+    ListNamespaces(ctx context.Context) ([]v1.Namespace, error)
+    GetNamespace(ctx context.Context, name string) (*v1.Namespace, error)
+    ListReplicaSets(ctx context.Context, namespace string) ([]appsv1.ReplicaSet, error)
+    ListJobs(ctx context.Context, namespace string) ([]batchv1.Job, error)
+    ListResourceQuotas(ctx context.Context, namespace string) ([]v1.ResourceQuota, error)
+    ListLimitRanges(ctx context.Context, namespace string) ([]v1.LimitRange, error)
+}
+
 type K8sClient struct {
-    Clientset     *kubernetes.Clientset
-    MetricsClient *metrics.Clientset
+    Clientset     kubernetes.Interface
+    MetricsClient metrics.Interface
+    // PageSize is the number of objects requested per List call; zero lists
+    // every collection in a single call.
+    PageSize int64
+    // Context is the kubeconfig context and Server the API server URL the
+    // client talks to; Context is empty in-cluster.
+    Context string
+    Server  string
+}
+
+// NewK8sClient wraps existing clientsets, e.g. fake clientsets in tests.
+func NewK8sClient(clientset kubernetes.Interface, metricsClient metrics.Interface) *K8sClient {
+    return &K8sClient{Clientset: clientset, MetricsClient: metricsClient, PageSize: DefaultPageSize}
 }
 
 // NewK8sClientWithConfig creates a Kubernetes clientset and a Metrics client,
@@ -39,11 +71,15 @@ func NewK8sClientWithConfig(kubeconfig string) (*K8sClient, error) {
         }
     }
 
+    var contextName string
     if kubeconfig != "" {
         cfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
         if err != nil {
             return nil, err
         }
+        if raw, err := clientcmd.LoadFromFile(kubeconfig); err == nil {
+            contextName = raw.CurrentContext
+        }
     } else {
         cfg, err = rest.InClusterConfig()
         if err != nil {
@@ -61,25 +97,115 @@ func NewK8sClientWithConfig(kubeconfig string) (*K8sClient, error) {
         return nil, err
     }
 
-    return &K8sClient{Clientset: clientset, MetricsClient: metricsClient}, nil
+    client := NewK8sClient(clientset, metricsClient)
+    client.Context = contextName
+    client.Server = cfg.Host
+    return client, nil
 }
 
 // ListNodes lists all nodes in the cluster.
 func (k *K8sClient) ListNodes(ctx context.Context) ([]v1.Node, error) {
-    nodes, err := k.Clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
-    if err != nil {
-        return nil, err
-    }
-    return nodes.Items, nil
+    return listPages(ctx, k.PageSize, func(ctx context.Context, opts metav1.ListOptions) ([]v1.Node, string, error) {
+        nodes, err := k.Clientset.CoreV1().Nodes().List(ctx, opts)
+        if err != nil {
+            return nil, "", err
+        }
+        return nodes.Items, nodes.Continue, nil
+    })
 }
 
 // ListPods lists all pods in a given namespace. Passing empty string lists all pods.
 func (k *K8sClient) ListPods(ctx context.Context, namespace string) ([]v1.Pod, error) {
-    pods, err := k.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
-    if err != nil {
-        return nil, err
-    }
-    return pods.Items, nil
+    return listPages(ctx, k.PageSize, func(ctx context.Context, opts metav1.ListOptions) ([]v1.Pod, string, error) {
+        pods, err := k.Clientset.CoreV1().Pods(namespace).List(ctx, opts)
+        if err != nil {
+            return nil, "", err
+        }
+        return pods.Items, pods.Continue, nil
+    })
+}
+
+// ListPDBs lists PodDisruptionBudgets in a given namespace. Passing empty string lists all PDBs.
+func (k *K8sClient) ListPDBs(ctx context.Context, namespace string) ([]policyv1.PodDisruptionBudget, error) {
+    return listPages(ctx, k.PageSize, func(ctx context.Context, opts metav1.ListOptions) ([]policyv1.PodDisruptionBudget, string, error) {
+        pdbs, err := k.Clientset.PolicyV1().PodDisruptionBudgets(namespace).List(ctx, opts)
+        if err != nil {
+            return nil, "", err
+        }
+        return pdbs.Items, pdbs.Continue, nil
+    })
+}
+
+// ListDeployments lists Deployments in a given namespace. Passing empty string lists all Deployments.
+func (k *K8sClient) ListDeployments(ctx context.Context, namespace string) ([]appsv1.Deployment, error) {
+    return listPages(ctx, k.PageSize, func(ctx context.Context, opts metav1.ListOptions) ([]appsv1.Deployment, string, error) {
+        deployments, err := k.Clientset.AppsV1().Deployments(namespace).List(ctx, opts)
+        if err != nil {
+            return nil, "", err
+        }
+        return deployments.Items, deployments.Continue, nil
+    })
+}
+
+// ListNamespaces lists all namespaces.
+func (k *K8sClient) ListNamespaces(ctx context.Context) ([]v1.Namespace, error) {
+    return listPages(ctx, k.PageSize, func(ctx context.Context, opts metav1.ListOptions) ([]v1.Namespace, string, error) {
+        namespaces, err := k.Clientset.CoreV1().Namespaces().List(ctx, opts)
+        if err != nil {
+            return nil, "", err
+        }
+        return namespaces.Items, namespaces.Continue, nil
+    })
+}
+
+// GetNamespace gets a single namespace, which needs no permission to list
+// every namespace.
+func (k *K8sClient) GetNamespace(ctx context.Context, name string) (*v1.Namespace, error) {
+    return k.Clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+}
+
+// ListReplicaSets lists ReplicaSets in a given namespace. Passing empty string lists all ReplicaSets.
+func (k *K8sClient) ListReplicaSets(ctx context.Context, namespace string) ([]appsv1.ReplicaSet, error) {
+    return listPages(ctx, k.PageSize, func(ctx context.Context, opts metav1.ListOptions) ([]appsv1.ReplicaSet, string, error) {
+        replicaSets, err := k.Clientset.AppsV1().ReplicaSets(namespace).List(ctx, opts)
+        if err != nil {
+            return nil, "", err
+        }
+        return replicaSets.Items, replicaSets.Continue, nil
+    })
+}
+
+// ListJobs lists Jobs in a given namespace. Passing empty string lists all Jobs.
+func (k *K8sClient) ListJobs(ctx context.Context, namespace string) ([]batchv1.Job, error) {
+    return listPages(ctx, k.PageSize, func(ctx context.Context, opts metav1.ListOptions) ([]batchv1.Job, string, error) {
+        jobs, err := k.Clientset.BatchV1().Jobs(namespace).List(ctx, opts)
+        if err != nil {
+            return nil, "", err
+        }
+        return jobs.Items, jobs.Continue, nil
+    })
+}
+
+// ListResourceQuotas lists ResourceQuotas in a given namespace. Passing empty string lists all ResourceQuotas.
+func (k *K8sClient) ListResourceQuotas(ctx context.Context, namespace string) ([]v1.ResourceQuota, error) {
+    return listPages(ctx, k.PageSize, func(ctx context.Context, opts metav1.ListOptions) ([]v1.ResourceQuota, string, error) {
+        quotas, err := k.Clientset.CoreV1().ResourceQuotas(namespace).List(ctx, opts)
+        if err != nil {
+            return nil, "", err
+        }
+        return quotas.Items, quotas.Continue, nil
+    })
+}
+
+// ListLimitRanges lists LimitRanges in a given namespace. Passing empty string lists all LimitRanges.
+func (k *K8sClient) ListLimitRanges(ctx context.Context, namespace string) ([]v1.LimitRange, error) {
+    return listPages(ctx, k.PageSize, func(ctx context.Context, opts metav1.ListOptions) ([]v1.LimitRange, string, error) {
+        limitRanges, err := k.Clientset.CoreV1().LimitRanges(namespace).List(ctx, opts)
+        if err != nil {
+            return nil, "", err
+        }
+        return limitRanges.Items, limitRanges.Continue, nil
+    })
 }
 
 // NodeMetrics fetches metrics usage for all nodes, keyed by node name.
@@ -95,19 +221,59 @@ func (k *K8sClient) NodeMetrics(ctx context.Context) (map[string]v1.ResourceList
     return metricsMap, nil
 }
 
-// PodMetrics fetches metrics usage for pods in the given namespace, keyed by pod name.
-func (k *K8sClient) PodMetrics(ctx context.Context, namespace string) (map[string]v1.ResourceList, error) {
+// PodMetrics fetches metrics usage for pods in the given namespace, keyed by pod namespace and name.
+func (k *K8sClient) PodMetrics(ctx context.Context, namespace string) (map[PodKey]v1.ResourceList, error) {
     podMetricsList, err := k.MetricsClient.MetricsV1beta1().PodMetricses(namespace).List(ctx, metav1.ListOptions{})
     if err != nil {
         return nil, err
     }
-    metricsMap := make(map[string]v1.ResourceList)
+    metricsMap := make(map[PodKey]v1.ResourceList)
     for _, pm := range podMetricsList.Items {
-        metricsMap[pm.Name] = aggregatePodContainerUsage(pm)
+        metricsMap[PodKey{Namespace: pm.Namespace, Name: pm.Name}] = aggregatePodContainerUsage(pm)
     }
     return metricsMap, nil
 }
 
+// ContainerMetrics fetches metrics usage for containers in the given namespace,
+// keyed by pod namespace and name and then container name.
+func (k *K8sClient) ContainerMetrics(ctx context.Context, namespace string) (map[PodKey]map[string]v1.ResourceList, error) {
+    podMetricsList, err := k.MetricsClient.MetricsV1beta1().PodMetricses(namespace).List(ctx, metav1.ListOptions{})
+    if err != nil {
+        return nil, err
+    }
+    metricsMap := make(map[PodKey]map[string]v1.ResourceList)
+    for _, pm := range podMetricsList.Items {
+        containers := make(map[string]v1.ResourceList, len(pm.Containers))
+        for _, c := range pm.Containers {
+            containers[c.Name] = c.Usage
+        }
+        metricsMap[PodKey{Namespace: pm.Namespace, Name: pm.Name}] = containers
+    }
+    return metricsMap, nil
+}
+
+// PatchWorkload submits a strategic-merge patch to a Deployment, StatefulSet
+// or DaemonSet. With dryRun the API server validates the patch without persisting it.
+func (k *K8sClient) PatchWorkload(ctx context.Context, kind, namespace, name string, data []byte, dryRun bool) error {
+    opts := metav1.PatchOptions{}
+    if dryRun {
+        opts.DryRun = []string{metav1.DryRunAll}
+    }
+    apps := k.Clientset.AppsV1()
+    var err error
+    switch kind {
+    case "Deployment":
+        _, err = apps.Deployments(namespace).Patch(ctx, name, types.StrategicMergePatchType, data, opts)
+    case "StatefulSet":
+        _, err = apps.StatefulSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, data, opts)
+    case "DaemonSet":
+        _, err = apps.DaemonSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, data, opts)
+    default:
+        err = fmt.Errorf("unsupported workload kind %q", kind)
+    }
+    return err
+}
+
 // aggregatePodContainerUsage sums CPU and memory usage of all containers in a pod metrics item.
 func aggregatePodContainerUsage(pm metricsv.PodMetrics) v1.ResourceList {
     cpuTotal := int64(0)
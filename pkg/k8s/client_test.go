@@ -0,0 +1,111 @@
+package k8s
+
+import (
+    "context"
+    "testing"
+
+    v1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/kubernetes/fake"
+    metricsv "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+    metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+var podMetricsResource = metricsv.SchemeGroupVersion.WithResource("pods")
+
+func testPod(namespace, name string) *v1.Pod {
+    return &v1.Pod{
+        ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+        Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "app"}}},
+    }
+}
+
+func testPodMetrics(namespace, name, cpu, memory string) *metricsv.PodMetrics {
+    return &metricsv.PodMetrics{
+        ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+        Containers: []metricsv.ContainerMetrics{{
+            Name: "app",
+            Usage: v1.ResourceList{
+                v1.ResourceCPU:    resource.MustParse(cpu),
+                v1.ResourceMemory: resource.MustParse(memory),
+            },
+        }},
+    }
+}
+
+// TestPodUsageIsKeyedByNamespace checks that pods sharing a name in
+// different namespaces are matched to their own usage.
+func TestPodUsageIsKeyedByNamespace(t *testing.T) {
+    ctx := context.Background()
+    metricsClient := metricsfake.NewSimpleClientset()
+    // The fake guesses the resource "podmetricses" from the kind, while
+    // the metrics API serves PodMetrics as "pods", so add them explicitly.
+    for _, pm := range []*metricsv.PodMetrics{
+        testPodMetrics("team-a", "web-0", "100m", "128Mi"),
+        testPodMetrics("team-b", "web-0", "900m", "1Gi"),
+    } {
+        if err := metricsClient.Tracker().Create(podMetricsResource, pm, pm.Namespace); err != nil {
+            t.Fatalf("adding pod metrics: %v", err)
+        }
+    }
+    client := NewK8sClient(
+        fake.NewSimpleClientset(testPod("team-a", "web-0"), testPod("team-b", "web-0")),
+        metricsClient,
+    )
+
+    pods, err := client.ListPods(ctx, "")
+    if err != nil {
+        t.Fatalf("ListPods: %v", err)
+    }
+    if len(pods) != 2 {
+        t.Fatalf("ListPods returned %d pods, want 2", len(pods))
+    }
+    podMetrics, err := client.PodMetrics(ctx, "")
+    if err != nil {
+        t.Fatalf("PodMetrics: %v", err)
+    }
+    containerMetrics, err := client.ContainerMetrics(ctx, "")
+    if err != nil {
+        t.Fatalf("ContainerMetrics: %v", err)
+    }
+
+    want := map[string]struct {
+        cpuMilli int64
+        memory   int64
+    }{
+        "team-a": {100, 128 * 1024 * 1024},
+        "team-b": {900, 1024 * 1024 * 1024},
+    }
+    for _, p := range pods {
+        key := KeyForPod(p)
+        w := want[p.Namespace]
+        usage, ok := podMetrics[key]
+        if !ok {
+            t.Errorf("no pod usage for %s", key)
+            continue
+        }
+        if got := usage.Cpu().MilliValue(); got != w.cpuMilli {
+            t.Errorf("%s cpu = %dm, want %dm", key, got, w.cpuMilli)
+        }
+        if got := usage.Memory().Value(); got != w.memory {
+            t.Errorf("%s memory = %d, want %d", key, got, w.memory)
+        }
+        container := containerMetrics[key]["app"]
+        if got := container.Cpu().MilliValue(); got != w.cpuMilli {
+            t.Errorf("%s container app cpu = %dm, want %dm", key, got, w.cpuMilli)
+        }
+    }
+
+    // Listing a single namespace returns only its pod's usage.
+    scoped, err := client.PodMetrics(ctx, "team-a")
+    if err != nil {
+        t.Fatalf("PodMetrics(team-a): %v", err)
+    }
+    if len(scoped) != 1 {
+        t.Fatalf("PodMetrics(team-a) returned %d pods, want 1", len(scoped))
+    }
+    if usage := scoped[PodKey{Namespace: "team-a", Name: "web-0"}]; usage.Cpu().MilliValue() != 100 {
+        t.Errorf("team-a/web-0 cpu = %dm, want 100m", usage.Cpu().MilliValue())
+    }
+}
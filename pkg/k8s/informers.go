@@ -0,0 +1,220 @@
+package k8s
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "time"
+
+    appsv1 "k8s.io/api/apps/v1"
+    batchv1 "k8s.io/api/batch/v1"
+    v1 "k8s.io/api/core/v1"
+    policyv1 "k8s.io/api/policy/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "k8s.io/client-go/informers"
+    "k8s.io/client-go/kubernetes"
+    "k8s.io/client-go/tools/cache"
+)
+
+// InformerReader is a ClusterReader served from shared informer caches. The
+// caches are filled once and then kept current by watches, so long-running
+// modes can read the cluster repeatedly without listing it again.
+type InformerReader struct {
+    // cluster informs on every namespace, factory on namespace only.
+    cluster   informers.SharedInformerFactory
+    factory   informers.SharedInformerFactory
+    informers map[string]cache.SharedIndexInformer
+    namespace string
+    // forbidden holds, per informer limited to namespace because listing
+    // every namespace is forbidden, the error returned for other namespaces.
+    forbidden map[string]error
+}
+
+// NewInformerReader creates informers for the objects kcap analyzes, limited
+// to namespace if set. Nodes and namespaces are always cluster-wide, and so
+// are pods and PodDisruptionBudgets, which node figures and drains count in
+// every namespace, unless listing them cluster-wide is forbidden. Managed
+// fields are dropped from cached objects to save memory.
+func NewInformerReader(ctx context.Context, clientset kubernetes.Interface, namespace string, resync time.Duration) *InformerReader {
+    cluster := informers.NewSharedInformerFactoryWithOptions(clientset, resync,
+        informers.WithTransform(dropManagedFields),
+    )
+    factory := cluster
+    if namespace != "" {
+        factory = informers.NewSharedInformerFactoryWithOptions(clientset, resync,
+            informers.WithNamespace(namespace),
+            informers.WithTransform(dropManagedFields),
+        )
+    }
+    r := &InformerReader{
+        cluster:   cluster,
+        factory:   factory,
+        namespace: namespace,
+        forbidden: make(map[string]error),
+        informers: map[string]cache.SharedIndexInformer{
+            "nodes":           factory.Core().V1().Nodes().Informer(),
+            "deployments":     factory.Apps().V1().Deployments().Informer(),
+            "namespaces":      factory.Core().V1().Namespaces().Informer(),
+            "replica sets":    factory.Apps().V1().ReplicaSets().Informer(),
+            "jobs":            factory.Batch().V1().Jobs().Informer(),
+            "resource quotas": factory.Core().V1().ResourceQuotas().Informer(),
+            "limit ranges":    factory.Core().V1().LimitRanges().Informer(),
+        },
+    }
+    r.informEveryNamespace(ctx, "pods", func(f informers.SharedInformerFactory) cache.SharedIndexInformer {
+        return f.Core().V1().Pods().Informer()
+    }, func(namespace string) error {
+        _, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{Limit: 1})
+        return err
+    })
+    r.informEveryNamespace(ctx, "pod disruption budgets", func(f informers.SharedInformerFactory) cache.SharedIndexInformer {
+        return f.Policy().V1().PodDisruptionBudgets().Informer()
+    }, func(namespace string) error {
+        _, err := clientset.PolicyV1().PodDisruptionBudgets(namespace).List(ctx, metav1.ListOptions{Limit: 1})
+        return err
+    })
+    return r
+}
+
+// informEveryNamespace adds the cluster-wide informer made by inform, or the
+// one limited to the reader's namespace if list, called for every namespace,
+// is forbidden.
+func (r *InformerReader) informEveryNamespace(ctx context.Context, name string, inform func(informers.SharedInformerFactory) cache.SharedIndexInformer, list func(namespace string) error) {
+    if r.namespace != "" {
+        if err := list(""); apierrors.IsForbidden(err) {
+            r.informers[name] = inform(r.factory)
+            r.forbidden[name] = err
+            return
+        }
+    }
+    r.informers[name] = inform(r.cluster)
+}
+
+// Start runs the informers until ctx is done and waits until the node and
+// pod caches are filled, which every analysis needs. The other caches fill in
+// the background; until they do, or if they never do because e.g. RBAC
+// forbids listing Jobs, their List calls return an error instead.
+func (r *InformerReader) Start(ctx context.Context, timeout time.Duration) error {
+    r.cluster.Start(ctx.Done())
+    r.factory.Start(ctx.Done())
+
+    syncCtx, cancel := context.WithTimeout(ctx, timeout)
+    defer cancel()
+    required := []string{"nodes", "pods"}
+    synced := make([]cache.InformerSynced, 0, len(required))
+    for _, name := range required {
+        synced = append(synced, r.informers[name].HasSynced)
+    }
+    cache.WaitForCacheSync(syncCtx.Done(), synced...)
+
+    for _, name := range required {
+        if !r.informers[name].HasSynced() {
+            return fmt.Errorf("%s cache not filled within %s", name, timeout)
+        }
+    }
+    return nil
+}
+
+func (r *InformerReader) ListNodes(ctx context.Context) ([]v1.Node, error) {
+    return listCached[v1.Node](r, "nodes", "")
+}
+
+func (r *InformerReader) ListPods(ctx context.Context, namespace string) ([]v1.Pod, error) {
+    return listCached[v1.Pod](r, "pods", namespace)
+}
+
+func (r *InformerReader) ListPDBs(ctx context.Context, namespace string) ([]policyv1.PodDisruptionBudget, error) {
+    return listCached[policyv1.PodDisruptionBudget](r, "pod disruption budgets", namespace)
+}
+
+func (r *InformerReader) ListDeployments(ctx context.Context, namespace string) ([]appsv1.Deployment, error) {
+    return listCached[appsv1.Deployment](r, "deployments", namespace)
+}
+
+func (r *InformerReader) ListNamespaces(ctx context.Context) ([]v1.Namespace, error) {
+    return listCached[v1.Namespace](r, "namespaces", "")
+}
+
+func (r *InformerReader) GetNamespace(ctx context.Context, name string) (*v1.Namespace, error) {
+    inf := r.informers["namespaces"]
+    if !inf.HasSynced() {
+        return nil, fmt.Errorf("namespaces cache not filled yet")
+    }
+    obj, ok, err := inf.GetStore().GetByKey(name)
+    if err != nil {
+        return nil, err
+    }
+    ns, isNamespace := obj.(*v1.Namespace)
+    if !ok || !isNamespace {
+        return nil, apierrors.NewNotFound(v1.Resource("namespaces"), name)
+    }
+    return ns, nil
+}
+
+func (r *InformerReader) ListReplicaSets(ctx context.Context, namespace string) ([]appsv1.ReplicaSet, error) {
+    return listCached[appsv1.ReplicaSet](r, "replica sets", namespace)
+}
+
+func (r *InformerReader) ListJobs(ctx context.Context, namespace string) ([]batchv1.Job, error) {
+    return listCached[batchv1.Job](r, "jobs", namespace)
+}
+
+func (r *InformerReader) ListResourceQuotas(ctx context.Context, namespace string) ([]v1.ResourceQuota, error) {
+    return listCached[v1.ResourceQuota](r, "resource quotas", namespace)
+}
+
+func (r *InformerReader) ListLimitRanges(ctx context.Context, namespace string) ([]v1.LimitRange, error) {
+    return listCached[v1.LimitRange](r, "limit ranges", namespace)
+}
+
+// listCached copies the cached objects of an informer in namespace (all
+// namespaces if empty), ordered by namespace and name like API server lists.
+// Informers limited to the reader's namespace because listing every
+// namespace is forbidden return that error for other namespaces. The copies
+// are shallow: callers must not modify the objects.
+func listCached[T any, P interface {
+    *T
+    metav1.Object
+}](r *InformerReader, name, namespace string) ([]T, error) {
+    if err, ok := r.forbidden[name]; ok && namespace != r.namespace {
+        return nil, err
+    }
+    inf := r.informers[name]
+    if !inf.HasSynced() {
+        return nil, fmt.Errorf("%s cache not filled yet", name)
+    }
+    var objs []interface{}
+    var err error
+    if namespace == "" {
+        objs = inf.GetStore().List()
+    } else {
+        objs, err = inf.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+        if err != nil {
+            return nil, err
+        }
+    }
+    items := make([]T, 0, len(objs))
+    for _, obj := range objs {
+        if p, ok := obj.(P); ok {
+            items = append(items, *p)
+        }
+    }
+    sort.Slice(items, func(i, j int) bool {
+        a, b := P(&items[i]), P(&items[j])
+        if a.GetNamespace() != b.GetNamespace() {
+            return a.GetNamespace() < b.GetNamespace()
+        }
+        return a.GetName() < b.GetName()
+    })
+    return items, nil
+}
+
+// dropManagedFields strips managed fields, which kcap never reads, before
+// objects are cached.
+func dropManagedFields(obj interface{}) (interface{}, error) {
+    if o, ok := obj.(metav1.Object); ok {
+        o.SetManagedFields(nil)
+    }
+    return obj, nil
+}
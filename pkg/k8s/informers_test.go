@@ -0,0 +1,62 @@
+package k8s
+
+import (
+    "context"
+    "testing"
+    "time"
+
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    "k8s.io/apimachinery/pkg/runtime"
+    "k8s.io/client-go/kubernetes/fake"
+    k8stesting "k8s.io/client-go/testing"
+)
+
+// TestInformerReaderWatchesPodsOfEveryNamespace checks that a reader limited
+// to a namespace still caches the pods of every namespace, and falls back to
+// the namespace, reporting other namespaces as forbidden, when it may not
+// list them.
+func TestInformerReaderWatchesPodsOfEveryNamespace(t *testing.T) {
+    tests := []struct {
+        name      string
+        forbidden bool
+        all       int
+    }{
+        {name: "cluster-wide", all: 2},
+        {name: "forbidden", forbidden: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            ctx, cancel := context.WithCancel(context.Background())
+            defer cancel()
+            clientset := fake.NewSimpleClientset(testPod("shop", "web-0"), testPod("blog", "web-0"))
+            if tt.forbidden {
+                clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+                    if action.GetNamespace() != "" {
+                        return false, nil, nil
+                    }
+                    return true, nil, apierrors.NewForbidden(action.GetResource().GroupResource(), "", nil)
+                })
+            }
+
+            r := NewInformerReader(ctx, clientset, "shop", 0)
+            if err := r.Start(ctx, 5*time.Second); err != nil {
+                t.Fatalf("Start: %v", err)
+            }
+
+            all, err := r.ListPods(ctx, "")
+            if tt.forbidden != apierrors.IsForbidden(err) {
+                t.Fatalf("ListPods of every namespace: %v", err)
+            }
+            if len(all) != tt.all {
+                t.Errorf("ListPods of every namespace returned %d pods, want %d", len(all), tt.all)
+            }
+            shop, err := r.ListPods(ctx, "shop")
+            if err != nil {
+                t.Fatalf("ListPods: %v", err)
+            }
+            if len(shop) != 1 || shop[0].Namespace != "shop" {
+                t.Errorf("ListPods of shop returned %v", shop)
+            }
+        })
+    }
+}
@@ -0,0 +1,21 @@
+package k8s
+
+import (
+    v1 "k8s.io/api/core/v1"
+)
+
+// PodKey identifies a pod across namespaces. The metrics API does not expose
+// pod UIDs, so usage is matched to pods by namespace and name.
+type PodKey struct {
+    Namespace string
+    Name      string
+}
+
+// KeyForPod returns the key of the given pod.
+func KeyForPod(pod v1.Pod) PodKey {
+    return PodKey{Namespace: pod.Namespace, Name: pod.Name}
+}
+
+func (k PodKey) String() string {
+    return k.Namespace + "/" + k.Name
+}
@@ -0,0 +1,37 @@
+package k8s
+
+import (
+    "context"
+
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DefaultPageSize is the number of objects requested per List call. Larger
+// collections are read in pages, so a big cluster is never fetched in one
+// huge response.
+const DefaultPageSize int64 = 500
+
+// listPages reads a collection page by page with Limit and Continue. list
+// returns the items and continue token of the page requested by opts. If the
+// continue token expires before the last page, the collection is listed
+// again in a single call, as client-go's pager does.
+func listPages[T any](ctx context.Context, pageSize int64, list func(ctx context.Context, opts metav1.ListOptions) ([]T, string, error)) ([]T, error) {
+    var items []T
+    opts := metav1.ListOptions{Limit: pageSize}
+    for {
+        page, next, err := list(ctx, opts)
+        if err != nil {
+            if opts.Continue != "" && apierrors.IsResourceExpired(err) {
+                page, _, err = list(ctx, metav1.ListOptions{})
+                return page, err
+            }
+            return nil, err
+        }
+        items = append(items, page...)
+        if next == "" {
+            return items, nil
+        }
+        opts.Continue = next
+    }
+}
@@ -0,0 +1,100 @@
+package output
+
+import (
+    "bytes"
+    "encoding/json"
+    "reflect"
+)
+
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// goNames converts v to values that encode like the untagged structs of v0
+// output: struct fields are named after their Go names, in declaration order.
+func goNames(v reflect.Value) interface{} {
+    switch v.Kind() {
+    case reflect.Invalid:
+        return nil
+    case reflect.Ptr, reflect.Interface:
+        if v.IsNil() {
+            return nil
+        }
+        return goNames(v.Elem())
+    case reflect.Struct:
+        if v.Type().Implements(marshalerType) {
+            return v.Interface()
+        }
+        var obj object
+        appendFields(&obj, v)
+        return obj
+    case reflect.Slice:
+        if v.IsNil() {
+            return nil
+        }
+        fallthrough
+    case reflect.Array:
+        out := make([]interface{}, v.Len())
+        for i := range out {
+            out[i] = goNames(v.Index(i))
+        }
+        return out
+    case reflect.Map:
+        if v.IsNil() {
+            return nil
+        }
+        out := make(map[string]interface{}, v.Len())
+        iter := v.MapRange()
+        for iter.Next() {
+            out[iter.Key().String()] = goNames(iter.Value())
+        }
+        return out
+    }
+    return v.Interface()
+}
+
+// appendFields appends the exported fields of struct v, flattening embedded
+// structs as encoding/json does.
+func appendFields(obj *object, v reflect.Value) {
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        if !f.IsExported() {
+            continue
+        }
+        if f.Anonymous && f.Type.Kind() == reflect.Struct {
+            appendFields(obj, v.Field(i))
+            continue
+        }
+        *obj = append(*obj, field{name: f.Name, value: goNames(v.Field(i))})
+    }
+}
+
+type field struct {
+    name  string
+    value interface{}
+}
+
+// object is a JSON object that keeps the order of its fields.
+type object []field
+
+func (o object) MarshalJSON() ([]byte, error) {
+    var buf bytes.Buffer
+    buf.WriteByte('{')
+    for i, f := range o {
+        if i > 0 {
+            buf.WriteByte(',')
+        }
+        name, err := json.Marshal(f.name)
+        if err != nil {
+            return nil, err
+        }
+        value, err := json.Marshal(f.value)
+        if err != nil {
+            return nil, err
+        }
+        buf.Write(name)
+        buf.WriteByte(':')
+        buf.Write(value)
+    }
+    buf.WriteByte('}')
+    return buf.Bytes(), nil
+}
@@ -0,0 +1,138 @@
+package output
+
+import (
+    "fmt"
+    "reflect"
+    "sort"
+    "time"
+
+    "kcap/pkg/analysis"
+    "kcap/pkg/cost"
+)
+
+// Output versions. V1 wraps items in an Envelope with camelCase field names;
+// V0 is the unversioned output of earlier releases: the bare items with Go
+// field names.
+const (
+    V1 = "v1"
+    V0 = "v0"
+
+    // DefaultVersion is the output version written unless --output-version
+    // selects another.
+    DefaultVersion = V1
+)
+
+// Group is the API group of the apiVersion of v1 documents.
+const Group = "kcap.io"
+
+// Versions lists the supported output versions, newest first.
+var Versions = []string{V1, V0}
+
+// Envelope wraps the items of a v1 document with their kind and where and
+// when they were collected. Items is an array for kinds ending in "List" and
+// an object otherwise.
+type Envelope struct {
+    APIVersion  string      `json:"apiVersion"`
+    Kind        string      `json:"kind"`
+    GeneratedAt time.Time   `json:"generatedAt"`
+    Cluster     Cluster     `json:"cluster"`
+    Items       interface{} `json:"items"`
+}
+
+// Cluster identifies the data an output was computed from: a live cluster
+// by kubeconfig context and API server, or a snapshot file.
+type Cluster struct {
+    Context    string     `json:"context,omitempty"`
+    Server     string     `json:"server,omitempty"`
+    Snapshot   string     `json:"snapshot,omitempty"`
+    CapturedAt *time.Time `json:"capturedAt,omitempty"`
+    Namespace  string     `json:"namespace,omitempty"`
+}
+
+// Report is the output of 'kcap report'.
+type Report struct {
+    Summary         analysis.ClusterSummary   `json:"summary"`
+    Deployments     []analysis.DeploymentStat `json:"deployments"`
+    Recommendations []analysis.Recommendation `json:"recommendations"`
+    Suppressed      []analysis.SuppressedPod  `json:"suppressed,omitempty"`
+    DaemonSets      []cost.DaemonSetCost      `json:"daemonSets"`
+}
+
+// RecommendationReport is the output of 'kcap recommend --show-ignored'.
+type RecommendationReport struct {
+    Recommendations []analysis.Recommendation `json:"recommendations"`
+    Suppressed      []analysis.SuppressedPod  `json:"suppressed"`
+}
+
+// QuotaReport is the output of 'kcap quotas'.
+type QuotaReport struct {
+    Quotas             []analysis.QuotaUsage        `json:"quotas"`
+    LimitRangeDefaults []analysis.LimitRangeDefault `json:"limitRangeDefaults"`
+}
+
+// Kinds maps every kind of document to the type of its items.
+var Kinds = map[string]reflect.Type{
+    "ContainerList":        reflect.TypeOf([]analysis.ContainerRecord{}),
+    "CostReport":           reflect.TypeOf(cost.Report{}),
+    "DeploymentList":       reflect.TypeOf([]analysis.DeploymentStat{}),
+    "Diff":                 reflect.TypeOf(analysis.Diff{}),
+    "NamespaceList":        reflect.TypeOf([]analysis.NamespaceStat{}),
+    "NodeList":             reflect.TypeOf([]analysis.NodeStat{}),
+    "PodList":              reflect.TypeOf([]analysis.PodRecord{}),
+    "PoolList":             reflect.TypeOf([]analysis.PoolStat{}),
+    "QuotaReport":          reflect.TypeOf(QuotaReport{}),
+    "RecommendationList":   reflect.TypeOf([]analysis.Recommendation{}),
+    "RecommendationReport": reflect.TypeOf(RecommendationReport{}),
+    "Report":               reflect.TypeOf(Report{}),
+    "WorkloadList":         reflect.TypeOf([]analysis.WorkloadStat{}),
+}
+
+// KindNames returns the known kinds in alphabetical order.
+func KindNames() []string {
+    names := make([]string, 0, len(Kinds))
+    for k := range Kinds {
+        names = append(names, k)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// ValidateVersion checks that version is a supported output version.
+func ValidateVersion(version string) error {
+    for _, v := range Versions {
+        if version == v {
+            return nil
+        }
+    }
+    return fmt.Errorf("unsupported output version %q (expected one of %v)", version, Versions)
+}
+
+// New wraps items of kind in a v1 envelope generated now. Nil lists are
+// written as empty arrays.
+func New(kind string, cluster Cluster, items interface{}) Envelope {
+    if v := reflect.ValueOf(items); v.Kind() == reflect.Slice && v.IsNil() {
+        items = reflect.MakeSlice(v.Type(), 0, 0).Interface()
+    }
+    return Envelope{
+        APIVersion:  Group + "/" + V1,
+        Kind:        kind,
+        GeneratedAt: time.Now().UTC(),
+        Cluster:     cluster,
+        Items:       items,
+    }
+}
+
+// Document returns what to encode for items of kind in the given output
+// version: an Envelope for v1, the bare items with Go field names for v0.
+func Document(version, kind string, cluster Cluster, items interface{}) (interface{}, error) {
+    if _, ok := Kinds[kind]; !ok {
+        return nil, fmt.Errorf("unknown output kind %q", kind)
+    }
+    switch version {
+    case V1:
+        return New(kind, cluster, items), nil
+    case V0:
+        return goNames(reflect.ValueOf(items)), nil
+    }
+    return nil, ValidateVersion(version)
+}
@@ -0,0 +1,121 @@
+package output
+
+import (
+    "reflect"
+    "strings"
+    "time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Schema returns the JSON Schema (draft 2020-12) of v1 documents. The items
+// of each kind are described by a conditional on kind, and every struct by
+// a definition under $defs named after its package and type.
+func Schema() map[string]interface{} {
+    g := &schemaGen{defs: make(map[string]interface{})}
+    kinds := KindNames()
+
+    var conditions []interface{}
+    for _, kind := range kinds {
+        conditions = append(conditions, map[string]interface{}{
+            "if": map[string]interface{}{
+                "properties": map[string]interface{}{"kind": map[string]interface{}{"const": kind}},
+            },
+            "then": map[string]interface{}{
+                "properties": map[string]interface{}{"items": g.schema(Kinds[kind])},
+            },
+        })
+    }
+
+    return map[string]interface{}{
+        "$schema":  "https://json-schema.org/draft/2020-12/schema",
+        "title":    "kcap output " + Group + "/" + V1,
+        "type":     "object",
+        "required": []string{"apiVersion", "kind", "generatedAt", "cluster", "items"},
+        "properties": map[string]interface{}{
+            "apiVersion":  map[string]interface{}{"const": Group + "/" + V1},
+            "kind":        map[string]interface{}{"enum": kinds},
+            "generatedAt": g.schema(timeType),
+            "cluster":     g.schema(reflect.TypeOf(Cluster{})),
+            "items":       map[string]interface{}{"type": []string{"array", "object"}},
+        },
+        "allOf": conditions,
+        "$defs": g.defs,
+    }
+}
+
+type schemaGen struct {
+    defs map[string]interface{}
+}
+
+// schema returns the schema of values of type t as encoding/json writes
+// them. Slices and maps may be null, as nil ones are written as null.
+func (g *schemaGen) schema(t reflect.Type) interface{} {
+    switch t.Kind() {
+    case reflect.Ptr:
+        return g.schema(t.Elem())
+    case reflect.Bool:
+        return map[string]interface{}{"type": "boolean"}
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+        reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        return map[string]interface{}{"type": "integer"}
+    case reflect.Float32, reflect.Float64:
+        return map[string]interface{}{"type": "number"}
+    case reflect.String:
+        return map[string]interface{}{"type": "string"}
+    case reflect.Slice, reflect.Array:
+        return map[string]interface{}{"type": []string{"array", "null"}, "items": g.schema(t.Elem())}
+    case reflect.Map:
+        return map[string]interface{}{"type": []string{"object", "null"}, "additionalProperties": g.schema(t.Elem())}
+    case reflect.Struct:
+        if t == timeType {
+            return map[string]interface{}{"type": "string", "format": "date-time"}
+        }
+        name := t.String()
+        if _, ok := g.defs[name]; !ok {
+            g.defs[name] = nil // guards against recursive types
+            g.defs[name] = g.object(t)
+        }
+        return map[string]interface{}{"$ref": "#/$defs/" + name}
+    }
+    return map[string]interface{}{}
+}
+
+// object returns the schema of a struct: its fields are required unless
+// tagged omitempty.
+func (g *schemaGen) object(t reflect.Type) interface{} {
+    properties := make(map[string]interface{})
+    required := []string{}
+    g.addFields(t, properties, &required)
+    return map[string]interface{}{
+        "type":                 "object",
+        "properties":           properties,
+        "required":             required,
+        "additionalProperties": false,
+    }
+}
+
+func (g *schemaGen) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        if !f.IsExported() {
+            continue
+        }
+        tag := f.Tag.Get("json")
+        if tag == "-" {
+            continue
+        }
+        name, opts, _ := strings.Cut(tag, ",")
+        if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+            g.addFields(f.Type, properties, required)
+            continue
+        }
+        if name == "" {
+            name = f.Name
+        }
+        properties[name] = g.schema(f.Type)
+        if !strings.Contains(opts, "omitempty") {
+            *required = append(*required, name)
+        }
+    }
+}
@@ -0,0 +1,36 @@
+package patch
+
+import (
+    "os"
+    "path/filepath"
+
+    "sigs.k8s.io/yaml"
+)
+
+// WriteKustomize writes one patch file per workload into dir, along with a
+// kustomization.yaml listing them.
+func WriteKustomize(dir string, patches []WorkloadPatch) error {
+    if err := os.MkdirAll(dir, 0o755); err != nil {
+        return err
+    }
+    var entries []map[string]string
+    for _, p := range patches {
+        data, err := p.Manifest()
+        if err != nil {
+            return err
+        }
+        if err := os.WriteFile(filepath.Join(dir, p.FileName()), data, 0o644); err != nil {
+            return err
+        }
+        entries = append(entries, map[string]string{"path": p.FileName()})
+    }
+    kustomization, err := yaml.Marshal(map[string]interface{}{
+        "apiVersion": "kustomize.config.k8s.io/v1beta1",
+        "kind":       "Kustomization",
+        "patches":    entries,
+    })
+    if err != nil {
+        return err
+    }
+    return os.WriteFile(filepath.Join(dir, "kustomization.yaml"), kustomization, 0o644)
+}
@@ -0,0 +1,205 @@
+package patch
+
+import (
+    "encoding/json"
+    "fmt"
+    "sort"
+    "strings"
+
+    "kcap/pkg/analysis"
+    "kcap/pkg/policy"
+    "sigs.k8s.io/yaml"
+)
+
+// ContainerChange holds the proposed requests of one container. Empty values
+// leave the current request unchanged.
+type ContainerChange struct {
+    Name          string
+    CPURequest    string
+    MemoryRequest string
+}
+
+// WorkloadPatch collects the request changes for one Deployment, StatefulSet or DaemonSet.
+type WorkloadPatch struct {
+    Kind       string
+    Namespace  string
+    Name       string
+    Containers []ContainerChange
+}
+
+// Build groups request recommendations by the workload owning each pod.
+// The pod template is shared by every replica, so a recommended request is
+// raised to what the usage of each replica of the workload needs; containers
+// without usage on some replica are left out. Pods not owned by a
+// Deployment, StatefulSet or DaemonSet are skipped.
+func Build(pods []analysis.PodRecord, recs []analysis.Recommendation, pol *policy.Policy) []WorkloadPatch {
+    podByKey := make(map[string]analysis.PodRecord, len(pods))
+    for _, p := range pods {
+        podByKey[p.Namespace+"/"+p.Name] = p
+    }
+
+    type proposal struct{ cpu, mem int64 }
+    patches := make(map[string]*WorkloadPatch)
+    proposals := make(map[string]map[string]*proposal)
+    for _, r := range recs {
+        if (r.Resource != "cpu" && r.Resource != "memory") || r.Container == "" {
+            continue
+        }
+        p, ok := podByKey[r.Namespace+"/"+r.Pod]
+        if !ok {
+            continue
+        }
+        kind, name := workloadOf(p)
+        if kind == "" {
+            continue
+        }
+        key := kind + "/" + p.Namespace + "/" + name
+        if _, ok := patches[key]; !ok {
+            patches[key] = &WorkloadPatch{Kind: kind, Namespace: p.Namespace, Name: name}
+            proposals[key] = make(map[string]*proposal)
+        }
+        c, ok := proposals[key][r.Container]
+        if !ok {
+            c = &proposal{}
+            proposals[key][r.Container] = c
+        }
+        switch r.Resource {
+        case "cpu":
+            c.cpu = max(c.cpu, r.Proposed)
+        case "memory":
+            c.mem = max(c.mem, r.Proposed)
+        }
+    }
+
+    for _, p := range pods {
+        kind, name := workloadOf(p)
+        key := kind + "/" + p.Namespace + "/" + name
+        if _, ok := patches[key]; !ok {
+            continue
+        }
+        for _, cr := range p.Containers {
+            c, ok := proposals[key][cr.Name]
+            if !ok {
+                continue
+            }
+            if !cr.HasUsage {
+                delete(proposals[key], cr.Name)
+                continue
+            }
+            cpu, mem := analysis.ProposeRequests(p, cr, pol)
+            if c.cpu > 0 {
+                c.cpu = max(c.cpu, cpu)
+            }
+            if c.mem > 0 {
+                c.mem = max(c.mem, mem)
+            }
+        }
+    }
+
+    var out []WorkloadPatch
+    for key, wp := range patches {
+        if len(proposals[key]) == 0 {
+            continue
+        }
+        for name, c := range proposals[key] {
+            change := ContainerChange{Name: name}
+            if c.cpu > 0 {
+                change.CPURequest = fmt.Sprintf("%dm", c.cpu)
+            }
+            if c.mem > 0 {
+                change.MemoryRequest = fmt.Sprintf("%dMi", c.mem)
+            }
+            wp.Containers = append(wp.Containers, change)
+        }
+        sort.Slice(wp.Containers, func(i, j int) bool {
+            return wp.Containers[i].Name < wp.Containers[j].Name
+        })
+        out = append(out, *wp)
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].Namespace != out[j].Namespace {
+            return out[i].Namespace < out[j].Namespace
+        }
+        if out[i].Kind != out[j].Kind {
+            return out[i].Kind < out[j].Kind
+        }
+        return out[i].Name < out[j].Name
+    })
+    return out
+}
+
+// workloadOf returns the kind and name of the patchable workload owning the pod.
+func workloadOf(p analysis.PodRecord) (string, string) {
+    switch p.WorkloadKind {
+    case "Deployment", "StatefulSet", "DaemonSet":
+        return p.WorkloadKind, p.WorkloadName
+    }
+    return "", ""
+}
+
+// StrategicMerge returns the strategic-merge patch body for the workload's pod template.
+func (w WorkloadPatch) StrategicMerge() ([]byte, error) {
+    return json.Marshal(map[string]interface{}{
+        "spec": w.templateSpec(),
+    })
+}
+
+// Manifest returns the patch as a YAML document identifying the target
+// object, suitable for `kubectl patch --patch-file` or a kustomize patch.
+func (w WorkloadPatch) Manifest() ([]byte, error) {
+    return yaml.Marshal(map[string]interface{}{
+        "apiVersion": "apps/v1",
+        "kind":       w.Kind,
+        "metadata": map[string]interface{}{
+            "name":      w.Name,
+            "namespace": w.Namespace,
+        },
+        "spec": w.templateSpec(),
+    })
+}
+
+// KubectlCommands returns one `kubectl set resources` command per container.
+func (w WorkloadPatch) KubectlCommands() []string {
+    var cmds []string
+    for _, c := range w.Containers {
+        var requests []string
+        if c.CPURequest != "" {
+            requests = append(requests, "cpu="+c.CPURequest)
+        }
+        if c.MemoryRequest != "" {
+            requests = append(requests, "memory="+c.MemoryRequest)
+        }
+        cmds = append(cmds, fmt.Sprintf("kubectl set resources %s/%s -n %s -c %s --requests=%s",
+            strings.ToLower(w.Kind), w.Name, w.Namespace, c.Name, strings.Join(requests, ",")))
+    }
+    return cmds
+}
+
+// FileName returns the kustomize patch file name for the workload.
+func (w WorkloadPatch) FileName() string {
+    return fmt.Sprintf("%s-%s-%s.yaml", w.Namespace, strings.ToLower(w.Kind), w.Name)
+}
+
+func (w WorkloadPatch) templateSpec() map[string]interface{} {
+    var containers []map[string]interface{}
+    for _, c := range w.Containers {
+        requests := map[string]string{}
+        if c.CPURequest != "" {
+            requests["cpu"] = c.CPURequest
+        }
+        if c.MemoryRequest != "" {
+            requests["memory"] = c.MemoryRequest
+        }
+        containers = append(containers, map[string]interface{}{
+            "name":      c.Name,
+            "resources": map[string]interface{}{"requests": requests},
+        })
+    }
+    return map[string]interface{}{
+        "template": map[string]interface{}{
+            "spec": map[string]interface{}{
+                "containers": containers,
+            },
+        },
+    }
+}
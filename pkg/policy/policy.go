@@ -0,0 +1,344 @@
+package policy
+
+import (
+    "fmt"
+    "os"
+
+    "sigs.k8s.io/yaml"
+)
+
+// DefaultFile is the policy file read from the home directory when --config is not given.
+const DefaultFile = ".kcap.yaml"
+
+const (
+    DefaultCPUScaleInPercent     = 30.0 // Nodes below this CPU usage are scale-in candidates (%)
+    DefaultMemScaleInPercent     = 30.0 // Nodes below this memory usage are scale-in candidates (%)
+    DefaultWastePercent          = 80.0 // Containers at or above this waste are right-sized (%)
+    DefaultUnderProvisionPercent = 90.0 // Usage at or above this share of the request is under-provisioned (%)
+    DefaultHeadroomPercent       = 20.0 // Headroom added on top of observed usage (%)
+)
+
+// NodeThresholds decide which nodes are scale-in candidates.
+type NodeThresholds struct {
+    CPUScaleInPercent float64 `json:"cpuScaleInPercent"`
+    MemScaleInPercent float64 `json:"memoryScaleInPercent"`
+}
+
+// PodThresholds decide which containers are right-sized and by how much.
+type PodThresholds struct {
+    WastePercent          float64 `json:"wastePercent"`
+    UnderProvisionPercent float64 `json:"underProvisionPercent"`
+    CPUHeadroomPercent    float64 `json:"cpuHeadroomPercent"`
+    MemHeadroomPercent    float64 `json:"memoryHeadroomPercent"`
+    MinCPUMilli           int64   `json:"minCPUMillicores,omitempty"`
+}
+
+// SeverityBands are the waste percentages at which over-provisioning is rated
+// High, Medium and Low; below Low it is Info.
+type SeverityBands struct {
+    High   float64 `json:"high"`
+    Medium float64 `json:"medium"`
+    Low    float64 `json:"low"`
+}
+
+// Exclusions name nodes, namespaces and pod labels that never get recommendations.
+type Exclusions struct {
+    Namespaces []string          `json:"namespaces,omitempty"`
+    Nodes      []string          `json:"nodes,omitempty"`
+    Labels     map[string]string `json:"labels,omitempty"`
+}
+
+// NodeOverrides replace the node thresholds that are set.
+type NodeOverrides struct {
+    CPUScaleInPercent *float64 `json:"cpuScaleInPercent,omitempty"`
+    MemScaleInPercent *float64 `json:"memoryScaleInPercent,omitempty"`
+}
+
+// PodOverrides replace the pod thresholds that are set.
+type PodOverrides struct {
+    WastePercent          *float64 `json:"wastePercent,omitempty"`
+    UnderProvisionPercent *float64 `json:"underProvisionPercent,omitempty"`
+    CPUHeadroomPercent    *float64 `json:"cpuHeadroomPercent,omitempty"`
+    MemHeadroomPercent    *float64 `json:"memoryHeadroomPercent,omitempty"`
+    MinCPUMilli           *int64   `json:"minCPUMillicores,omitempty"`
+}
+
+// Override applies to pods in Namespace (if set) carrying all of Labels (if
+// set), and to nodes carrying all of Labels. Overrides are applied in order,
+// so later overrides win.
+type Override struct {
+    Namespace string            `json:"namespace,omitempty"`
+    Labels    map[string]string `json:"labels,omitempty"`
+    Nodes     *NodeOverrides    `json:"nodes,omitempty"`
+    Pods      *PodOverrides     `json:"pods,omitempty"`
+}
+
+// Policy holds the thresholds used by the analysis.
+type Policy struct {
+    Nodes     NodeThresholds `json:"nodes"`
+    Pods      PodThresholds  `json:"pods"`
+    Severity  SeverityBands  `json:"severity"`
+    Exclude   Exclusions     `json:"exclude,omitempty"`
+    Overrides []Override     `json:"overrides,omitempty"`
+}
+
+// Default returns the built-in policy.
+func Default() *Policy {
+    return &Policy{
+        Nodes: NodeThresholds{
+            CPUScaleInPercent: DefaultCPUScaleInPercent,
+            MemScaleInPercent: DefaultMemScaleInPercent,
+        },
+        Pods: PodThresholds{
+            WastePercent:          DefaultWastePercent,
+            UnderProvisionPercent: DefaultUnderProvisionPercent,
+            CPUHeadroomPercent:    DefaultHeadroomPercent,
+            MemHeadroomPercent:    DefaultHeadroomPercent,
+        },
+        Severity: SeverityBands{High: 90, Medium: 70, Low: 50},
+    }
+}
+
+// Load reads a policy file. Settings missing from the file keep their defaults.
+func Load(path string) (*Policy, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    p := Default()
+    if err := yaml.UnmarshalStrict(data, p); err != nil {
+        return nil, fmt.Errorf("parsing policy file %s: %w", path, err)
+    }
+    if err := p.Validate(); err != nil {
+        return nil, fmt.Errorf("policy file %s: %w", path, err)
+    }
+    return p, nil
+}
+
+// Validate checks that percentages of a whole are within 0-100, that
+// headroom and other thresholds are not negative, and that the severity
+// bands are ordered.
+func (p *Policy) Validate() error {
+    if err := p.Nodes.validate(""); err != nil {
+        return err
+    }
+    if err := p.Pods.validate(""); err != nil {
+        return err
+    }
+    for _, b := range []struct {
+        name  string
+        value float64
+    }{{"severity.high", p.Severity.High}, {"severity.medium", p.Severity.Medium}, {"severity.low", p.Severity.Low}} {
+        if err := checkPercent(b.name, b.value); err != nil {
+            return err
+        }
+    }
+    if p.Severity.High < p.Severity.Medium || p.Severity.Medium < p.Severity.Low {
+        return fmt.Errorf("severity bands must satisfy high >= medium >= low, got %g/%g/%g", p.Severity.High, p.Severity.Medium, p.Severity.Low)
+    }
+    for i, o := range p.Overrides {
+        prefix := fmt.Sprintf("overrides[%d].", i)
+        if o.Nodes != nil {
+            t := NodeThresholds{}
+            setIf(&t.CPUScaleInPercent, o.Nodes.CPUScaleInPercent)
+            setIf(&t.MemScaleInPercent, o.Nodes.MemScaleInPercent)
+            if err := t.validate(prefix); err != nil {
+                return err
+            }
+        }
+        if o.Pods != nil {
+            t := PodThresholds{}
+            setIf(&t.WastePercent, o.Pods.WastePercent)
+            setIf(&t.UnderProvisionPercent, o.Pods.UnderProvisionPercent)
+            setIf(&t.CPUHeadroomPercent, o.Pods.CPUHeadroomPercent)
+            setIf(&t.MemHeadroomPercent, o.Pods.MemHeadroomPercent)
+            if o.Pods.MinCPUMilli != nil {
+                t.MinCPUMilli = *o.Pods.MinCPUMilli
+            }
+            if err := t.validate(prefix); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+func (t NodeThresholds) validate(prefix string) error {
+    if err := checkPercent(prefix+"nodes.cpuScaleInPercent", t.CPUScaleInPercent); err != nil {
+        return err
+    }
+    return checkPercent(prefix+"nodes.memoryScaleInPercent", t.MemScaleInPercent)
+}
+
+// validate checks the pod thresholds. Usage can exceed the request, so the
+// under-provisioning threshold and headroom only need to be non-negative.
+func (t PodThresholds) validate(prefix string) error {
+    if err := checkPercent(prefix+"pods.wastePercent", t.WastePercent); err != nil {
+        return err
+    }
+    for _, f := range []struct {
+        name  string
+        value float64
+    }{
+        {"pods.underProvisionPercent", t.UnderProvisionPercent},
+        {"pods.cpuHeadroomPercent", t.CPUHeadroomPercent},
+        {"pods.memoryHeadroomPercent", t.MemHeadroomPercent},
+        {"pods.minCPUMillicores", float64(t.MinCPUMilli)},
+    } {
+        if f.value < 0 {
+            return fmt.Errorf("%s%s must not be negative, got %g", prefix, f.name, f.value)
+        }
+    }
+    return nil
+}
+
+// checkPercent checks that v is a percentage between 0 and 100.
+func checkPercent(name string, v float64) error {
+    if v < 0 || v > 100 {
+        return fmt.Errorf("%s must be between 0 and 100, got %g", name, v)
+    }
+    return nil
+}
+
+// Clone returns a copy of the policy whose thresholds and overrides can be
+// changed without affecting p.
+func (p *Policy) Clone() *Policy {
+    c := *p
+    c.Overrides = make([]Override, len(p.Overrides))
+    for i, o := range p.Overrides {
+        if o.Nodes != nil {
+            nodes := *o.Nodes
+            o.Nodes = &nodes
+        }
+        if o.Pods != nil {
+            pods := *o.Pods
+            o.Pods = &pods
+        }
+        c.Overrides[i] = o
+    }
+    return &c
+}
+
+// ForNode returns the node thresholds for a node with the given labels.
+func (p *Policy) ForNode(labels map[string]string) NodeThresholds {
+    t := p.Nodes
+    for _, o := range p.Overrides {
+        if o.Nodes == nil || o.Namespace != "" || !matchesLabels(o.Labels, labels) {
+            continue
+        }
+        setIf(&t.CPUScaleInPercent, o.Nodes.CPUScaleInPercent)
+        setIf(&t.MemScaleInPercent, o.Nodes.MemScaleInPercent)
+    }
+    return t
+}
+
+// ForPod returns the pod thresholds for a pod in namespace with the given labels.
+func (p *Policy) ForPod(namespace string, labels map[string]string) PodThresholds {
+    t := p.Pods
+    for _, o := range p.Overrides {
+        if o.Pods == nil || (o.Namespace != "" && o.Namespace != namespace) {
+            continue
+        }
+        if len(o.Labels) > 0 && !matchesLabels(o.Labels, labels) {
+            continue
+        }
+        setIf(&t.WastePercent, o.Pods.WastePercent)
+        setIf(&t.UnderProvisionPercent, o.Pods.UnderProvisionPercent)
+        setIf(&t.CPUHeadroomPercent, o.Pods.CPUHeadroomPercent)
+        setIf(&t.MemHeadroomPercent, o.Pods.MemHeadroomPercent)
+        if o.Pods.MinCPUMilli != nil {
+            t.MinCPUMilli = *o.Pods.MinCPUMilli
+        }
+    }
+    return t
+}
+
+// ExcludesPod reports whether a pod in namespace with the given labels is excluded.
+func (p *Policy) ExcludesPod(namespace string, labels map[string]string) bool {
+    for _, ns := range p.Exclude.Namespaces {
+        if ns == namespace {
+            return true
+        }
+    }
+    return len(p.Exclude.Labels) > 0 && matchesLabels(p.Exclude.Labels, labels)
+}
+
+// ExcludesNode reports whether the named node is excluded.
+func (p *Policy) ExcludesNode(name string) bool {
+    for _, n := range p.Exclude.Nodes {
+        if n == name {
+            return true
+        }
+    }
+    return false
+}
+
+// SetWastePercent sets the waste threshold everywhere, including overrides.
+func (p *Policy) SetWastePercent(v float64) {
+    p.Pods.WastePercent = v
+    for _, o := range p.Overrides {
+        if o.Pods != nil {
+            o.Pods.WastePercent = nil
+        }
+    }
+}
+
+// SetUnderProvisionPercent sets the under-provisioning threshold everywhere, including overrides.
+func (p *Policy) SetUnderProvisionPercent(v float64) {
+    p.Pods.UnderProvisionPercent = v
+    for _, o := range p.Overrides {
+        if o.Pods != nil {
+            o.Pods.UnderProvisionPercent = nil
+        }
+    }
+}
+
+// SetHeadroomPercent sets the CPU and memory headroom everywhere, including overrides.
+func (p *Policy) SetHeadroomPercent(v float64) {
+    p.Pods.CPUHeadroomPercent = v
+    p.Pods.MemHeadroomPercent = v
+    for _, o := range p.Overrides {
+        if o.Pods != nil {
+            o.Pods.CPUHeadroomPercent = nil
+            o.Pods.MemHeadroomPercent = nil
+        }
+    }
+}
+
+// SetCPUScaleInPercent sets the node CPU scale-in threshold everywhere, including overrides.
+func (p *Policy) SetCPUScaleInPercent(v float64) {
+    p.Nodes.CPUScaleInPercent = v
+    for _, o := range p.Overrides {
+        if o.Nodes != nil {
+            o.Nodes.CPUScaleInPercent = nil
+        }
+    }
+}
+
+// SetMemScaleInPercent sets the node memory scale-in threshold everywhere, including overrides.
+func (p *Policy) SetMemScaleInPercent(v float64) {
+    p.Nodes.MemScaleInPercent = v
+    for _, o := range p.Overrides {
+        if o.Nodes != nil {
+            o.Nodes.MemScaleInPercent = nil
+        }
+    }
+}
+
+func setIf(dst *float64, v *float64) {
+    if v != nil {
+        *dst = *v
+    }
+}
+
+func matchesLabels(selector, labels map[string]string) bool {
+    if len(selector) == 0 {
+        return false
+    }
+    for k, v := range selector {
+        if labels[k] != v {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,416 @@
+// Package printer renders command output in the format selected by -o: the
+// default go-pretty tables, delimited text and Markdown built from the same
+// tables, or the versioned JSON document as JSON, YAML, a JSONPath template
+// or custom columns.
+package printer
+
+import (
+    "encoding/csv"
+    "encoding/json"
+    "fmt"
+    "io"
+    "strings"
+
+    "github.com/jedib0t/go-pretty/v6/table"
+    "k8s.io/client-go/util/jsonpath"
+    "kcap/pkg/output"
+    "sigs.k8s.io/yaml"
+)
+
+// Output formats. jsonpath and custom-columns take an argument after "=".
+const (
+    formatTable         = "table"
+    formatWide          = "wide"
+    formatJSON          = "json"
+    formatYAML          = "yaml"
+    formatCSV           = "csv"
+    formatTSV           = "tsv"
+    formatMarkdown      = "markdown"
+    formatJSONPath      = "jsonpath"
+    formatCustomColumns = "custom-columns"
+)
+
+// Formats lists the accepted -o values.
+var Formats = []string{formatTable, formatWide, formatJSON, formatYAML, formatCSV, formatTSV, formatMarkdown, formatJSONPath + "=TEMPLATE", formatCustomColumns + "=SPEC"}
+
+// Column is a table column. Wide columns are left out of the table and
+// markdown formats and printed by wide, csv and tsv.
+type Column struct {
+    Header string
+    Wide   bool
+}
+
+// Columns returns columns with the given headers.
+func Columns(headers ...string) []Column {
+    columns := make([]Column, len(headers))
+    for i, h := range headers {
+        columns[i] = Column{Header: h}
+    }
+    return columns
+}
+
+// WideColumns returns wide columns with the given headers.
+func WideColumns(headers ...string) []Column {
+    columns := Columns(headers...)
+    for i := range columns {
+        columns[i].Wide = true
+    }
+    return columns
+}
+
+// Table holds the columns and rows of a table. Each row has a value
+// per column.
+type Table struct {
+    Columns []Column
+    Rows    [][]interface{}
+}
+
+// NewTable returns an empty table with the given columns.
+func NewTable(columns ...[]Column) *Table {
+    t := &Table{}
+    for _, c := range columns {
+        t.Columns = append(t.Columns, c...)
+    }
+    return t
+}
+
+// AddRow appends a row.
+func (t *Table) AddRow(values ...interface{}) {
+    t.Rows = append(t.Rows, values)
+}
+
+// Section is a titled part of the human-readable output: lines of text, a
+// table and notes below it. Sections are separated by a blank line.
+type Section struct {
+    Title string
+    Text  []string
+    Table *Table
+    Notes []string
+    // Records replaces Table in csv and tsv output, e.g. to print
+    // unformatted numbers in separate columns.
+    Records *Table
+}
+
+// Document is the output of a command. Kind, Cluster and Items make up the
+// versioned document printed by json, yaml, jsonpath and custom-columns; a
+// document without a kind prints Items as they are. Sections are printed by
+// the tabular formats.
+type Document struct {
+    Kind     string
+    Cluster  output.Cluster
+    Items    interface{}
+    Sections []Section
+}
+
+// Printer prints documents in one output format.
+type Printer struct {
+    format  string
+    version string
+    path    *jsonpath.JSONPath
+    columns []customColumn
+}
+
+type customColumn struct {
+    header string
+    path   *jsonpath.JSONPath
+}
+
+// New returns a printer for an -o value, writing JSON documents in the given
+// output version.
+func New(format, version string) (*Printer, error) {
+    name, arg, hasArg := strings.Cut(format, "=")
+    p := &Printer{format: name, version: version}
+    switch name {
+    case formatTable, formatWide, formatJSON, formatYAML, formatCSV, formatTSV, formatMarkdown:
+        if hasArg {
+            return nil, fmt.Errorf("output format %s takes no argument", name)
+        }
+    case formatJSONPath:
+        if arg == "" {
+            return nil, fmt.Errorf("output format jsonpath requires a template, e.g. jsonpath='{.items[*].name}'")
+        }
+        path, err := parseJSONPath(arg)
+        if err != nil {
+            return nil, fmt.Errorf("parsing jsonpath template: %w", err)
+        }
+        p.path = path
+    case formatCustomColumns:
+        columns, err := parseCustomColumns(arg)
+        if err != nil {
+            return nil, err
+        }
+        p.columns = columns
+    default:
+        return nil, fmt.Errorf("unsupported output format %q (expected %s)", format, strings.Join(Formats, ", "))
+    }
+    return p, nil
+}
+
+// parseCustomColumns parses a custom-columns spec, e.g.
+// "NAME:.name,CPU:.cpuRequestMillicores".
+func parseCustomColumns(spec string) ([]customColumn, error) {
+    if spec == "" {
+        return nil, fmt.Errorf("output format custom-columns requires columns, e.g. custom-columns=NAME:.name")
+    }
+    var columns []customColumn
+    for _, field := range strings.Split(spec, ",") {
+        header, expr, ok := strings.Cut(field, ":")
+        if !ok || header == "" || expr == "" {
+            return nil, fmt.Errorf("invalid custom column %q (expected HEADER:.path)", field)
+        }
+        if !strings.HasPrefix(expr, "{") {
+            if !strings.HasPrefix(expr, ".") {
+                expr = "." + expr
+            }
+            expr = "{" + expr + "}"
+        }
+        path, err := parseJSONPath(expr)
+        if err != nil {
+            return nil, fmt.Errorf("parsing custom column %s: %w", header, err)
+        }
+        columns = append(columns, customColumn{header: header, path: path})
+    }
+    return columns, nil
+}
+
+func parseJSONPath(template string) (*jsonpath.JSONPath, error) {
+    path := jsonpath.New("output").AllowMissingKeys(true)
+    if err := path.Parse(template); err != nil {
+        return nil, err
+    }
+    return path, nil
+}
+
+// Print writes doc to w.
+func (p *Printer) Print(w io.Writer, doc Document) error {
+    switch p.format {
+    case formatJSON:
+        v, err := p.document(doc)
+        if err != nil {
+            return err
+        }
+        enc := json.NewEncoder(w)
+        enc.SetIndent("", "  ")
+        return enc.Encode(v)
+    case formatYAML:
+        v, err := p.document(doc)
+        if err != nil {
+            return err
+        }
+        data, err := yaml.Marshal(v)
+        if err != nil {
+            return err
+        }
+        _, err = w.Write(data)
+        return err
+    case formatJSONPath:
+        v, err := p.generic(doc, false)
+        if err != nil {
+            return err
+        }
+        return p.path.Execute(w, v)
+    case formatCustomColumns:
+        return p.printCustomColumns(w, doc)
+    }
+
+    if len(doc.Sections) == 0 {
+        return fmt.Errorf("output format %s is not supported by this command", p.format)
+    }
+    switch p.format {
+    case formatCSV:
+        return printDelimited(w, ',', doc)
+    case formatTSV:
+        return printDelimited(w, '\t', doc)
+    case formatMarkdown:
+        printMarkdown(w, doc.Sections)
+    default:
+        printTables(w, doc.Sections, p.format == formatWide)
+    }
+    return nil
+}
+
+// document returns the document printed by the structured formats.
+func (p *Printer) document(doc Document) (interface{}, error) {
+    if doc.Kind == "" {
+        return doc.Items, nil
+    }
+    return output.Document(p.version, doc.Kind, doc.Cluster, doc.Items)
+}
+
+// generic returns the document, or only its items, as decoded JSON for
+// evaluating JSONPath expressions against the printed field names.
+func (p *Printer) generic(doc Document, items bool) (interface{}, error) {
+    v, err := p.document(doc)
+    if err != nil {
+        return nil, err
+    }
+    if env, ok := v.(output.Envelope); ok && items {
+        v = env.Items
+    }
+    data, err := json.Marshal(v)
+    if err != nil {
+        return nil, err
+    }
+    var out interface{}
+    if err := json.Unmarshal(data, &out); err != nil {
+        return nil, err
+    }
+    return out, nil
+}
+
+// printCustomColumns prints a row per item of a list, or a single row for
+// an object.
+func (p *Printer) printCustomColumns(w io.Writer, doc Document) error {
+    v, err := p.generic(doc, true)
+    if err != nil {
+        return err
+    }
+    items, ok := v.([]interface{})
+    if !ok {
+        items = []interface{}{v}
+    }
+
+    t := newWriter(w)
+    header := make(table.Row, len(p.columns))
+    for i, c := range p.columns {
+        header[i] = c.header
+    }
+    t.AppendHeader(header)
+    for _, item := range items {
+        row := make(table.Row, len(p.columns))
+        for i, c := range p.columns {
+            var b strings.Builder
+            if err := c.path.Execute(&b, item); err != nil {
+                return fmt.Errorf("custom column %s: %w", c.header, err)
+            }
+            row[i] = b.String()
+            if b.Len() == 0 {
+                row[i] = "<none>"
+            }
+        }
+        t.AppendRow(row)
+    }
+    t.Render()
+    return nil
+}
+
+func newWriter(w io.Writer) table.Writer {
+    t := table.NewWriter()
+    t.SetOutputMirror(w)
+    return t
+}
+
+// rows returns the header and rows of the columns of t selected by wide.
+func (t *Table) rows(wide bool) (table.Row, []table.Row) {
+    var keep []int
+    var header table.Row
+    for i, c := range t.Columns {
+        if wide || !c.Wide {
+            keep = append(keep, i)
+            header = append(header, c.Header)
+        }
+    }
+    rows := make([]table.Row, len(t.Rows))
+    for i, r := range t.Rows {
+        for _, k := range keep {
+            rows[i] = append(rows[i], r[k])
+        }
+    }
+    return header, rows
+}
+
+func (t *Table) writer(w io.Writer, wide bool) table.Writer {
+    header, rows := t.rows(wide)
+    tw := newWriter(w)
+    tw.AppendHeader(header)
+    tw.AppendRows(rows)
+    return tw
+}
+
+// printTables prints the sections as go-pretty tables, the wide columns
+// included for -o wide.
+func printTables(w io.Writer, sections []Section, wide bool) {
+    for i, s := range sections {
+        if i > 0 {
+            fmt.Fprintln(w)
+        }
+        if s.Title != "" {
+            fmt.Fprintf(w, "%s:\n", s.Title)
+        }
+        for _, line := range s.Text {
+            fmt.Fprintln(w, line)
+        }
+        if s.Table != nil {
+            s.Table.writer(w, wide).Render()
+        }
+        for _, line := range s.Notes {
+            fmt.Fprintln(w, line)
+        }
+    }
+}
+
+// printMarkdown prints the sections with their titles as headings, their
+// text as paragraphs, their tables as Markdown tables and their notes as a
+// list.
+func printMarkdown(w io.Writer, sections []Section) {
+    var blocks []string
+    for _, s := range sections {
+        if s.Title != "" {
+            blocks = append(blocks, "### "+s.Title)
+        }
+        blocks = append(blocks, s.Text...)
+        if s.Table != nil {
+            header, rows := s.Table.rows(false)
+            t := table.NewWriter()
+            t.AppendHeader(header)
+            t.AppendRows(rows)
+            blocks = append(blocks, t.RenderMarkdown())
+        }
+        if len(s.Notes) > 0 {
+            blocks = append(blocks, "- "+strings.Join(s.Notes, "\n- "))
+        }
+    }
+    fmt.Fprintln(w, strings.Join(blocks, "\n\n"))
+}
+
+// printDelimited prints the records, or else the table, of every section of
+// doc, separated by blank lines, as CSV or TSV with every column.
+func printDelimited(w io.Writer, comma rune, doc Document) error {
+    var tables []*Table
+    for _, s := range doc.Sections {
+        switch {
+        case s.Records != nil:
+            tables = append(tables, s.Records)
+        case s.Table != nil:
+            tables = append(tables, s.Table)
+        }
+    }
+
+    cw := csv.NewWriter(w)
+    cw.Comma = comma
+    for i, t := range tables {
+        if i > 0 {
+            cw.Flush()
+            fmt.Fprintln(w)
+        }
+        header, rows := t.rows(true)
+        if err := cw.Write(cells(header)); err != nil {
+            return err
+        }
+        for _, r := range rows {
+            if err := cw.Write(cells(r)); err != nil {
+                return err
+            }
+        }
+    }
+    cw.Flush()
+    return cw.Error()
+}
+
+func cells(row table.Row) []string {
+    out := make([]string, len(row))
+    for i, v := range row {
+        out[i] = fmt.Sprint(v)
+    }
+    return out
+}
@@ -0,0 +1,147 @@
+package printer
+
+import (
+    "bytes"
+    "strings"
+    "testing"
+
+    "kcap/pkg/analysis"
+    "kcap/pkg/output"
+)
+
+func render(t *testing.T, format string, doc Document) string {
+    t.Helper()
+    p, err := New(format, output.V1)
+    if err != nil {
+        t.Fatalf("New(%q): %v", format, err)
+    }
+    var b bytes.Buffer
+    if err := p.Print(&b, doc); err != nil {
+        t.Fatalf("Print(%q): %v", format, err)
+    }
+    return b.String()
+}
+
+func nodeDocument() Document {
+    table := NewTable(Columns("NODE", "STATUS"), WideColumns("POOL"))
+    table.AddRow("node-a", "Healthy", "general")
+    return Document{
+        Kind:     "NodeList",
+        Items:    []analysis.NodeStat{{Name: "node-a", Status: "Healthy"}},
+        Sections: []Section{{Title: "Nodes", Table: table}},
+    }
+}
+
+func TestNewRejectsInvalidFormats(t *testing.T) {
+    for _, format := range []string{
+        "xml",
+        "table=x",
+        "csv=;",
+        "jsonpath",
+        "jsonpath=",
+        "jsonpath={.items[",
+        "custom-columns",
+        "custom-columns=NAME",
+        "custom-columns=:.name",
+        "custom-columns=NAME:",
+    } {
+        if _, err := New(format, output.V1); err == nil {
+            t.Errorf("New(%q) accepted an invalid format", format)
+        }
+    }
+    for _, format := range []string{"table", "wide", "json", "yaml", "csv", "tsv", "markdown", "jsonpath={.kind}", "custom-columns=NAME:.name"} {
+        if _, err := New(format, output.V1); err != nil {
+            t.Errorf("New(%q): %v", format, err)
+        }
+    }
+}
+
+func TestWideColumns(t *testing.T) {
+    tests := []struct {
+        format string
+        wide   bool
+    }{
+        {"table", false},
+        {"markdown", false},
+        {"wide", true},
+        {"csv", true},
+        {"tsv", true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.format, func(t *testing.T) {
+            out := render(t, tt.format, nodeDocument())
+            if !strings.Contains(out, "node-a") {
+                t.Fatalf("output lacks the row:\n%s", out)
+            }
+            if got := strings.Contains(out, "general"); got != tt.wide {
+                t.Errorf("wide column printed = %v, want %v:\n%s", got, tt.wide, out)
+            }
+        })
+    }
+}
+
+func TestDelimitedPrintsRecords(t *testing.T) {
+    formatted := NewTable(Columns("NODE", "CPU(Req/Alloc m)"))
+    formatted.AddRow("node-a", "500 / 2000")
+    records := NewTable(Columns("node", "cpu_requested_m", "cpu_allocatable_m"))
+    records.AddRow("node-a", 500, 2000)
+    plain := NewTable(Columns("NAME"))
+    plain.AddRow("pool-a")
+    doc := Document{Sections: []Section{
+        {Title: "Nodes", Text: []string{"Only in tables"}, Table: formatted, Records: records},
+        {Title: "Pools", Table: plain},
+        {Text: []string{"No table"}},
+    }}
+
+    tests := []struct {
+        format string
+        want   string
+    }{
+        {"csv", "node,cpu_requested_m,cpu_allocatable_m\nnode-a,500,2000\n\nNAME\npool-a\n"},
+        {"tsv", "node\tcpu_requested_m\tcpu_allocatable_m\nnode-a\t500\t2000\n\nNAME\npool-a\n"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.format, func(t *testing.T) {
+            if got := render(t, tt.format, doc); got != tt.want {
+                t.Errorf("output = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestDelimitedNeedsSections(t *testing.T) {
+    p, err := New("csv", output.V1)
+    if err != nil {
+        t.Fatalf("New: %v", err)
+    }
+    doc := Document{Kind: "NodeList", Items: []analysis.NodeStat{}}
+    if err := p.Print(&bytes.Buffer{}, doc); err == nil {
+        t.Error("Print accepted csv for a document without sections")
+    }
+}
+
+func TestCustomColumns(t *testing.T) {
+    out := render(t, "custom-columns=NAME:.name,POOL:.labels.pool", nodeDocument())
+    lines := strings.Split(strings.TrimSpace(out), "\n")
+    var row string
+    for _, l := range lines {
+        if strings.Contains(l, "node-a") {
+            row = l
+        }
+    }
+    if row == "" {
+        t.Fatalf("output lacks the node:\n%s", out)
+    }
+    if !strings.Contains(row, "<none>") {
+        t.Errorf("missing value not printed as <none>: %q", row)
+    }
+}
+
+func TestJSONPathUsesEnvelope(t *testing.T) {
+    doc := nodeDocument()
+    doc.Cluster = output.Cluster{Snapshot: "cluster.json"}
+    out := render(t, "jsonpath={.apiVersion} {.kind} {.cluster.snapshot} {.items[0].name}", doc)
+    if want := output.Group + "/" + output.V1 + " NodeList cluster.json node-a"; out != want {
+        t.Errorf("jsonpath output = %q, want %q", out, want)
+    }
+}
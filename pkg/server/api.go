@@ -0,0 +1,90 @@
+package server
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+
+    "kcap/pkg/analysis"
+    "kcap/pkg/cost"
+    "kcap/pkg/output"
+)
+
+// apiError is the body of failed API requests.
+type apiError struct {
+    Error string `json:"error"`
+}
+
+var errQuery = errors.New("invalid query")
+
+// endpoint is an API resource: the kind of its documents and how to build
+// their items from an analysis.
+type endpoint struct {
+    kind  string
+    items func(a analysis.Analysis) interface{}
+}
+
+// registerAPI serves the analysis of the cached view under /api/v1/ as v1
+// output documents. cluster describes the cluster the view is captured from;
+// pricing prices the DaemonSets of the report.
+func registerAPI(mux *http.ServeMux, c *Cache, cluster output.Cluster, pricing *cost.Pricing) {
+    endpoints := map[string]endpoint{
+        "nodes":           {"NodeList", func(a analysis.Analysis) interface{} { return a.Nodes }},
+        "pods":            {"PodList", func(a analysis.Analysis) interface{} { return a.Pods }},
+        "deployments":     {"DeploymentList", func(a analysis.Analysis) interface{} { return a.Deployments }},
+        "recommendations": {"RecommendationList", func(a analysis.Analysis) interface{} { return a.Recommendations }},
+        "report": {"Report", func(a analysis.Analysis) interface{} {
+            return output.Report{
+                Summary:         analysis.Summarize(a.Nodes),
+                Deployments:     a.Deployments,
+                Recommendations: a.Recommendations,
+                Suppressed:      a.Suppressed,
+                DaemonSets:      cost.Compute(a, pricing).DaemonSets,
+            }
+        }},
+    }
+    for name, e := range endpoints {
+        mux.HandleFunc("/api/v1/"+name, func(w http.ResponseWriter, r *http.Request) {
+            if r.Method != http.MethodGet {
+                writeJSON(w, http.StatusMethodNotAllowed, apiError{Error: "method not allowed"})
+                return
+            }
+            q, err := ParseQuery(r.URL.Query())
+            if err != nil {
+                writeError(w, fmt.Errorf("%w: %w", errQuery, err))
+                return
+            }
+            a, v, err := c.Analyze(r.Context(), q)
+            if err != nil {
+                writeError(w, err)
+                return
+            }
+            from := cluster
+            from.CapturedAt = &v.Snapshot.CapturedAt
+            if q.Namespace != "" {
+                from.Namespace = q.Namespace
+            }
+            writeJSON(w, http.StatusOK, output.New(e.kind, from, e.items(a)))
+        })
+    }
+}
+
+func writeError(w http.ResponseWriter, err error) {
+    status := http.StatusInternalServerError
+    switch {
+    case errors.Is(err, errQuery):
+        status = http.StatusBadRequest
+    case errors.Is(err, ErrNotReady):
+        status = http.StatusServiceUnavailable
+    }
+    writeJSON(w, status, apiError{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    enc.Encode(v)
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "sync"
+    "time"
+
+    "kcap/pkg/analysis"
+    "kcap/pkg/k8s"
+    "kcap/pkg/policy"
+    "kcap/pkg/snapshot"
+    "kcap/pkg/usage"
+)
+
+// ErrNotReady is returned by analyses requested before the first successful
+// refresh.
+var ErrNotReady = errors.New("no cluster view yet")
+
+// maxCachedQueries bounds the analyses kept for queries between refreshes.
+const maxCachedQueries = 64
+
+// CaptureFunc reads the cluster view: the cluster objects and their usage.
+type CaptureFunc func(ctx context.Context) (*snapshot.Snapshot, error)
+
+// AnalyzeFunc runs the analysis pipeline under pol on the pods of namespace,
+// or of all namespaces if empty.
+type AnalyzeFunc func(ctx context.Context, source k8s.ClusterReader, provider usage.Provider, pol *policy.Policy, namespace string) (analysis.Analysis, error)
+
+// Cache holds the latest view of the cluster and its analysis under the base
+// policy, and recaptures them periodically. A failed refresh keeps the
+// previous view, so clients are served from memory rather than by calls to
+// the API server. Analyses for queries are kept until the next refresh.
+type Cache struct {
+    capture  CaptureFunc
+    analyze  AnalyzeFunc
+    policy   *policy.Policy
+    interval time.Duration
+
+    mu      sync.RWMutex
+    view    View
+    queries map[string]analysis.Analysis
+}
+
+// View is a consistent copy of the cache state.
+type View struct {
+    // Snapshot is the cluster view, nil before the first successful refresh.
+    Snapshot *snapshot.Snapshot
+    // Analysis is the analysis of the whole view under the base policy.
+    Analysis analysis.Analysis
+    // Refreshed is the time of the last successful refresh; Duration is how
+    // long it took.
+    Refreshed time.Time
+    Duration  time.Duration
+    // Err is the error of the last refresh, nil when it succeeded.
+    Err      error
+    Failures int
+}
+
+// Ready reports whether a cluster view is available.
+func (v View) Ready() bool {
+    return v.Snapshot != nil
+}
+
+// NewCache returns a cache recaptured by capture every interval and analyzed
+// by analyze under pol.
+func NewCache(capture CaptureFunc, analyze AnalyzeFunc, pol *policy.Policy, interval time.Duration) *Cache {
+    return &Cache{capture: capture, analyze: analyze, policy: pol, interval: interval}
+}
+
+// Run refreshes the cache now and then every interval until ctx is done.
+// Each refresh may take up to the interval.
+func (c *Cache) Run(ctx context.Context) {
+    ticker := time.NewTicker(c.interval)
+    defer ticker.Stop()
+    for {
+        c.Refresh(ctx)
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// Refresh recaptures and reanalyzes the cluster once.
+func (c *Cache) Refresh(ctx context.Context) error {
+    ctx, cancel := context.WithTimeout(ctx, c.interval)
+    defer cancel()
+
+    start := time.Now()
+    snap, err := c.capture(ctx)
+    var a analysis.Analysis
+    if err == nil {
+        a, err = c.analyze(ctx, snap, snap, c.policy, "")
+    }
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.view.Err = err
+    if err != nil {
+        c.view.Failures++
+        return err
+    }
+    c.view.Snapshot = snap
+    c.view.Analysis = a
+    c.queries = nil
+    c.view.Refreshed = time.Now()
+    c.view.Duration = time.Since(start)
+    return nil
+}
+
+// View returns the current state of the cache.
+func (c *Cache) View() View {
+    c.mu.RLock()
+    defer c.mu.RUnlock()
+    return c.view
+}
+
+// Analyze returns the analysis for q of the cached view, and the view. The
+// cached analysis is reused when q changes nothing. A selector narrows the
+// results after the analysis, so nodes and scale-in still count every pod.
+func (c *Cache) Analyze(ctx context.Context, q Query) (analysis.Analysis, View, error) {
+    v := c.View()
+    if !v.Ready() {
+        if v.Err != nil {
+            return analysis.Analysis{}, v, fmt.Errorf("%w: %w", ErrNotReady, v.Err)
+        }
+        return analysis.Analysis{}, v, ErrNotReady
+    }
+    if q.IsZero() {
+        return v.Analysis, v, nil
+    }
+    key := q.key()
+    c.mu.RLock()
+    a, ok := c.queries[key]
+    c.mu.RUnlock()
+    if ok {
+        return a, v, nil
+    }
+
+    a = v.Analysis
+    if q.Namespace != "" || q.Threshold != nil {
+        pol := c.policy
+        if q.Threshold != nil {
+            pol = pol.Clone()
+            pol.SetWastePercent(*q.Threshold)
+        }
+        var err error
+        a, err = c.analyze(ctx, v.Snapshot, v.Snapshot, pol, q.Namespace)
+        if err != nil {
+            return analysis.Analysis{}, v, err
+        }
+    }
+    if q.Selector != nil {
+        a = a.Select(q.Selector)
+    }
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    // A refresh while analyzing makes the result stale for the new view.
+    if c.view.Snapshot == v.Snapshot {
+        if c.queries == nil || len(c.queries) >= maxCachedQueries {
+            c.queries = make(map[string]analysis.Analysis)
+        }
+        c.queries[key] = a
+    }
+    return a, v, nil
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "sort"
+    "strconv"
+    "strings"
+
+    "kcap/pkg/analysis"
+)
+
+// sample is one value of a metric; labels alternate names and values.
+type sample struct {
+    labels []string
+    value  float64
+}
+
+// metric is a metric family in the Prometheus text exposition format.
+type metric struct {
+    name    string
+    kind    string
+    help    string
+    samples []sample
+}
+
+// WriteMetrics writes the analysis of v as Prometheus gauges: per-node and
+// per-workload requests, usage and waste, recommendation counts by severity
+// and type, and the state of the refresh loop. CPU is in millicores, memory
+// in mebibytes and waste as a ratio of requests. Without pod usage, workload
+// usage and waste and the recommendations are left out rather than reported
+// from zero usage.
+func WriteMetrics(w io.Writer, v View) error {
+    bw := bufio.NewWriter(w)
+    for _, m := range collectMetrics(v) {
+        writeMetric(bw, m)
+    }
+    return bw.Flush()
+}
+
+func collectMetrics(v View) []metric {
+    a := v.Analysis
+    gauge := func(name, help string) *metric {
+        return &metric{name: name, kind: "gauge", help: help}
+    }
+
+    nodeCPUAlloc := gauge("kcap_node_cpu_allocatable_millicores", "Allocatable CPU of the node.")
+    nodeCPUReq := gauge("kcap_node_cpu_requested_millicores", "CPU requested by pods on the node.")
+    nodeCPUUsed := gauge("kcap_node_cpu_used_millicores", "CPU used on the node.")
+    nodeMemAlloc := gauge("kcap_node_memory_allocatable_mebibytes", "Allocatable memory of the node.")
+    nodeMemReq := gauge("kcap_node_memory_requested_mebibytes", "Memory requested by pods on the node.")
+    nodeMemUsed := gauge("kcap_node_memory_used_mebibytes", "Memory used on the node.")
+    nodeSysCPU := gauge("kcap_node_system_cpu_millicores", "CPU reserved for the system and requested by DaemonSet and kube-system pods.")
+    nodeSysMem := gauge("kcap_node_system_memory_mebibytes", "Memory reserved for the system and requested by DaemonSet and kube-system pods.")
+    nodePods := gauge("kcap_node_user_pods", "User pods running on the node.")
+    for _, n := range a.Nodes {
+        l := []string{"node", n.Name}
+        nodeCPUAlloc.add(l, float64(n.CPUAllocMilli))
+        nodeCPUReq.add(l, float64(n.CPUReqMilli))
+        nodeCPUUsed.add(l, float64(n.CPUUsedMilli))
+        nodeMemAlloc.add(l, float64(n.MemAllocMi))
+        nodeMemReq.add(l, float64(n.MemReqMi))
+        nodeMemUsed.add(l, float64(n.MemUsedMi))
+        nodeSysCPU.add(l, float64(n.SystemCPUMilli))
+        nodeSysMem.add(l, float64(n.SystemMemMi))
+        nodePods.add(l, float64(n.UserPodCount))
+    }
+
+    wlPods := gauge("kcap_workload_pods", "Pods of the workload.")
+    wlCPUReq := gauge("kcap_workload_cpu_requested_millicores", "CPU requested by the pods of the workload.")
+    wlCPUUsed := gauge("kcap_workload_cpu_used_millicores", "CPU used by the pods of the workload.")
+    wlMemReq := gauge("kcap_workload_memory_requested_mebibytes", "Memory requested by the pods of the workload.")
+    wlMemUsed := gauge("kcap_workload_memory_used_mebibytes", "Memory used by the pods of the workload.")
+    wlCPUWaste := gauge("kcap_workload_cpu_waste_ratio", "Share of the CPU requests of the workload left unused; negative when usage exceeds requests.")
+    wlMemWaste := gauge("kcap_workload_memory_waste_ratio", "Share of the memory requests of the workload left unused; negative when usage exceeds requests.")
+    for _, wl := range analysis.WorkloadAggregation(a.Pods) {
+        l := []string{"namespace", wl.Namespace, "kind", wl.Kind, "name", wl.Name}
+        wlPods.add(l, float64(wl.PodCount))
+        wlCPUReq.add(l, float64(wl.CPUReqMilli))
+        wlMemReq.add(l, float64(wl.MemReqMi))
+        if !a.UsageAvailable {
+            continue
+        }
+        wlCPUUsed.add(l, float64(wl.CPUUsedMilli))
+        wlMemUsed.add(l, float64(wl.MemUsedMi))
+        if wl.CPUReqMilli > 0 {
+            wlCPUWaste.add(l, wl.WasteCPU/100)
+        }
+        if wl.MemReqMi > 0 {
+            wlMemWaste.add(l, wl.WasteMem/100)
+        }
+    }
+
+    recs := gauge("kcap_recommendations_total", "Current recommendations by severity and type.")
+    counts := make(map[[2]string]int)
+    for _, r := range a.Recommendations {
+        // Container recommendations compare requests and limits with pod
+        // usage, which reads as zero without it.
+        if r.Container != "" && !a.UsageAvailable {
+            continue
+        }
+        counts[[2]string{r.Severity, r.Type}]++
+    }
+    keys := make([][2]string, 0, len(counts))
+    for k := range counts {
+        keys = append(keys, k)
+    }
+    sort.Slice(keys, func(i, j int) bool {
+        if keys[i][0] != keys[j][0] {
+            return keys[i][0] < keys[j][0]
+        }
+        return keys[i][1] < keys[j][1]
+    })
+    for _, k := range keys {
+        recs.add([]string{"severity", k[0], "type", k[1]}, float64(counts[k]))
+    }
+
+    ready := gauge("kcap_ready", "Whether an analysis is available (1) or not (0).")
+    ready.add(nil, boolValue(v.Ready()))
+    usageAvailable := gauge("kcap_usage_available", "Whether pod usage was available (1) or not (0) in the last refresh; workload usage and waste and container recommendations are only exported with it.")
+    usageAvailable.add(nil, boolValue(v.Ready() && a.UsageAvailable))
+    lastSuccess := gauge("kcap_last_refresh_success", "Whether the last refresh succeeded (1) or failed (0).")
+    lastSuccess.add(nil, boolValue(v.Err == nil && v.Ready()))
+    refreshed := gauge("kcap_last_refresh_timestamp_seconds", "Unix time of the last successful refresh.")
+    duration := gauge("kcap_last_refresh_duration_seconds", "Duration of the last successful refresh.")
+    if v.Ready() {
+        refreshed.add(nil, float64(v.Refreshed.UnixNano())/1e9)
+        duration.add(nil, v.Duration.Seconds())
+    }
+    failures := &metric{name: "kcap_refresh_failures_total", kind: "counter", help: "Refreshes that failed since start."}
+    failures.add(nil, float64(v.Failures))
+
+    return []metric{
+        *nodeCPUAlloc, *nodeCPUReq, *nodeCPUUsed,
+        *nodeMemAlloc, *nodeMemReq, *nodeMemUsed,
+        *nodeSysCPU, *nodeSysMem, *nodePods,
+        *wlPods, *wlCPUReq, *wlCPUUsed, *wlMemReq, *wlMemUsed, *wlCPUWaste, *wlMemWaste,
+        *recs,
+        *ready, *usageAvailable, *lastSuccess, *refreshed, *duration, *failures,
+    }
+}
+
+func (m *metric) add(labels []string, value float64) {
+    m.samples = append(m.samples, sample{labels: labels, value: value})
+}
+
+func boolValue(b bool) float64 {
+    if b {
+        return 1
+    }
+    return 0
+}
+
+func writeMetric(w io.Writer, m metric) {
+    fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+    fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+    for _, s := range m.samples {
+        w.Write([]byte(m.name))
+        if len(s.labels) > 0 {
+            pairs := make([]string, 0, len(s.labels)/2)
+            for i := 0; i+1 < len(s.labels); i += 2 {
+                pairs = append(pairs, s.labels[i]+`="`+escapeLabel(s.labels[i+1])+`"`)
+            }
+            fmt.Fprintf(w, "{%s}", strings.Join(pairs, ","))
+        }
+        fmt.Fprintf(w, " %s\n", strconv.FormatFloat(s.value, 'g', -1, 64))
+    }
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+    return labelEscaper.Replace(v)
+}
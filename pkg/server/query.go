@@ -0,0 +1,57 @@
+package server
+
+import (
+    "fmt"
+    "net/url"
+    "strconv"
+
+    "k8s.io/apimachinery/pkg/labels"
+)
+
+// Query narrows and tunes an analysis of the cached view with the same
+// settings as the CLI flags: namespace, threshold and selector.
+type Query struct {
+    Namespace string
+    // Threshold replaces the waste threshold of the policy when set.
+    Threshold *float64
+    // Selector keeps only the pods matching it when set.
+    Selector labels.Selector
+}
+
+// ParseQuery reads a Query from the namespace, threshold and selector query
+// parameters.
+func ParseQuery(values url.Values) (Query, error) {
+    q := Query{Namespace: values.Get("namespace")}
+    if v := values.Get("threshold"); v != "" {
+        threshold, err := strconv.ParseFloat(v, 64)
+        if err != nil || threshold < 0 || threshold > 100 {
+            return Query{}, fmt.Errorf("invalid threshold %q (expected a percentage between 0 and 100)", v)
+        }
+        q.Threshold = &threshold
+    }
+    if v := values.Get("selector"); v != "" {
+        selector, err := labels.Parse(v)
+        if err != nil {
+            return Query{}, fmt.Errorf("invalid selector %q: %w", v, err)
+        }
+        q.Selector = selector
+    }
+    return q, nil
+}
+
+// key identifies q among cached analyses.
+func (q Query) key() string {
+    key := q.Namespace + "\x00"
+    if q.Threshold != nil {
+        key += strconv.FormatFloat(*q.Threshold, 'g', -1, 64)
+    }
+    if q.Selector != nil {
+        key += "\x00" + q.Selector.String()
+    }
+    return key
+}
+
+// IsZero reports whether q leaves the analysis unchanged.
+func (q Query) IsZero() bool {
+    return q.Namespace == "" && q.Threshold == nil && q.Selector == nil
+}
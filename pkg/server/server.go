@@ -0,0 +1,38 @@
+package server
+
+import (
+    "fmt"
+    "net/http"
+
+    "kcap/pkg/cost"
+    "kcap/pkg/output"
+)
+
+// NewHandler serves the cached analysis as Prometheus metrics on /metrics and
+// as JSON under /api/v1/, with /healthz for liveness and /readyz, which fails
+// until the first successful refresh, for readiness. cluster describes the
+// cluster in API responses and pricing prices the DaemonSets of the report.
+func NewHandler(c *Cache, cluster output.Cluster, pricing *cost.Pricing) http.Handler {
+    mux := http.NewServeMux()
+    registerAPI(mux, c, cluster, pricing)
+    mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+        WriteMetrics(w, c.View())
+    })
+    mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+        fmt.Fprintln(w, "ok")
+    })
+    mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+        v := c.View()
+        if !v.Ready() {
+            msg := ErrNotReady.Error()
+            if v.Err != nil {
+                msg += ": " + v.Err.Error()
+            }
+            http.Error(w, msg, http.StatusServiceUnavailable)
+            return
+        }
+        fmt.Fprintln(w, "ok")
+    })
+    return mux
+}
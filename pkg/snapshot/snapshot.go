@@ -0,0 +1,441 @@
+package snapshot
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "slices"
+    "strings"
+    "time"
+
+    appsv1 "k8s.io/api/apps/v1"
+    batchv1 "k8s.io/api/batch/v1"
+    v1 "k8s.io/api/core/v1"
+    policyv1 "k8s.io/api/policy/v1"
+    apierrors "k8s.io/apimachinery/pkg/api/errors"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+    "kcap/pkg/k8s"
+    "kcap/pkg/usage"
+)
+
+// Version is the snapshot file format version written by Capture.
+const Version = 1
+
+// Snapshot is a point-in-time capture of the cluster objects and usage that
+// kcap analyzes. It implements k8s.ClusterReader and usage.Provider, so every
+// command can run from a file instead of a live API server.
+type Snapshot struct {
+    Version     int                            `json:"version"`
+    CapturedAt  time.Time                      `json:"capturedAt"`
+    Namespace   string                         `json:"namespace,omitempty"`
+    Nodes       []v1.Node                      `json:"nodes"`
+    Pods        []v1.Pod                       `json:"pods"`
+    PDBs        []policyv1.PodDisruptionBudget `json:"podDisruptionBudgets,omitempty"`
+    Deployments []appsv1.Deployment            `json:"deployments,omitempty"`
+    Namespaces  []v1.Namespace                 `json:"namespaces,omitempty"`
+    ReplicaSets []appsv1.ReplicaSet            `json:"replicaSets,omitempty"`
+    Jobs        []batchv1.Job                  `json:"jobs,omitempty"`
+    Quotas      []v1.ResourceQuota             `json:"resourceQuotas,omitempty"`
+    LimitRanges []v1.LimitRange                `json:"limitRanges,omitempty"`
+    NodeMetrics []NodeUsage                    `json:"nodeMetrics,omitempty"`
+    PodMetrics  []PodUsage                     `json:"podMetrics,omitempty"`
+    // Warnings records data that could not be captured.
+    Warnings []string `json:"warnings,omitempty"`
+}
+
+type NodeUsage struct {
+    Name  string      `json:"name"`
+    Usage usage.Stats `json:"usage"`
+}
+
+type PodUsage struct {
+    Namespace  string                 `json:"namespace"`
+    Name       string                 `json:"name"`
+    Usage      usage.Stats            `json:"usage"`
+    Containers map[string]usage.Stats `json:"containers,omitempty"`
+}
+
+// Capture reads nodes, pods, PDBs, Deployments, namespaces, ReplicaSets, Jobs,
+// ResourceQuotas, LimitRanges and usage from the cluster. Only nodes and pods
+// are required; anything else that cannot be read is recorded in Warnings
+// instead. Pods, PDBs and their usage are read from every namespace, as node
+// figures and scale-in count them all, unless only namespace may be read.
+// Snapshots are meant to be shared, so the objects are scrubbed of anything
+// the analysis does not read that may hold secrets.
+func Capture(ctx context.Context, reader k8s.ClusterReader, provider usage.Provider, namespace string) (*Snapshot, error) {
+    s := &Snapshot{
+        Version:    Version,
+        CapturedAt: time.Now().UTC(),
+        Namespace:  namespace,
+    }
+
+    var err error
+    if s.Nodes, err = reader.ListNodes(ctx); err != nil {
+        return nil, fmt.Errorf("listing nodes: %w", err)
+    }
+    s.Pods, err = everyNamespace(s, namespace, "pods", func(ns string) ([]v1.Pod, error) {
+        return reader.ListPods(ctx, ns)
+    })
+    if err != nil {
+        return nil, fmt.Errorf("listing pods: %w", err)
+    }
+
+    s.PDBs, err = everyNamespace(s, namespace, "pod disruption budgets", func(ns string) ([]policyv1.PodDisruptionBudget, error) {
+        return reader.ListPDBs(ctx, ns)
+    })
+    if err != nil {
+        s.Warnings = append(s.Warnings, "pod disruption budgets: "+err.Error())
+    }
+    if s.Deployments, err = reader.ListDeployments(ctx, namespace); err != nil {
+        s.Warnings = append(s.Warnings, "deployments: "+err.Error())
+    }
+    if namespace == "" {
+        s.Namespaces, err = reader.ListNamespaces(ctx)
+    } else {
+        var ns *v1.Namespace
+        if ns, err = reader.GetNamespace(ctx, namespace); err == nil {
+            s.Namespaces = []v1.Namespace{*ns}
+        }
+    }
+    if err != nil {
+        s.Warnings = append(s.Warnings, "namespaces: "+err.Error())
+    }
+    if s.ReplicaSets, err = reader.ListReplicaSets(ctx, namespace); err != nil {
+        s.Warnings = append(s.Warnings, "replica sets: "+err.Error())
+    }
+    if s.Jobs, err = reader.ListJobs(ctx, namespace); err != nil {
+        s.Warnings = append(s.Warnings, "jobs: "+err.Error())
+    }
+    if s.Quotas, err = reader.ListResourceQuotas(ctx, namespace); err != nil {
+        s.Warnings = append(s.Warnings, "resource quotas: "+err.Error())
+    }
+    if s.LimitRanges, err = reader.ListLimitRanges(ctx, namespace); err != nil {
+        s.Warnings = append(s.Warnings, "limit ranges: "+err.Error())
+    }
+
+    nodeUsage, err := provider.NodeUsage(ctx)
+    if err != nil {
+        s.Warnings = append(s.Warnings, "node usage: "+err.Error())
+    }
+    for name, stats := range nodeUsage {
+        s.NodeMetrics = append(s.NodeMetrics, NodeUsage{Name: name, Usage: stats})
+    }
+    podUsage, err := everyNamespace(s, namespace, "pod usage", func(ns string) (map[k8s.PodKey]usage.Stats, error) {
+        return provider.PodUsage(ctx, ns)
+    })
+    if err != nil {
+        s.Warnings = append(s.Warnings, "pod usage: "+err.Error())
+    }
+    containerUsage, err := everyNamespace(s, namespace, "container usage", func(ns string) (map[k8s.PodKey]map[string]usage.Stats, error) {
+        return provider.ContainerUsage(ctx, ns)
+    })
+    if err != nil {
+        s.Warnings = append(s.Warnings, "container usage: "+err.Error())
+    }
+    // Either listing may be partial, so keep every pod reported by one.
+    keys := make(map[k8s.PodKey]bool, len(podUsage))
+    for key := range podUsage {
+        keys[key] = true
+    }
+    for key := range containerUsage {
+        keys[key] = true
+    }
+    for key := range keys {
+        s.PodMetrics = append(s.PodMetrics, PodUsage{
+            Namespace:  key.Namespace,
+            Name:       key.Name,
+            Usage:      podUsage[key],
+            Containers: containerUsage[key],
+        })
+    }
+    s.scrub()
+    return s, nil
+}
+
+// everyNamespace lists what with list for every namespace. If that is
+// forbidden and namespace is set, it lists namespace alone and records in
+// Warnings that what covers no other namespace.
+func everyNamespace[T any](s *Snapshot, namespace, what string, list func(namespace string) (T, error)) (T, error) {
+    all, err := list("")
+    if err == nil || namespace == "" || !apierrors.IsForbidden(err) {
+        return all, err
+    }
+    scoped, nsErr := list(namespace)
+    if nsErr == nil {
+        s.Warnings = append(s.Warnings, fmt.Sprintf("%s of other namespaces: %v", what, err))
+    }
+    return scoped, nsErr
+}
+
+// lastAppliedAnnotation holds the full manifest last applied with kubectl.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// scrub removes managed fields, last-applied manifests and container
+// environment, commands and arguments from the captured objects. Objects
+// read from a cache or another snapshot share their lists, maps and slices
+// with it, so those are replaced rather than modified.
+func (s *Snapshot) scrub() {
+    s.Nodes = slices.Clone(s.Nodes)
+    s.Pods = slices.Clone(s.Pods)
+    s.PDBs = slices.Clone(s.PDBs)
+    s.Deployments = slices.Clone(s.Deployments)
+    s.Namespaces = slices.Clone(s.Namespaces)
+    s.ReplicaSets = slices.Clone(s.ReplicaSets)
+    s.Jobs = slices.Clone(s.Jobs)
+    s.Quotas = slices.Clone(s.Quotas)
+    s.LimitRanges = slices.Clone(s.LimitRanges)
+    for i := range s.Nodes {
+        scrubMeta(&s.Nodes[i].ObjectMeta)
+    }
+    for i := range s.Pods {
+        scrubMeta(&s.Pods[i].ObjectMeta)
+        scrubPodSpec(&s.Pods[i].Spec)
+    }
+    for i := range s.PDBs {
+        scrubMeta(&s.PDBs[i].ObjectMeta)
+    }
+    for i := range s.Deployments {
+        scrubMeta(&s.Deployments[i].ObjectMeta)
+        scrubPodSpec(&s.Deployments[i].Spec.Template.Spec)
+    }
+    for i := range s.Namespaces {
+        scrubMeta(&s.Namespaces[i].ObjectMeta)
+    }
+    for i := range s.ReplicaSets {
+        scrubMeta(&s.ReplicaSets[i].ObjectMeta)
+        scrubPodSpec(&s.ReplicaSets[i].Spec.Template.Spec)
+    }
+    for i := range s.Jobs {
+        scrubMeta(&s.Jobs[i].ObjectMeta)
+        scrubPodSpec(&s.Jobs[i].Spec.Template.Spec)
+    }
+    for i := range s.Quotas {
+        scrubMeta(&s.Quotas[i].ObjectMeta)
+    }
+    for i := range s.LimitRanges {
+        scrubMeta(&s.LimitRanges[i].ObjectMeta)
+    }
+}
+
+func scrubMeta(m *metav1.ObjectMeta) {
+    m.ManagedFields = nil
+    if _, ok := m.Annotations[lastAppliedAnnotation]; !ok {
+        return
+    }
+    annotations := make(map[string]string, len(m.Annotations)-1)
+    for k, v := range m.Annotations {
+        if k != lastAppliedAnnotation {
+            annotations[k] = v
+        }
+    }
+    m.Annotations = annotations
+}
+
+func scrubPodSpec(spec *v1.PodSpec) {
+    spec.InitContainers = scrubContainers(spec.InitContainers)
+    spec.Containers = scrubContainers(spec.Containers)
+    if len(spec.EphemeralContainers) > 0 {
+        ephemeral := make([]v1.EphemeralContainer, len(spec.EphemeralContainers))
+        for i, c := range spec.EphemeralContainers {
+            c.Env, c.EnvFrom, c.Command, c.Args = nil, nil, nil, nil
+            ephemeral[i] = c
+        }
+        spec.EphemeralContainers = ephemeral
+    }
+}
+
+func scrubContainers(containers []v1.Container) []v1.Container {
+    if len(containers) == 0 {
+        return containers
+    }
+    out := make([]v1.Container, len(containers))
+    for i, c := range containers {
+        c.Env, c.EnvFrom, c.Command, c.Args = nil, nil, nil, nil
+        out[i] = c
+    }
+    return out
+}
+
+// Save writes the snapshot to path as indented JSON.
+func (s *Snapshot) Save(path string) error {
+    data, err := json.MarshalIndent(s, "", "  ")
+    if err != nil {
+        return err
+    }
+    return os.WriteFile(path, data, 0o644)
+}
+
+// Load reads a snapshot written by Save.
+func Load(path string) (*Snapshot, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var s Snapshot
+    if err := json.Unmarshal(data, &s); err != nil {
+        return nil, fmt.Errorf("parsing snapshot %s: %w", path, err)
+    }
+    if s.Version > Version {
+        return nil, fmt.Errorf("snapshot %s has version %d, newer than supported version %d", path, s.Version, Version)
+    }
+    return &s, nil
+}
+
+func (s *Snapshot) ListNodes(ctx context.Context) ([]v1.Node, error) {
+    return s.Nodes, nil
+}
+
+func (s *Snapshot) ListPods(ctx context.Context, namespace string) ([]v1.Pod, error) {
+    if namespace == "" {
+        return s.Pods, nil
+    }
+    var pods []v1.Pod
+    for _, p := range s.Pods {
+        if p.Namespace == namespace {
+            pods = append(pods, p)
+        }
+    }
+    return pods, nil
+}
+
+func (s *Snapshot) ListPDBs(ctx context.Context, namespace string) ([]policyv1.PodDisruptionBudget, error) {
+    if namespace == "" {
+        return s.PDBs, nil
+    }
+    var pdbs []policyv1.PodDisruptionBudget
+    for _, p := range s.PDBs {
+        if p.Namespace == namespace {
+            pdbs = append(pdbs, p)
+        }
+    }
+    return pdbs, nil
+}
+
+func (s *Snapshot) ListDeployments(ctx context.Context, namespace string) ([]appsv1.Deployment, error) {
+    if namespace == "" {
+        return s.Deployments, nil
+    }
+    var deployments []appsv1.Deployment
+    for _, d := range s.Deployments {
+        if d.Namespace == namespace {
+            deployments = append(deployments, d)
+        }
+    }
+    return deployments, nil
+}
+
+func (s *Snapshot) ListNamespaces(ctx context.Context) ([]v1.Namespace, error) {
+    return s.Namespaces, nil
+}
+
+func (s *Snapshot) GetNamespace(ctx context.Context, name string) (*v1.Namespace, error) {
+    for i := range s.Namespaces {
+        if s.Namespaces[i].Name == name {
+            return &s.Namespaces[i], nil
+        }
+    }
+    return nil, apierrors.NewNotFound(v1.Resource("namespaces"), name)
+}
+
+func (s *Snapshot) ListReplicaSets(ctx context.Context, namespace string) ([]appsv1.ReplicaSet, error) {
+    if namespace == "" {
+        return s.ReplicaSets, nil
+    }
+    var replicaSets []appsv1.ReplicaSet
+    for _, r := range s.ReplicaSets {
+        if r.Namespace == namespace {
+            replicaSets = append(replicaSets, r)
+        }
+    }
+    return replicaSets, nil
+}
+
+func (s *Snapshot) ListJobs(ctx context.Context, namespace string) ([]batchv1.Job, error) {
+    if namespace == "" {
+        return s.Jobs, nil
+    }
+    var jobs []batchv1.Job
+    for _, j := range s.Jobs {
+        if j.Namespace == namespace {
+            jobs = append(jobs, j)
+        }
+    }
+    return jobs, nil
+}
+
+func (s *Snapshot) ListResourceQuotas(ctx context.Context, namespace string) ([]v1.ResourceQuota, error) {
+    if namespace == "" {
+        return s.Quotas, nil
+    }
+    var quotas []v1.ResourceQuota
+    for _, q := range s.Quotas {
+        if q.Namespace == namespace {
+            quotas = append(quotas, q)
+        }
+    }
+    return quotas, nil
+}
+
+func (s *Snapshot) ListLimitRanges(ctx context.Context, namespace string) ([]v1.LimitRange, error) {
+    if namespace == "" {
+        return s.LimitRanges, nil
+    }
+    var limitRanges []v1.LimitRange
+    for _, l := range s.LimitRanges {
+        if l.Namespace == namespace {
+            limitRanges = append(limitRanges, l)
+        }
+    }
+    return limitRanges, nil
+}
+
+func (s *Snapshot) NodeUsage(ctx context.Context) (map[string]usage.Stats, error) {
+    if err := s.usageErr("node usage"); err != nil {
+        return nil, err
+    }
+    out := make(map[string]usage.Stats, len(s.NodeMetrics))
+    for _, n := range s.NodeMetrics {
+        out[n.Name] = n.Usage
+    }
+    return out, nil
+}
+
+func (s *Snapshot) PodUsage(ctx context.Context, namespace string) (map[k8s.PodKey]usage.Stats, error) {
+    if err := s.usageErr("pod usage"); err != nil {
+        return nil, err
+    }
+    out := make(map[k8s.PodKey]usage.Stats, len(s.PodMetrics))
+    for _, p := range s.PodMetrics {
+        if namespace == "" || p.Namespace == namespace {
+            out[k8s.PodKey{Namespace: p.Namespace, Name: p.Name}] = p.Usage
+        }
+    }
+    return out, nil
+}
+
+func (s *Snapshot) ContainerUsage(ctx context.Context, namespace string) (map[k8s.PodKey]map[string]usage.Stats, error) {
+    if err := s.usageErr("container usage"); err != nil {
+        return nil, err
+    }
+    out := make(map[k8s.PodKey]map[string]usage.Stats, len(s.PodMetrics))
+    for _, p := range s.PodMetrics {
+        if namespace == "" || p.Namespace == namespace {
+            out[k8s.PodKey{Namespace: p.Namespace, Name: p.Name}] = p.Containers
+        }
+    }
+    return out, nil
+}
+
+// usageErr returns the error recorded in Warnings when the named usage could
+// not be captured, so a snapshot without usage fails like the live provider
+// did instead of reporting zero usage.
+func (s *Snapshot) usageErr(name string) error {
+    for _, w := range s.Warnings {
+        if msg, ok := strings.CutPrefix(w, name+": "); ok {
+            return errors.New(msg)
+        }
+    }
+    return nil
+}
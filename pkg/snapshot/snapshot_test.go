@@ -0,0 +1,75 @@
+package snapshot
+
+import (
+    "context"
+    "testing"
+
+    v1 "k8s.io/api/core/v1"
+    metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testPod(namespace, name string) v1.Pod {
+    return v1.Pod{
+        ObjectMeta: metav1.ObjectMeta{
+            Namespace:     namespace,
+            Name:          name,
+            Annotations:   map[string]string{lastAppliedAnnotation: `{"kind":"Pod"}`, "kcap.io/ignore": "false"},
+            ManagedFields: []metav1.ManagedFieldsEntry{{Manager: "kubectl"}},
+        },
+        Spec: v1.PodSpec{
+            NodeName: "node-a",
+            Containers: []v1.Container{{
+                Name:    "app",
+                Env:     []v1.EnvVar{{Name: "PASSWORD", Value: "hunter2"}},
+                Command: []string{"app", "--token=secret"},
+            }},
+        },
+    }
+}
+
+// TestCaptureScrubsObjects checks that captured objects lose environment,
+// commands, managed fields and last-applied manifests, without changing the
+// objects they were read from.
+func TestCaptureScrubsObjects(t *testing.T) {
+    source := &Snapshot{Pods: []v1.Pod{testPod("shop", "web-0")}}
+
+    snap, err := Capture(context.Background(), source, source, "")
+    if err != nil {
+        t.Fatalf("Capture: %v", err)
+    }
+    p := snap.Pods[0]
+    if c := p.Spec.Containers[0]; c.Env != nil || c.Command != nil {
+        t.Errorf("container kept env %v and command %v", c.Env, c.Command)
+    }
+    if p.ManagedFields != nil {
+        t.Errorf("pod kept managed fields %v", p.ManagedFields)
+    }
+    if _, ok := p.Annotations[lastAppliedAnnotation]; ok {
+        t.Error("pod kept the last-applied annotation")
+    }
+    if p.Annotations["kcap.io/ignore"] != "false" {
+        t.Errorf("pod lost its other annotations: %v", p.Annotations)
+    }
+
+    src := source.Pods[0]
+    if src.Spec.Containers[0].Env == nil || src.Annotations[lastAppliedAnnotation] == "" {
+        t.Error("Capture modified the objects it read")
+    }
+}
+
+// TestCaptureNamespaceKeepsEveryPod checks that a namespaced capture still
+// holds the pods of every namespace, which node figures count.
+func TestCaptureNamespaceKeepsEveryPod(t *testing.T) {
+    source := &Snapshot{Pods: []v1.Pod{testPod("shop", "web-0"), testPod("blog", "web-0")}}
+
+    snap, err := Capture(context.Background(), source, source, "shop")
+    if err != nil {
+        t.Fatalf("Capture: %v", err)
+    }
+    if len(snap.Pods) != 2 {
+        t.Fatalf("captured %d pods, want 2", len(snap.Pods))
+    }
+    if snap.Namespace != "shop" {
+        t.Errorf("namespace = %q, want shop", snap.Namespace)
+    }
+}
@@ -0,0 +1,58 @@
+package usage
+
+import (
+    "context"
+
+    "kcap/pkg/k8s"
+)
+
+// MetricsServerProvider reads instantaneous usage from metrics-server.
+// Since only a single sample is available, all percentiles are equal.
+type MetricsServerProvider struct {
+    client *k8s.K8sClient
+}
+
+// NewMetricsServerProvider creates a provider backed by the metrics API of the given client.
+func NewMetricsServerProvider(client *k8s.K8sClient) *MetricsServerProvider {
+    return &MetricsServerProvider{client: client}
+}
+
+func (p *MetricsServerProvider) NodeUsage(ctx context.Context) (map[string]Stats, error) {
+    nodeMetrics, err := p.client.NodeMetrics(ctx)
+    if err != nil {
+        return nil, err
+    }
+    out := make(map[string]Stats, len(nodeMetrics))
+    for name, sample := range nodeMetrics {
+        out[name] = instantStats(sample)
+    }
+    return out, nil
+}
+
+func (p *MetricsServerProvider) PodUsage(ctx context.Context, namespace string) (map[k8s.PodKey]Stats, error) {
+    podMetrics, err := p.client.PodMetrics(ctx, namespace)
+    if err != nil {
+        return nil, err
+    }
+    out := make(map[k8s.PodKey]Stats, len(podMetrics))
+    for key, sample := range podMetrics {
+        out[key] = instantStats(sample)
+    }
+    return out, nil
+}
+
+func (p *MetricsServerProvider) ContainerUsage(ctx context.Context, namespace string) (map[k8s.PodKey]map[string]Stats, error) {
+    containerMetrics, err := p.client.ContainerMetrics(ctx, namespace)
+    if err != nil {
+        return nil, err
+    }
+    out := make(map[k8s.PodKey]map[string]Stats, len(containerMetrics))
+    for pod, containers := range containerMetrics {
+        stats := make(map[string]Stats, len(containers))
+        for name, sample := range containers {
+            stats[name] = instantStats(sample)
+        }
+        out[pod] = stats
+    }
+    return out, nil
+}
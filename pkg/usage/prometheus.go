@@ -0,0 +1,227 @@
+package usage
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "math"
+    "net/http"
+    "net/url"
+    "regexp"
+    "strconv"
+    "strings"
+
+    v1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+    "kcap/pkg/k8s"
+)
+
+const (
+    DefaultWindow = "7d"
+    DefaultStep   = "5m"
+)
+
+var promDurationRe = regexp.MustCompile(`^([0-9]+(ms|s|m|h|d|w|y))+$`)
+
+// PrometheusProvider queries a Prometheus HTTP API for cAdvisor container
+// metrics and summarises them over a lookback window.
+type PrometheusProvider struct {
+    URL    string
+    Window string // lookback window in Prometheus duration format, e.g. "7d"
+    Step   string // subquery resolution and rate() interval
+    Client *http.Client
+}
+
+// NewPrometheusProvider creates a provider for the Prometheus server at baseURL.
+func NewPrometheusProvider(baseURL, window string) (*PrometheusProvider, error) {
+    if _, err := url.ParseRequestURI(baseURL); err != nil {
+        return nil, fmt.Errorf("invalid prometheus url %q: %w", baseURL, err)
+    }
+    if window == "" {
+        window = DefaultWindow
+    }
+    if !promDurationRe.MatchString(window) {
+        return nil, fmt.Errorf("invalid window %q (expected a duration like 1h, 7d or 2w)", window)
+    }
+    return &PrometheusProvider{
+        URL:    strings.TrimRight(baseURL, "/"),
+        Window: window,
+        Step:   DefaultStep,
+        Client: http.DefaultClient,
+    }, nil
+}
+
+func (p *PrometheusProvider) NodeUsage(ctx context.Context) (map[string]Stats, error) {
+    cpu := fmt.Sprintf(`sum by (node) (rate(container_cpu_usage_seconds_total{id="/"}[%s]))`, p.Step)
+    mem := `sum by (node) (container_memory_working_set_bytes{id="/"})`
+    return collect(ctx, p, cpu, mem, func(m map[string]string) string {
+        return m["node"]
+    })
+}
+
+func (p *PrometheusProvider) PodUsage(ctx context.Context, namespace string) (map[k8s.PodKey]Stats, error) {
+    cpu, mem := p.containerExprs(namespace, "namespace, pod")
+    return collect(ctx, p, cpu, mem, func(m map[string]string) k8s.PodKey {
+        if m["pod"] == "" {
+            return k8s.PodKey{}
+        }
+        return k8s.PodKey{Namespace: m["namespace"], Name: m["pod"]}
+    })
+}
+
+func (p *PrometheusProvider) ContainerUsage(ctx context.Context, namespace string) (map[k8s.PodKey]map[string]Stats, error) {
+    type podContainer struct {
+        pod       k8s.PodKey
+        container string
+    }
+    cpu, mem := p.containerExprs(namespace, "namespace, pod, container")
+    stats, err := collect(ctx, p, cpu, mem, func(m map[string]string) podContainer {
+        if m["pod"] == "" || m["container"] == "" {
+            return podContainer{}
+        }
+        return podContainer{pod: k8s.PodKey{Namespace: m["namespace"], Name: m["pod"]}, container: m["container"]}
+    })
+    if err != nil {
+        return nil, err
+    }
+    out := make(map[k8s.PodKey]map[string]Stats)
+    for k, s := range stats {
+        if out[k.pod] == nil {
+            out[k.pod] = make(map[string]Stats)
+        }
+        out[k.pod][k.container] = s
+    }
+    return out, nil
+}
+
+// containerExprs returns the CPU and memory expressions for application
+// containers in namespace, aggregated by the given labels.
+func (p *PrometheusProvider) containerExprs(namespace, by string) (string, string) {
+    selector := `container!="",container!="POD"`
+    if namespace != "" {
+        selector += fmt.Sprintf(`,namespace=%q`, namespace)
+    }
+    cpu := fmt.Sprintf(`sum by (%s) (rate(container_cpu_usage_seconds_total{%s}[%s]))`, by, selector, p.Step)
+    mem := fmt.Sprintf(`sum by (%s) (container_memory_working_set_bytes{%s})`, by, selector)
+    return cpu, mem
+}
+
+// collect evaluates the CPU (cores) and memory (bytes) expressions over the
+// window at each percentile and groups the results by the key derived from
+// the series labels. Series with a zero key are skipped.
+func collect[K comparable](ctx context.Context, p *PrometheusProvider, cpuExpr, memExpr string, key func(map[string]string) K) (map[K]Stats, error) {
+    var zero K
+    out := make(map[K]Stats)
+    for _, pct := range []float64{50, 95, 99, 100} {
+        for _, res := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+            expr := cpuExpr
+            if res == v1.ResourceMemory {
+                expr = memExpr
+            }
+            samples, err := p.query(ctx, p.overWindow(expr, pct))
+            if err != nil {
+                return nil, err
+            }
+            for _, s := range samples {
+                k := key(s.labels)
+                if k == zero {
+                    continue
+                }
+                st := out[k]
+                list := st.At(pct)
+                if list == nil {
+                    list = v1.ResourceList{}
+                }
+                if res == v1.ResourceCPU {
+                    list[res] = *resource.NewMilliQuantity(int64(math.Round(s.value*1000)), resource.DecimalSI)
+                } else {
+                    list[res] = *resource.NewQuantity(int64(s.value), resource.BinarySI)
+                }
+                switch pct {
+                case 50:
+                    st.P50 = list
+                case 95:
+                    st.P95 = list
+                case 99:
+                    st.P99 = list
+                case 100:
+                    st.Max = list
+                }
+                out[k] = st
+            }
+        }
+    }
+    return out, nil
+}
+
+// overWindow wraps expr in a subquery evaluated over the lookback window.
+func (p *PrometheusProvider) overWindow(expr string, percentile float64) string {
+    if percentile == 100 {
+        return fmt.Sprintf("max_over_time((%s)[%s:%s])", expr, p.Window, p.Step)
+    }
+    return fmt.Sprintf("quantile_over_time(%g, (%s)[%s:%s])", percentile/100, expr, p.Window, p.Step)
+}
+
+type promSample struct {
+    labels map[string]string
+    value  float64
+}
+
+type promResponse struct {
+    Status    string `json:"status"`
+    ErrorType string `json:"errorType"`
+    Error     string `json:"error"`
+    Data      struct {
+        ResultType string `json:"resultType"`
+        Result     []struct {
+            Metric map[string]string `json:"metric"`
+            Value  []interface{}     `json:"value"`
+        } `json:"result"`
+    } `json:"data"`
+}
+
+// query runs an instant query and returns the resulting vector.
+func (p *PrometheusProvider) query(ctx context.Context, expr string) ([]promSample, error) {
+    u := p.URL + "/api/v1/query?" + url.Values{"query": {expr}}.Encode()
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+    if err != nil {
+        return nil, err
+    }
+    client := p.Client
+    if client == nil {
+        client = http.DefaultClient
+    }
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    var pr promResponse
+    if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
+        return nil, fmt.Errorf("decoding prometheus response (HTTP %d): %w", resp.StatusCode, err)
+    }
+    if pr.Status != "success" {
+        return nil, fmt.Errorf("prometheus query failed: %s: %s", pr.ErrorType, pr.Error)
+    }
+    if pr.Data.ResultType != "vector" {
+        return nil, fmt.Errorf("unexpected prometheus result type %q", pr.Data.ResultType)
+    }
+
+    samples := make([]promSample, 0, len(pr.Data.Result))
+    for _, r := range pr.Data.Result {
+        if len(r.Value) != 2 {
+            continue
+        }
+        raw, ok := r.Value[1].(string)
+        if !ok {
+            continue
+        }
+        v, err := strconv.ParseFloat(raw, 64)
+        if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+            continue
+        }
+        samples = append(samples, promSample{labels: r.Metric, value: v})
+    }
+    return samples, nil
+}
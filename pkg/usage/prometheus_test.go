@@ -0,0 +1,214 @@
+package usage
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    v1 "k8s.io/api/core/v1"
+    "kcap/pkg/k8s"
+)
+
+// sampleCores and sampleMiB are the canned CPU and memory values returned
+// for each percentile, so tests can tell which query a value came from.
+var (
+    sampleCores = map[string]float64{"0.5": 0.1, "0.95": 0.2, "0.99": 0.3, "max": 0.4}
+    sampleMiB   = map[string]int64{"0.5": 100, "0.95": 200, "0.99": 300, "max": 400}
+)
+
+type promSeries struct {
+    Metric map[string]string `json:"metric"`
+    Value  []interface{}     `json:"value"`
+}
+
+// fakePrometheus answers /api/v1/query with a vector per query shape: node
+// series for root cgroup queries, and pod or container series otherwise.
+func fakePrometheus(t *testing.T) *httptest.Server {
+    t.Helper()
+    return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.URL.Path != "/api/v1/query" {
+            http.NotFound(w, r)
+            return
+        }
+        query := r.URL.Query().Get("query")
+
+        pct := "max"
+        for _, q := range []string{"0.5", "0.95", "0.99"} {
+            if strings.HasPrefix(query, "quantile_over_time("+q+",") {
+                pct = q
+            }
+        }
+        value := fmt.Sprint(sampleMiB[pct] * 1024 * 1024)
+        if strings.Contains(query, "container_cpu_usage_seconds_total") {
+            value = fmt.Sprint(sampleCores[pct])
+        }
+
+        var metrics []map[string]string
+        switch {
+        case strings.Contains(query, `id="/"`):
+            metrics = []map[string]string{{"node": "node-a"}, {"node": ""}}
+        case strings.Contains(query, "by (namespace, pod, container)"):
+            metrics = []map[string]string{
+                {"namespace": "team-a", "pod": "web-0", "container": "app"},
+                {"namespace": "team-a", "pod": "web-0", "container": "sidecar"},
+                {"namespace": "team-b", "pod": "web-0", "container": "app"},
+            }
+        case strings.Contains(query, "by (namespace, pod)"):
+            metrics = []map[string]string{
+                {"namespace": "team-a", "pod": "web-0"},
+                {"namespace": "team-b", "pod": "web-0"},
+                {"namespace": "team-b"},
+            }
+        }
+
+        result := make([]promSeries, len(metrics))
+        for i, m := range metrics {
+            result[i] = promSeries{Metric: m, Value: []interface{}{1700000000.0, value}}
+        }
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "status": "success",
+            "data":   map[string]interface{}{"resultType": "vector", "result": result},
+        })
+    }))
+}
+
+func newTestProvider(t *testing.T, url string) *PrometheusProvider {
+    t.Helper()
+    p, err := NewPrometheusProvider(url, "1d")
+    if err != nil {
+        t.Fatalf("NewPrometheusProvider: %v", err)
+    }
+    return p
+}
+
+// checkStats asserts that every percentile of s holds the canned sample of
+// the matching query.
+func checkStats(t *testing.T, name string, s Stats) {
+    t.Helper()
+    for _, tc := range []struct {
+        percentile float64
+        sample     string
+    }{{50, "0.5"}, {95, "0.95"}, {99, "0.99"}, {100, "max"}} {
+        list := s.At(tc.percentile)
+        cpu := list[v1.ResourceCPU]
+        mem := list[v1.ResourceMemory]
+        if want := int64(sampleCores[tc.sample] * 1000); cpu.MilliValue() != want {
+            t.Errorf("%s p%v cpu = %dm, want %dm", name, tc.percentile, cpu.MilliValue(), want)
+        }
+        if want := sampleMiB[tc.sample] * 1024 * 1024; mem.Value() != want {
+            t.Errorf("%s p%v memory = %d, want %d", name, tc.percentile, mem.Value(), want)
+        }
+    }
+}
+
+func TestPrometheusNodeUsage(t *testing.T) {
+    srv := fakePrometheus(t)
+    defer srv.Close()
+
+    nodes, err := newTestProvider(t, srv.URL).NodeUsage(context.Background())
+    if err != nil {
+        t.Fatalf("NodeUsage: %v", err)
+    }
+    if len(nodes) != 1 {
+        t.Fatalf("NodeUsage returned %d nodes, want 1: %v", len(nodes), nodes)
+    }
+    checkStats(t, "node-a", nodes["node-a"])
+}
+
+func TestPrometheusPodUsage(t *testing.T) {
+    srv := fakePrometheus(t)
+    defer srv.Close()
+
+    pods, err := newTestProvider(t, srv.URL).PodUsage(context.Background(), "")
+    if err != nil {
+        t.Fatalf("PodUsage: %v", err)
+    }
+    if len(pods) != 2 {
+        t.Fatalf("PodUsage returned %d pods, want 2: %v", len(pods), pods)
+    }
+    for _, key := range []k8s.PodKey{{Namespace: "team-a", Name: "web-0"}, {Namespace: "team-b", Name: "web-0"}} {
+        s, ok := pods[key]
+        if !ok {
+            t.Errorf("PodUsage is missing %s", key)
+            continue
+        }
+        checkStats(t, key.String(), s)
+    }
+}
+
+func TestPrometheusContainerUsage(t *testing.T) {
+    srv := fakePrometheus(t)
+    defer srv.Close()
+
+    containers, err := newTestProvider(t, srv.URL).ContainerUsage(context.Background(), "")
+    if err != nil {
+        t.Fatalf("ContainerUsage: %v", err)
+    }
+    want := map[k8s.PodKey][]string{
+        {Namespace: "team-a", Name: "web-0"}: {"app", "sidecar"},
+        {Namespace: "team-b", Name: "web-0"}: {"app"},
+    }
+    if len(containers) != len(want) {
+        t.Fatalf("ContainerUsage returned %d pods, want %d: %v", len(containers), len(want), containers)
+    }
+    for key, names := range want {
+        if len(containers[key]) != len(names) {
+            t.Errorf("%s has %d containers, want %d", key, len(containers[key]), len(names))
+        }
+        for _, name := range names {
+            s, ok := containers[key][name]
+            if !ok {
+                t.Errorf("%s is missing container %s", key, name)
+                continue
+            }
+            checkStats(t, key.String()+"/"+name, s)
+        }
+    }
+}
+
+func TestPrometheusSelect(t *testing.T) {
+    srv := fakePrometheus(t)
+    defer srv.Close()
+
+    nodes, err := newTestProvider(t, srv.URL).NodeUsage(context.Background())
+    if err != nil {
+        t.Fatalf("NodeUsage: %v", err)
+    }
+    for _, tc := range []struct {
+        percentile float64
+        wantMilli  int64
+    }{{50, 100}, {95, 200}, {99, 300}, {100, 400}} {
+        selected := Select(nodes, tc.percentile)
+        cpu := selected["node-a"][v1.ResourceCPU]
+        if cpu.MilliValue() != tc.wantMilli {
+            t.Errorf("Select p%v cpu = %dm, want %dm", tc.percentile, cpu.MilliValue(), tc.wantMilli)
+        }
+    }
+}
+
+func TestPrometheusQueryError(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusBadRequest)
+        json.NewEncoder(w).Encode(map[string]string{
+            "status":    "error",
+            "errorType": "bad_data",
+            "error":     "parse error",
+        })
+    }))
+    defer srv.Close()
+
+    p := newTestProvider(t, srv.URL)
+    if _, err := p.NodeUsage(context.Background()); err == nil || !strings.Contains(err.Error(), "bad_data: parse error") {
+        t.Errorf("NodeUsage error = %v, want the prometheus error", err)
+    }
+    if _, err := p.PodUsage(context.Background(), "team-a"); err == nil {
+        t.Error("PodUsage succeeded on an error response")
+    }
+    if _, err := p.ContainerUsage(context.Background(), "team-a"); err == nil {
+        t.Error("ContainerUsage succeeded on an error response")
+    }
+}
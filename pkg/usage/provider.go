@@ -0,0 +1,132 @@
+package usage
+
+import (
+    "context"
+    "fmt"
+
+    v1 "k8s.io/api/core/v1"
+    "k8s.io/apimachinery/pkg/api/resource"
+    "kcap/pkg/k8s"
+)
+
+// Stats summarises the observed usage of a single node or pod over the
+// provider's lookback window. Each field holds CPU and memory quantities.
+type Stats struct {
+    P50 v1.ResourceList
+    P95 v1.ResourceList
+    P99 v1.ResourceList
+    Max v1.ResourceList
+}
+
+// At returns the usage at the given percentile. 100 selects the maximum.
+func (s Stats) At(percentile float64) v1.ResourceList {
+    switch percentile {
+    case 50:
+        return s.P50
+    case 99:
+        return s.P99
+    case 100:
+        return s.Max
+    default:
+        return s.P95
+    }
+}
+
+// Provider returns usage statistics for nodes and pods.
+type Provider interface {
+    // NodeUsage returns usage for all nodes, keyed by node name.
+    NodeUsage(ctx context.Context) (map[string]Stats, error)
+    // PodUsage returns usage for pods in the given namespace, keyed by pod
+    // namespace and name. Passing empty string returns usage for all pods.
+    PodUsage(ctx context.Context, namespace string) (map[k8s.PodKey]Stats, error)
+    // ContainerUsage returns usage for containers in the given namespace,
+    // keyed by pod and then container name.
+    ContainerUsage(ctx context.Context, namespace string) (map[k8s.PodKey]map[string]Stats, error)
+}
+
+// ValidatePercentile checks that the percentile is one the providers report.
+func ValidatePercentile(percentile float64) error {
+    switch percentile {
+    case 50, 95, 99, 100:
+        return nil
+    }
+    return fmt.Errorf("unsupported percentile %v (supported: 50, 95, 99, 100)", percentile)
+}
+
+// PodAndContainerUsage returns the pod and container usage of the given
+// namespace. metrics-server reports pod usage as the sum of the pod's
+// containers, so for it pod usage is derived from the container usage
+// rather than listing the pod metrics a second time.
+func PodAndContainerUsage(ctx context.Context, p Provider, namespace string) (map[k8s.PodKey]Stats, map[k8s.PodKey]map[string]Stats, error) {
+    containers, err := p.ContainerUsage(ctx, namespace)
+    if err != nil {
+        return nil, nil, fmt.Errorf("container usage: %w", err)
+    }
+    if _, ok := p.(*MetricsServerProvider); ok {
+        return sumContainers(containers), containers, nil
+    }
+    pods, err := p.PodUsage(ctx, namespace)
+    if err != nil {
+        return nil, nil, fmt.Errorf("pod usage: %w", err)
+    }
+    return pods, containers, nil
+}
+
+// sumContainers sums the container usage of each pod per percentile. This
+// is exact only for instantaneous samples, where every percentile is the
+// same sample.
+func sumContainers(containers map[k8s.PodKey]map[string]Stats) map[k8s.PodKey]Stats {
+    out := make(map[k8s.PodKey]Stats, len(containers))
+    for key, stats := range containers {
+        var sum Stats
+        for _, s := range stats {
+            sum.P50 = addResources(sum.P50, s.P50)
+            sum.P95 = addResources(sum.P95, s.P95)
+            sum.P99 = addResources(sum.P99, s.P99)
+            sum.Max = addResources(sum.Max, s.Max)
+        }
+        out[key] = sum
+    }
+    return out
+}
+
+// addResources returns the CPU and memory of a plus b.
+func addResources(a, b v1.ResourceList) v1.ResourceList {
+    cpu := a.Cpu().MilliValue() + b.Cpu().MilliValue()
+    mem := a.Memory().Value() + b.Memory().Value()
+    return v1.ResourceList{
+        v1.ResourceCPU:    *resource.NewMilliQuantity(cpu, resource.DecimalSI),
+        v1.ResourceMemory: *resource.NewQuantity(mem, resource.BinarySI),
+    }
+}
+
+// Select reduces usage statistics to a single sample per key at the given
+// percentile, in the form expected by the analysis package.
+func Select[K comparable](stats map[K]Stats, percentile float64) map[K]v1.ResourceList {
+    if stats == nil {
+        return nil
+    }
+    out := make(map[K]v1.ResourceList, len(stats))
+    for k, s := range stats {
+        out[k] = s.At(percentile)
+    }
+    return out
+}
+
+// SelectContainers is Select for per-container usage.
+func SelectContainers[K comparable](stats map[K]map[string]Stats, percentile float64) map[K]map[string]v1.ResourceList {
+    if stats == nil {
+        return nil
+    }
+    out := make(map[K]map[string]v1.ResourceList, len(stats))
+    for k, containers := range stats {
+        out[k] = Select(containers, percentile)
+    }
+    return out
+}
+
+// instantStats builds Stats from a single sample, where every percentile
+// equals the sample itself.
+func instantStats(sample v1.ResourceList) Stats {
+    return Stats{P50: sample, P95: sample, P99: sample, Max: sample}
+}